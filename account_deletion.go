@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+/* Requires an access token and the account password again
+	{
+		"password": "example_password"
+	}
+   Accounts without a password send no body, and instead need an access
+   token from a login in the last ten minutes, such as a fresh magic link
+*/
+
+type DeleteUserRequest struct {
+	Password string `json:"password"`
+}
+
+// how recent a login must be to delete an account that has no password
+const deletionReauthWindow = 10 * time.Minute
+
+/* Returns 202 Accepted with when the account will be purged
+	{
+		"delete_after": "2021-07-31T00:00:00Z"
+	}
+*/
+
+type DeleteUserResponse struct {
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+// schedule the caller's account for deletion. Their chirps disappear right
+// away and every token they hold stops working; logging in again before the
+// grace period ends cancels the deletion.
+func (cfg *apiConfig) handlerDeleteUser(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	userDb, err := cfg.DbPtr.GetUserById(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up user", err)
+		return
+	}
+
+	// a stolen access token alone shouldn't be enough to delete an account
+	if userDb.HashedPassword == "" {
+		if !cfg.requireFreshLogin(w, r, claims) {
+			return
+		}
+	} else {
+		decoder := json.NewDecoder(r.Body)
+		reqBody := DeleteUserRequest{}
+		err := decoder.Decode(&reqBody)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+			return
+		}
+		if err := auth.CheckPasswordHash(userDb.HashedPassword, reqBody.Password); err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Password doesn't match", err)
+			return
+		}
+	}
+
+	deleteAfter := time.Now().UTC().Add(cfg.DeletionGracePeriod)
+	userDb, err = cfg.DbPtr.ScheduleUserDeletion(r.Context(), database.ScheduleUserDeletionParams{
+		ID:          userDb.ID,
+		DeleteAfter: sql.NullTime{Time: deleteAfter, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't schedule account deletion", err)
+		return
+	}
+
+	// log out everywhere, the same way handlerLogoutAll does
+	if err := cfg.DbPtr.RevokeAllRefreshTokensForUser(r.Context(), userDb.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke refresh tokens", err)
+		return
+	}
+	if _, err := cfg.Revocations.BumpGeneration(r.Context(), userDb.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	cfg.recordAuditEvent(r, userDb.ID, auditAccountDeletionScheduled, map[string]string{"delete_after": deleteAfter.Format(time.RFC3339)})
+
+	err = cfg.Mailer.Send(r.Context(), mailer.Message{
+		To:      userDb.Email,
+		Subject: "Your Chirpy account will be deleted",
+		Body:    fmt.Sprintf("Your Chirpy account and everything in it will be permanently deleted on %s.\n\nChanged your mind? Just log in again before then and the deletion will be cancelled.\n", deleteAfter.Format(time.RFC1123)),
+	})
+	if err != nil {
+		log.Printf("Couldn't send account deletion notice: %s", err)
+	}
+
+	respondWithJSON(w, http.StatusAccepted, DeleteUserResponse{DeleteAfter: deleteAfter})
+}
+
+// requireFreshLogin rejects access tokens whose login session started more
+// than deletionReauthWindow ago, standing in for a password prompt
+func (cfg *apiConfig) requireFreshLogin(w http.ResponseWriter, r *http.Request, claims auth.Claims) bool {
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Log in again to do this", fmt.Errorf("token %s has no login session", claims.TokenID))
+		return false
+	}
+	session, err := cfg.DbPtr.GetSession(r.Context(), database.GetSessionParams{
+		ID:     sessionID,
+		UserID: claims.UserID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "Log in again to do this", err)
+		return false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up session", err)
+		return false
+	}
+	if time.Since(session.CreatedAt) > deletionReauthWindow {
+		respondWithError(w, http.StatusUnauthorized, "Log in again to do this", fmt.Errorf("session %s started at %s", session.ID, session.CreatedAt))
+		return false
+	}
+	return true
+}
+
+// purgeDeletedUsers hard-deletes accounts whose grace period has run out.
+// Everything they own goes with them through ON DELETE CASCADE.
+func (cfg *apiConfig) purgeDeletedUsers(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := cfg.purgeScheduledUsers(ctx, time.Now().UTC())
+			if err != nil {
+				log.Printf("Couldn't purge deleted users: %s", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d deleted users", purged)
+			}
+		}
+	}
+}
+
+// purgeScheduledUsers deletes the accounts due by cutoff, then the files of
+// their uploads. The rows go with the users, so which uploads they had is
+// read first.
+func (cfg *apiConfig) purgeScheduledUsers(ctx context.Context, cutoff time.Time) (int64, error) {
+	deleteAfter := sql.NullTime{Time: cutoff, Valid: true}
+
+	tx, err := cfg.DbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	userIDs, err := qtx.LockUsersScheduledBefore(ctx, deleteAfter)
+	if err != nil || len(userIDs) == 0 {
+		return 0, err
+	}
+	uploadIDs, err := qtx.GetUploadIDsForUsers(ctx, userIDs)
+	if err != nil {
+		return 0, err
+	}
+	variants, err := qtx.GetUploadVariantsForUploads(ctx, uploadIDs)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := qtx.DeleteUsersScheduledBefore(ctx, deleteAfter)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	cfg.deleteUploadFiles(ctx, uploadIDs, variants)
+	return purged, nil
+}
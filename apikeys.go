@@ -0,0 +1,333 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAPIKeyLifetimeDays = 90
+	maxAPIKeyLifetimeDays     = 365
+)
+
+/* Accepts a JSON body with the following shape
+	{
+		"name": "deploy bot",
+		"scopes": ["chirps:write"],
+		"expires_in_days": 90
+	}
+*/
+
+type APIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+/* Keys are returned in this shape. "key" is only present in the response to
+   POST /api/keys; the secret can't be retrieved again after that
+	{
+		"id": "2b1f6c1e-4f1a-4c53-a3f5-0f9f2b5d7a11",
+		"name": "deploy bot",
+		"prefix": "3fa85f64b2c1",
+		"scopes": ["chirps:write"],
+		"created_at": "2021-07-01T00:00:00Z",
+		"updated_at": "2021-07-01T00:00:00Z",
+		"expires_at": "2021-09-29T00:00:00Z",
+		"last_used_at": null,
+		"key": "chirpy_3fa85f64b2c1_56aa826d..."
+	}
+*/
+
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func newAPIKeyResponse(key database.ApiKey) APIKey {
+	resp := APIKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+		UpdatedAt: key.UpdatedAt,
+		ExpiresAt: key.ExpiresAt,
+	}
+	if key.LastUsedAt.Valid {
+		resp.LastUsedAt = &key.LastUsedAt.Time
+	}
+	return resp
+}
+
+// authenticateAPIKey resolves "Authorization: ApiKey <key>" to the owner's claims
+func (cfg *apiConfig) authenticateAPIKey(r *http.Request) (auth.Claims, error) {
+	key, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	prefix, secret, err := auth.ParseAPIKey(key)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	keyDb, err := cfg.DbPtr.GetAPIKeyByPrefix(r.Context(), prefix)
+	if err != nil {
+		return auth.Claims{}, fmt.Errorf("couldn't find API key %s: %w", prefix, err)
+	}
+
+	if err := auth.CheckAPIKeySecret(keyDb.HashedSecret, secret); err != nil {
+		return auth.Claims{}, err
+	}
+
+	if !time.Now().UTC().Before(keyDb.ExpiresAt) {
+		return auth.Claims{}, fmt.Errorf("API key %s expired at %s", prefix, keyDb.ExpiresAt)
+	}
+
+	// keys die with the tokens on log out everywhere, password resets and
+	// deletion requests, just as access tokens do
+	generation, err := cfg.Revocations.Generation(r.Context(), keyDb.UserID)
+	if err != nil {
+		return auth.Claims{}, fmt.Errorf("couldn't check token generation: %w", err)
+	}
+	if keyDb.TokenGeneration < generation {
+		return auth.Claims{}, fmt.Errorf("API key %s predates the user's last log out everywhere", prefix)
+	}
+
+	// throttled in SQL to at most one write a minute per key
+	if err := cfg.DbPtr.TouchAPIKey(r.Context(), keyDb.ID); err != nil {
+		log.Printf("Couldn't record API key use: %s", err)
+	}
+
+	return auth.Claims{
+		UserID:    keyDb.UserID,
+		APIKeyID:  keyDb.ID,
+		Scopes:    keyDb.Scopes,
+		IssuedAt:  keyDb.CreatedAt,
+		ExpiresAt: keyDb.ExpiresAt,
+	}, nil
+}
+
+// validateAPIKeyScopes makes sure a key never gets more than its creator has
+func validateAPIKeyScopes(scopes []string, claims auth.Claims) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(auth.DefaultScopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+		if !claims.HasScope(scope) {
+			return fmt.Errorf("can't grant scope %q you don't have", scope)
+		}
+	}
+	return nil
+}
+
+// create an API key. Returns 201 with the key, the only time the secret is shown
+func (cfg *apiConfig) handlerCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := APIKeyRequest{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	if reqBody.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "API keys need a name", fmt.Errorf("missing API key name"))
+		return
+	}
+
+	if err := validateAPIKeyScopes(reqBody.Scopes, claims); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	days := reqBody.ExpiresInDays
+	if days == 0 {
+		days = defaultAPIKeyLifetimeDays
+	}
+	if days < 0 || days > maxAPIKeyLifetimeDays {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("expires_in_days must be between 1 and %d", maxAPIKeyLifetimeDays), fmt.Errorf("invalid API key lifetime %d", days))
+		return
+	}
+
+	key, prefix, secret, err := auth.MakeAPIKey()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate API key", err)
+		return
+	}
+
+	keyDb, err := cfg.DbPtr.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:       claims.UserID,
+		Name:         reqBody.Name,
+		Prefix:       prefix,
+		HashedSecret: auth.HashToken(secret),
+		Scopes:       reqBody.Scopes,
+		ExpiresAt:    time.Now().UTC().Add(time.Duration(days) * 24 * time.Hour),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save API key", err)
+		return
+	}
+
+	cfg.recordAuditEvent(r, claims.UserID, auditAPIKeyCreated, map[string]string{"api_key_id": keyDb.ID.String()})
+
+	resp := newAPIKeyResponse(keyDb)
+	resp.Key = key
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+// list the caller's API keys
+func (cfg *apiConfig) handlerGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	keysDb, err := cfg.DbPtr.GetAPIKeysForUser(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve API keys", err)
+		return
+	}
+
+	keys := []APIKey{}
+	for _, key := range keysDb {
+		keys = append(keys, newAPIKeyResponse(key))
+	}
+
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+// get one of the caller's API keys
+func (cfg *apiConfig) handlerGetAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid API key ID", err)
+		return
+	}
+
+	keyDb, err := cfg.DbPtr.GetAPIKeyForUser(r.Context(), database.GetAPIKeyForUserParams{
+		ID:     keyID,
+		UserID: claims.UserID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "API key not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve API key", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newAPIKeyResponse(keyDb))
+}
+
+// rename an API key or change its scopes
+func (cfg *apiConfig) handlerUpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid API key ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := APIKeyRequest{}
+	err = decoder.Decode(&reqBody)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	if reqBody.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "API keys need a name", fmt.Errorf("missing API key name"))
+		return
+	}
+
+	if err := validateAPIKeyScopes(reqBody.Scopes, claims); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	keyDb, err := cfg.DbPtr.UpdateAPIKey(r.Context(), database.UpdateAPIKeyParams{
+		ID:     keyID,
+		UserID: claims.UserID,
+		Name:   reqBody.Name,
+		Scopes: reqBody.Scopes,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "API key not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update API key", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newAPIKeyResponse(keyDb))
+}
+
+// delete an API key. Returns 204 No Content
+func (cfg *apiConfig) handlerDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid API key ID", err)
+		return
+	}
+
+	deleted, err := cfg.DbPtr.DeleteAPIKey(r.Context(), database.DeleteAPIKeyParams{
+		ID:     keyID,
+		UserID: claims.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete API key", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "API key not found", fmt.Errorf("no API key %s for user %s", keyID, claims.UserID))
+		return
+	}
+
+	cfg.recordAuditEvent(r, claims.UserID, auditAPIKeyDeleted, map[string]string{"api_key_id": keyID.String()})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"unicode/utf8"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/imaging"
+	"github.com/google/uuid"
+)
+
+const (
+	maxChirpAttachments = 4
+	maxAltTextLength    = 1000
+)
+
+/* Chirps can include up to four processed uploads, each with optional alt text
+	"attachments": [
+		{
+			"upload_id": "1b4e28ba-2fa1-11d2-883f-0016d3cca427",
+			"alt_text": "A gopher wearing a party hat"
+		}
+	]
+*/
+
+type AttachmentRequest struct {
+	UploadID uuid.UUID `json:"upload_id"`
+	AltText  string    `json:"alt_text"`
+}
+
+/* Attachments come back on chirps in the order they were given
+	{
+		"id": "1b4e28ba-2fa1-11d2-883f-0016d3cca427",
+		"alt_text": "A gopher wearing a party hat",
+		"width": 1000,
+		"height": 2000,
+		"blurhash": "LEHV6nWB2yk8pyo0adR*.7kCMdnj",
+		"url": "http://localhost:8080/media/5e8a14...",
+		"variants": {"original": {...}, "medium": {...}, "thumbnail": {...}}
+	}
+   "variants" has the same shape as on uploads
+*/
+
+type Attachment struct {
+	ID       uuid.UUID                `json:"id"`
+	AltText  string                   `json:"alt_text"`
+	Width    int32                    `json:"width"`
+	Height   int32                    `json:"height"`
+	BlurHash string                   `json:"blurhash"`
+	URL      string                   `json:"url"`
+	Variants map[string]UploadVariant `json:"variants"`
+}
+
+// errInvalidAttachment covers anything wrong with an attachment the caller
+// can fix, and is safe to show them
+type errInvalidAttachment struct {
+	msg string
+}
+
+func (e errInvalidAttachment) Error() string {
+	return e.msg
+}
+
+// validateAttachments checks the caller owns every upload and that they've
+// all finished processing
+func (cfg *apiConfig) validateAttachments(ctx context.Context, userID uuid.UUID, attachments []AttachmentRequest) error {
+	if len(attachments) > maxChirpAttachments {
+		return errInvalidAttachment{fmt.Sprintf("A chirp can have at most %d attachments", maxChirpAttachments)}
+	}
+
+	seen := map[uuid.UUID]bool{}
+	for _, attachment := range attachments {
+		if seen[attachment.UploadID] {
+			return errInvalidAttachment{"Each upload can only be attached once"}
+		}
+		seen[attachment.UploadID] = true
+
+		if utf8.RuneCountInString(attachment.AltText) > maxAltTextLength {
+			return errInvalidAttachment{fmt.Sprintf("alt_text can be at most %d characters", maxAltTextLength)}
+		}
+
+		uploadDb, err := cfg.DbPtr.GetUpload(ctx, attachment.UploadID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && uploadDb.UserID != userID) {
+			return errInvalidAttachment{fmt.Sprintf("Upload %s not found", attachment.UploadID)}
+		}
+		if err != nil {
+			return err
+		}
+		if uploadDb.Status != "ready" {
+			return errInvalidAttachment{fmt.Sprintf("Upload %s hasn't finished processing", attachment.UploadID)}
+		}
+	}
+	return nil
+}
+
+// lockUploads stops the uploads being cleaned up before the caller's
+// transaction commits. validateAttachments ran outside it, so one may have
+// gone since.
+func lockUploads(ctx context.Context, q *database.Queries, uploadIDs []uuid.UUID) error {
+	if len(uploadIDs) == 0 {
+		return nil
+	}
+	locked, err := q.LockUploads(ctx, uploadIDs)
+	if err != nil {
+		return err
+	}
+	if len(locked) < len(uploadIDs) {
+		return errInvalidAttachment{"Upload not found"}
+	}
+	return nil
+}
+
+// embedAttachments fills in Attachments on each chirp with two queries for all of them
+func (cfg *apiConfig) embedAttachments(ctx context.Context, chirps []Chirp) error {
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+	if len(chirpIDs) == 0 {
+		return nil
+	}
+
+	rows, err := cfg.DbPtr.GetChirpAttachments(ctx, chirpIDs)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	uploadIDs := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		uploadIDs = append(uploadIDs, row.UploadID)
+	}
+	variantsDb, err := cfg.DbPtr.GetUploadVariantsForUploads(ctx, uploadIDs)
+	if err != nil {
+		return err
+	}
+	variants := map[uuid.UUID]map[string]UploadVariant{}
+	for _, variant := range variantsDb {
+		if variants[variant.UploadID] == nil {
+			variants[variant.UploadID] = map[string]UploadVariant{}
+		}
+		variants[variant.UploadID][variant.Name] = UploadVariant{
+			URL:         cfg.mediaURL(variant.Sha256),
+			ContentType: variant.ContentType,
+			Width:       variant.Width,
+			Height:      variant.Height,
+			Size:        variant.Size,
+		}
+	}
+
+	// rows come back ordered by position within each chirp
+	attachments := map[uuid.UUID][]Attachment{}
+	for _, row := range rows {
+		attachments[row.ChirpID] = append(attachments[row.ChirpID], Attachment{
+			ID:       row.UploadID,
+			AltText:  row.AltText,
+			Width:    row.Width.Int32,
+			Height:   row.Height.Int32,
+			BlurHash: row.Blurhash.String,
+			URL:      variants[row.UploadID][imaging.VariantOriginal].URL,
+			Variants: variants[row.UploadID],
+		})
+	}
+
+	for i := range chirps {
+		if a, ok := attachments[chirps[i].ID]; ok {
+			chirps[i].Attachments = a
+		}
+	}
+	return nil
+}
+
+// deleteUnusedUploads removes the given uploads if nothing refers to them any
+// more, then deletes any of their files no other upload shares
+func (cfg *apiConfig) deleteUnusedUploads(ctx context.Context, uploadIDs []uuid.UUID) {
+	if len(uploadIDs) == 0 {
+		return
+	}
+
+	// the variant rows go with the uploads, so look up their files first
+	variantsDb, err := cfg.DbPtr.GetUploadVariantsForUploads(ctx, uploadIDs)
+	if err != nil {
+		log.Printf("Couldn't look up upload variants: %s", err)
+		return
+	}
+
+	// lock first, so the DELETE sees chirps and profiles that took the
+	// uploads up while it waited
+	tx, err := cfg.DbConn.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Couldn't delete unused uploads: %s", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+	if err := qtx.LockUploadsForDelete(ctx, uploadIDs); err != nil {
+		log.Printf("Couldn't lock unused uploads: %s", err)
+		return
+	}
+	deleted, err := qtx.DeleteUnusedUploads(ctx, uploadIDs)
+	if err != nil {
+		log.Printf("Couldn't delete unused uploads: %s", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Couldn't delete unused uploads: %s", err)
+		return
+	}
+	cfg.deleteUploadFiles(ctx, deleted, variantsDb)
+}
+
+// deleteUploadFiles deletes the files of uploads that are gone: the raw file
+// if it was never processed, and any variants no other upload shares.
+// variants may include ones of uploads that weren't deleted; they're skipped.
+func (cfg *apiConfig) deleteUploadFiles(ctx context.Context, deleted []uuid.UUID, variants []database.UploadVariant) {
+	wasDeleted := map[uuid.UUID]bool{}
+	for _, id := range deleted {
+		wasDeleted[id] = true
+		// normally already gone, once the upload was processed
+		if err := cfg.Blobs.Delete(ctx, incomingUploadKey(id)); err != nil {
+			log.Printf("Couldn't delete incoming upload %s: %s", id, err)
+		}
+	}
+
+	checked := map[string]bool{}
+	for _, variant := range variants {
+		if !wasDeleted[variant.UploadID] || checked[variant.Sha256] {
+			continue
+		}
+		checked[variant.Sha256] = true
+
+		if err := cfg.deleteMediaIfUnused(ctx, variant.Sha256); err != nil {
+			log.Printf("Couldn't delete media %s: %s", variant.Sha256, err)
+		}
+	}
+}
+
+// deleteMediaIfUnused deletes the file with this hash unless a variant still
+// uses it. The lock keeps processUpload from storing the same file again, for
+// a variant we can't see yet, while we check and delete.
+func (cfg *apiConfig) deleteMediaIfUnused(ctx context.Context, hash string) error {
+	tx, err := cfg.DbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	if err := qtx.LockMedia(ctx, hash); err != nil {
+		return err
+	}
+	inUse, err := qtx.IsMediaInUse(ctx, hash)
+	if err != nil || inUse {
+		return err
+	}
+	return cfg.Blobs.Delete(ctx, mediaKey(hash))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// security-relevant things that happen to an account, kept so users can see
+// (and export) who did what from where
+const (
+	auditLogin                    = "login"
+	auditLoginMagicLink           = "login.magic_link"
+	auditLogoutAll                = "logout.all"
+	auditSessionRevoked           = "session.revoked"
+	auditPasswordReset            = "password.reset"
+	auditPasswordLoginChanged     = "password_login.changed"
+	auditAPIKeyCreated            = "api_key.created"
+	auditAPIKeyDeleted            = "api_key.deleted"
+	auditOAuthClientCreated       = "oauth_client.created"
+	auditOAuthClientDeleted       = "oauth_client.deleted"
+	auditOAuthAuthorized          = "oauth.authorized"
+	auditAccountDeletionScheduled = "account.deletion_scheduled"
+	auditAccountDeletionCancelled = "account.deletion_cancelled"
+	auditDataExportRequested      = "data_export.requested"
+)
+
+// recordAuditEvent never fails the request; a lost audit row is logged instead
+func (cfg *apiConfig) recordAuditEvent(r *http.Request, userID uuid.UUID, event string, metadata map[string]string) {
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		log.Printf("Couldn't encode audit metadata for %s: %s", event, err)
+		return
+	}
+
+	err = cfg.DbPtr.CreateAuditEvent(r.Context(), database.CreateAuditEventParams{
+		UserID:    userID,
+		Event:     event,
+		IpAddress: cfg.clientIP(r),
+		UserAgent: r.UserAgent(),
+		Metadata:  data,
+	})
+	if err != nil {
+		log.Printf("Couldn't record audit event %s for user %s: %s", event, userID, err)
+	}
+}
+
+/* Audit events look like this in exports
+	{
+		"id": "d7f0a3f2-5a55-4a9f-9d55-36c9d1f0c1a4",
+		"event": "api_key.created",
+		"ip_address": "203.0.113.7",
+		"user_agent": "Mozilla/5.0 ...",
+		"metadata": {"api_key_id": "0c9d2fb1-7b0a-4a57-9a43-0c3c0a0f6b7e"},
+		"created_at": "2021-07-01T00:00:00Z"
+	}
+*/
+
+type AuditEvent struct {
+	ID        uuid.UUID       `json:"id"`
+	Event     string          `json:"event"`
+	IPAddress string          `json:"ip_address"`
+	UserAgent string          `json:"user_agent"`
+	Metadata  json.RawMessage `json:"metadata"`
+	CreatedAt time.Time       `json:"created_at"`
+}
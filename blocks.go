@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+/* Blocking someone returns
+	{
+		"blocker_id": "50746277-23c6-4d85-a890-564c0044c2fb",
+		"blocked_id": "5a47789c-a617-444a-8a80-b50359247804",
+		"created_at": "2021-07-01T00:00:00Z"
+	}
+   It ends follows either way between the two, and until it's undone the
+   blocked user can't follow the blocker, @mention them or notify them of
+   anything. Their chirps are left out of the blocker's mentions.
+
+   GET /api/blocks lists who the caller has blocked as a page (see Page in
+   pagination.go) of users like the follow lists, with "blocked_at"
+*/
+
+type Block struct {
+	BlockerID uuid.UUID `json:"blocker_id"`
+	BlockedID uuid.UUID `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BlockListUser struct {
+	PublicUser
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+func newBlockResponse(block database.Block) Block {
+	return Block{
+		BlockerID: block.BlockerID,
+		BlockedID: block.BlockedID,
+		CreatedAt: block.CreatedAt,
+	}
+}
+
+func blockListCursor(user BlockListUser) pageCursor {
+	return pageCursor{Time: user.BlockedAt, ID: user.ID}
+}
+
+// block a user. Returns 201 Created, or 200 OK if they were already blocked
+func (cfg *apiConfig) handlerBlock(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	userDb, err := cfg.lookupUser(r.Context(), r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+	if userDb.ID == claims.UserID {
+		respondWithError(w, http.StatusBadRequest, "You can't block yourself", fmt.Errorf("user %s tried to block themselves", claims.UserID))
+		return
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't block user", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	added, err := qtx.CreateBlock(r.Context(), database.CreateBlockParams{
+		BlockerID: claims.UserID,
+		BlockedID: userDb.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't block user", err)
+		return
+	}
+	blockDb, err := qtx.GetBlock(r.Context(), database.GetBlockParams{
+		BlockerID: claims.UserID,
+		BlockedID: userDb.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't block user", err)
+		return
+	}
+
+	err = qtx.DeleteFollowsBetween(r.Context(), database.DeleteFollowsBetweenParams{
+		UserID:  claims.UserID,
+		OtherID: userDb.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove follows", err)
+		return
+	}
+	if err := cfg.timelineUnfollowed(r.Context(), qtx, claims.UserID, userDb.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update timeline", err)
+		return
+	}
+	if err := cfg.timelineUnfollowed(r.Context(), qtx, userDb.ID, claims.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update timeline", err)
+		return
+	}
+	err = qtx.DeleteNotificationsFrom(r.Context(), database.DeleteNotificationsFromParams{
+		UserID:  claims.UserID,
+		ActorID: userDb.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove notifications", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't block user", err)
+		return
+	}
+
+	status := http.StatusCreated
+	if added == 0 {
+		status = http.StatusOK
+	}
+	respondWithJSON(w, status, newBlockResponse(blockDb))
+}
+
+// unblock a user. Follows the block ended stay ended. Returns 204 No Content
+func (cfg *apiConfig) handlerUnblock(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	userDb, err := cfg.lookupUser(r.Context(), r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+
+	err = cfg.DbPtr.DeleteBlock(r.Context(), database.DeleteBlockParams{
+		BlockerID: claims.UserID,
+		BlockedID: userDb.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unblock user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// list who the caller has blocked, newest first
+func (cfg *apiConfig) handlerGetBlocks(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	rows, err := cfg.DbPtr.GetBlockedUsers(r.Context(), database.GetBlockedUsersParams{
+		UserID:     claims.UserID,
+		CursorTime: cursor.Time,
+		CursorID:   cursor.ID,
+		PageSize:   limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve blocks", err)
+		return
+	}
+
+	users := make([]BlockListUser, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, BlockListUser{
+			PublicUser: PublicUser{
+				ID:          row.ID,
+				Handle:      row.Handle,
+				DisplayName: row.DisplayName,
+				Bio:         row.Bio,
+				AvatarURL:   row.AvatarUrl,
+				IsPrivate:   row.IsPrivate,
+				CreatedAt:   row.CreatedAt,
+			},
+			BlockedAt: row.BlockedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, newPage(users, limit, blockListCursor))
+}
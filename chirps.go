@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"slices"
@@ -13,16 +15,24 @@ import (
 	"github.com/google/uuid"
 )
 
-/* Accepts a JSON body with the following shape
+/* Requires an access token with the chirps:write scope and accepts a JSON body with the following shape
 {
 	"body": "Hello, world!",
-	"user_id": "123e4567-e89b-12d3-a456-426614174000"
+	"attachments": [],
+	"in_reply_to": "94b7e44c-3604-42e3-bef7-ebfcc3efff8f",
+	"quote_of": "5f2b1c9d-7a3e-4d8f-9b6a-0c1e2d3f4a5b"
 }
+   "attachments" is optional; see AttachmentRequest in attachments.go
+   "in_reply_to" is optional and makes the chirp a reply in that chirp's thread
+   "quote_of" is optional and makes the chirp a quote of that chirp. The quote's
+   own body is held to the same length limit as any other chirp
 */
 
 type ChirpRequest struct {
 	Body   string `json:"body"`
-	UserID uuid.UUID `json:"user_id"`
+	Attachments []AttachmentRequest `json:"attachments"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+	QuoteOf   *uuid.UUID `json:"quote_of"`
 }
 
 /* If successful, return 201 and chirp that matches the following:
@@ -31,16 +41,114 @@ type ChirpRequest struct {
 	"created_at": "2021-01-01T00:00:00Z",
 	"updated_at": "2021-01-01T00:00:00Z",
 	"body": "Hello, world!",
-	"user_id": "123e4567-e89b-12d3-a456-426614174000"
+	"user_id": "123e4567-e89b-12d3-a456-426614174000",
+	"attachments": [],
+	"hashtags": [],
+	"mentions": [],
+	"in_reply_to": null,
+	"root_id": null,
+	"rechirp_of": null,
+	"quote_of": null,
+	"reply_count": 0,
+	"like_count": 0,
+	"rechirp_count": 0,
+	"quote_count": 0,
+	"liked_by_me": false
 	}
+   "hashtags" lists the body's #hashtags with their offsets; see hashtags.go
+   "mentions" lists the users it @mentions, likewise; see mentions.go
+   GET requests with ?expand=author also get an "author" object (AuthorSummary in profiles.go)
+   "liked_by_me" is left out for anonymous callers
+   Replies have "in_reply_to" set to their parent and "root_id" to the chirp that started the thread
+   Rechirps and quotes have "rechirp_of" or "quote_of" set and embed that chirp
+   as "referenced_chirp"; see reposts.go
 */
 
 type Chirp struct {
 	ID        uuid.UUID    `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
 	Body      string    `json:"body"`
-	UserID    uuid.UUID    `json:"user_id"`
+	UserID    uuid.UUID    `json:"user_id,omitzero"`
+	Author    *AuthorSummary `json:"author,omitempty"`
+	Attachments []Attachment `json:"attachments"`
+	Hashtags  []Hashtag `json:"hashtags"`
+	Mentions  []Mention `json:"mentions"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+	RootID    *uuid.UUID `json:"root_id"`
+	RechirpOf *uuid.UUID `json:"rechirp_of"`
+	QuoteOf   *uuid.UUID `json:"quote_of"`
+	Referenced *Chirp `json:"referenced_chirp,omitempty"`
+	ReplyCount int64 `json:"reply_count"`
+	LikeCount  int64 `json:"like_count"`
+	RechirpCount int64 `json:"rechirp_count"`
+	QuoteCount   int64 `json:"quote_count"`
+	// only set for logged-in callers
+	LikedByMe  *bool `json:"liked_by_me,omitempty"`
+	// set on tombstones; see threads.go
+	Deleted   bool `json:"deleted,omitempty"`
+}
+
+func newChirpResponse(chirp database.Chirp) Chirp {
+	return Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		Attachments: []Attachment{},
+		Hashtags:  parseHashtags(chirp.Body),
+		Mentions:  []Mention{},
+		InReplyTo: nullUUIDPtr(chirp.InReplyTo),
+		RootID:    nullUUIDPtr(chirp.RootID),
+		RechirpOf: nullUUIDPtr(chirp.RechirpOf),
+		QuoteOf:   nullUUIDPtr(chirp.QuoteOf),
+	}
+}
+
+func nullUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+// embedChirpDetails fills in everything shown on chirps that's kept in other
+// tables, including the chirps they rechirp or quote. viewerID is the caller,
+// or uuid.Nil when they're anonymous.
+func (cfg *apiConfig) embedChirpDetails(ctx context.Context, chirps []Chirp, viewerID uuid.UUID) error {
+	if err := cfg.embedOwnChirpDetails(ctx, chirps, viewerID); err != nil {
+		return err
+	}
+	if err := cfg.embedReferencedChirps(ctx, chirps, viewerID); err != nil {
+		return fmt.Errorf("couldn't retrieve rechirped and quoted chirps: %w", err)
+	}
+	return nil
+}
+
+// embedOwnChirpDetails is embedChirpDetails without the referenced chirps
+func (cfg *apiConfig) embedOwnChirpDetails(ctx context.Context, chirps []Chirp, viewerID uuid.UUID) error {
+	if err := cfg.embedAttachments(ctx, chirps); err != nil {
+		return fmt.Errorf("couldn't retrieve attachments: %w", err)
+	}
+	if err := cfg.embedReplyCounts(ctx, chirps); err != nil {
+		return fmt.Errorf("couldn't retrieve reply counts: %w", err)
+	}
+	if err := cfg.embedLikes(ctx, chirps, viewerID); err != nil {
+		return fmt.Errorf("couldn't retrieve likes: %w", err)
+	}
+	if err := cfg.embedRepostCounts(ctx, chirps); err != nil {
+		return fmt.Errorf("couldn't retrieve repost counts: %w", err)
+	}
+	if err := cfg.embedMentions(ctx, chirps); err != nil {
+		return fmt.Errorf("couldn't retrieve mentions: %w", err)
+	}
+	return nil
+}
+
+// wantsAuthor reports whether the request asked for ?expand=author
+func wantsAuthor(r *http.Request) bool {
+	return r.URL.Query().Get("expand") == "author"
 }
 
 // post one chirp
@@ -55,49 +163,175 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	
-	// Need to check if the user_id exists
-	user_id := reqBody.UserID
-	_, err = cfg.DbPtr.GetUserById(context.Background(), user_id)
+	// The author is whoever the access token belongs to
+	user_id := claimsFromContext(r.Context()).UserID
+	userDb, err := cfg.DbPtr.GetUserById(context.Background(), user_id)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "User does not exist in user database", err)
 		return
 	}
 
+	if cfg.RequireVerifiedEmail && !userDb.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Email must be verified before posting chirps", fmt.Errorf("user %s has not verified their email", user_id))
+		return
+	}
+
 	body := reqBody.Body
-	// Need to check if the chirp is valid
+	// Need to check if the chirp is valid. Quotes count the same as any other chirp
 	if len(body) > 140 {
 		respondWithError(w, http.StatusInternalServerError, "Chirp is too long", fmt.Errorf("Chirp is too long"))
 		return
 	}
 
 	newBody := cleanBody(body)
+	tags := chirpTags(newBody)
+	if reqBody.QuoteOf != nil && newBody == "" {
+		respondWithError(w, http.StatusBadRequest, "Quote chirps need a body; rechirp instead", fmt.Errorf("empty quote"))
+		return
+	}
+
+	var invalidAttachment errInvalidAttachment
+	err = cfg.validateAttachments(r.Context(), user_id, reqBody.Attachments)
+	if errors.As(err, &invalidAttachment) {
+		respondWithError(w, http.StatusBadRequest, invalidAttachment.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up attachments", err)
+		return
+	}
 
 	chirpParams := database.CreateChirpParams {
 		Body: newBody,
 		UserID: user_id,
 	}
+	// whose chirp this replies to, to notify them
+	var parentAuthorID uuid.UUID
+
+	if reqBody.InReplyTo != nil {
+		parentDb, err := cfg.lookupOriginalChirp(r.Context(), *reqBody.InReplyTo, user_id)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Chirp being replied to not found", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't look up chirp being replied to", err)
+			return
+		}
+		chirpParams.InReplyTo = uuid.NullUUID{UUID: parentDb.ID, Valid: true}
+		parentAuthorID = parentDb.UserID
+		chirpParams.RootID = parentDb.RootID
+		if !parentDb.RootID.Valid {
+			chirpParams.RootID = chirpParams.InReplyTo
+		}
+	}
+
+	if reqBody.QuoteOf != nil {
+		quotedDb, err := cfg.lookupOriginalChirp(r.Context(), *reqBody.QuoteOf, user_id)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Chirp being quoted not found", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't look up chirp being quoted", err)
+			return
+		}
+		chirpParams.QuoteOf = uuid.NullUUID{UUID: quotedDb.ID, Valid: true}
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error adding chirp to database", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	chirpDb, err := qtx.CreateChirp(r.Context(), chirpParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error adding chirp to database", err)
+		return
+	}
 
-	chirpDb, err := cfg.DbPtr.CreateChirp(context.Background(), chirpParams)
+	uploadIDs := make([]uuid.UUID, 0, len(reqBody.Attachments))
+	for _, attachment := range reqBody.Attachments {
+		uploadIDs = append(uploadIDs, attachment.UploadID)
+	}
+	err = lockUploads(r.Context(), qtx, uploadIDs)
+	if errors.As(err, &invalidAttachment) {
+		respondWithError(w, http.StatusBadRequest, invalidAttachment.Error(), err)
+		return
+	}
 	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error adding attachments to database", err)
+		return
+	}
+
+	for i, attachment := range reqBody.Attachments {
+		err = qtx.CreateChirpAttachment(r.Context(), database.CreateChirpAttachmentParams{
+			ChirpID:  chirpDb.ID,
+			UploadID: attachment.UploadID,
+			Position: int32(i),
+			AltText:  attachment.AltText,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error adding attachments to database", err)
+			return
+		}
+	}
+
+	if len(tags) > 0 {
+		err = qtx.CreateChirpTags(r.Context(), database.CreateChirpTagsParams{
+			ChirpID:   chirpDb.ID,
+			CreatedAt: chirpDb.CreatedAt,
+			Tags:      tags,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error adding hashtags to database", err)
+			return
+		}
+	}
+
+	if err := cfg.timelineChirped(r.Context(), qtx, chirpDb.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error adding chirp to timelines", err)
+		return
+	}
+
+	if err := cfg.saveMentions(r.Context(), qtx, userDb, chirpDb); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error adding mentions to database", err)
+		return
+	}
+
+	if chirpParams.InReplyTo.Valid {
+		if err := cfg.notifyOfChirp(r.Context(), qtx, parentAuthorID, notificationReply, userDb, chirpDb.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error adding notifications to database", err)
+			return
+		}
+	}
+
+	if err := publishStreamEvent(r.Context(), qtx, streamEventChirp, userDb.ID, uuid.NullUUID{UUID: chirpDb.ID, Valid: true}, uuid.NullUUID{}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error publishing chirp", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error adding chirp to database", err)
 		return
 	}
 
-	chirp := Chirp{
-		ID: chirpDb.ID,
-		CreatedAt: chirpDb.CreatedAt,
-		UpdatedAt: chirpDb.UpdatedAt,
-		Body: chirpDb.Body,
-		UserID: chirpDb.UserID,
+	chirps := []Chirp{newChirpResponse(chirpDb)}
+	if err := cfg.embedChirpDetails(r.Context(), chirps, claimsFromContext(r.Context()).UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp details", err)
+		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, chirp)
+	respondWithJSON(w, http.StatusCreated, chirps[0])
 
 }
 
 // get all chirps (sorted by created_at)
 func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
-	chirpsDB, err := cfg.DbPtr.GetChirps(context.Background())
+	chirpsDB, err := cfg.DbPtr.GetChirps(context.Background(), claimsFromContext(r.Context()).UserID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve all chirps", err)
 		return
@@ -106,16 +340,22 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 	chirpsSlice := []Chirp{}
 
 	for _, chirp := range chirpsDB {
-		chirpsSlice = append(chirpsSlice, Chirp{
-			ID: chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body: chirp.Body,
-			UserID: chirp.UserID,
-		})
+		chirpsSlice = append(chirpsSlice, newChirpResponse(chirp))
 	}
 
 	sort.Sort(ByDate{chirpsSlice})
+
+	if err := cfg.embedChirpDetails(r.Context(), chirpsSlice, claimsFromContext(r.Context()).UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp details", err)
+		return
+	}
+
+	if wantsAuthor(r) {
+		if err := cfg.embedAuthors(r.Context(), chirpsSlice); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp authors", err)
+			return
+		}
+	}
 	
 	respondWithJSON(w, http.StatusOK, chirpsSlice)
 }
@@ -134,24 +374,132 @@ func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chirpDb, err := cfg.DbPtr.GetChirpByID(context.Background(), chirpID)
+	chirpDb, err := cfg.DbPtr.GetChirpByID(context.Background(), database.GetChirpByIDParams{
+		ID:       chirpID,
+		ViewerID: claimsFromContext(r.Context()).UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+
+	chirps := []Chirp{newChirpResponse(chirpDb)}
+	if err := cfg.embedChirpDetails(r.Context(), chirps, claimsFromContext(r.Context()).UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp details", err)
+		return
+	}
+	if wantsAuthor(r) {
+		if err := cfg.embedAuthors(r.Context(), chirps); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp author", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps[0])
+
+}
+
+// delete one of the caller's chirps. Returns 204 No Content
+func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	chirpDb, err := cfg.DbPtr.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       chirpID,
+		ViewerID: claims.UserID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
 		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
 		return
 	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp", err)
+		return
+	}
+	if chirpDb.UserID != claims.UserID {
+		respondWithError(w, http.StatusForbidden, "You can only delete your own chirps", fmt.Errorf("user %s doesn't own chirp %s", claims.UserID, chirpID))
+		return
+	}
+
+	uploadIDs, err := cfg.DbPtr.GetChirpAttachmentUploadIDs(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp attachments", err)
+		return
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete chirp", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	if err := deleteChirp(r.Context(), qtx, chirpDb); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete chirp", err)
+		return
+	}
 
-	chirp := Chirp{
-		ID: chirpDb.ID,
-		CreatedAt: chirpDb.CreatedAt,
-		UpdatedAt: chirpDb.UpdatedAt,
-		Body: chirpDb.Body,
-		UserID: chirpDb.UserID,
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete chirp", err)
+		return
 	}
 
-	respondWithJSON(w, http.StatusOK, chirp)
+	// the chirp's attachments went with it; their uploads and files go too
+	// unless something else still uses them
+	go cfg.deleteUnusedUploads(context.Background(), uploadIDs)
 
+	w.WriteHeader(http.StatusNoContent)
 }
 
+// deleteChirp leaves a tombstone in place of a chirp that has replies, so its
+// thread holds together, and deletes it outright otherwise. Tombstones left
+// with no replies by that are cleaned up on the way up the thread. Rechirps
+// go either way; quotes stay, and show the chirp they quoted as a tombstone.
+func deleteChirp(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	hasReplies, err := q.ChirpHasReplies(ctx, uuid.NullUUID{UUID: chirp.ID, Valid: true})
+	if err != nil {
+		return err
+	}
+	if hasReplies {
+		if err := q.TombstoneChirp(ctx, chirp.ID); err != nil {
+			return err
+		}
+		// deleting outright cascades to rechirps, tags and mentions, but tombstoning doesn't
+		if err := q.DeleteRechirpsOf(ctx, uuid.NullUUID{UUID: chirp.ID, Valid: true}); err != nil {
+			return err
+		}
+		if err := q.DeleteChirpTags(ctx, chirp.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteChirpMentions(ctx, chirp.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteChirpAttachments(ctx, chirp.ID); err != nil {
+			return err
+		}
+	} else {
+		if err := q.DeleteChirp(ctx, chirp.ID); err != nil {
+			return err
+		}
+		parent := chirp.InReplyTo
+		for parent.Valid {
+			parent, err = q.DeleteUnrepliedTombstone(ctx, parent.UUID)
+			if errors.Is(err, sql.ErrNoRows) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return publishStreamEvent(ctx, q, streamEventDelete, chirp.UserID, uuid.NullUUID{UUID: chirp.ID, Valid: true}, uuid.NullUUID{})
+}
 
 // Sorting by created_at date for chirps
 type Chirps []Chirp
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	// finished archives, and failed exports, are kept this long before they're pruned
+	dataExportTTL = 7 * 24 * time.Hour
+	// download links are only good for a day, or until the archive is pruned
+	dataExportLinkTTL = 24 * time.Hour
+)
+
+/* Returns exports in this shape. "download_url" appears once the archive is ready
+	{
+		"id": "6a8a1c1e-8c5e-4c86-a0a3-3b8ad53a0c4b",
+		"status": "ready",
+		"created_at": "2021-07-01T00:00:00Z",
+		"completed_at": "2021-07-01T00:00:05Z",
+		"expires_at": "2021-07-08T00:00:05Z",
+		"download_url": "http://localhost:8080/api/users/export/6a8a1c1e-...?expires=1625184005&signature=..."
+	}
+   "status" is one of pending, running, ready or failed
+*/
+
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+func (cfg *apiConfig) newDataExportResponse(export database.GetDataExportsForUserRow) DataExport {
+	resp := DataExport{
+		ID:        export.ID,
+		Status:    export.Status,
+		CreatedAt: export.CreatedAt,
+	}
+	if export.CompletedAt.Valid {
+		resp.CompletedAt = &export.CompletedAt.Time
+	}
+	if export.ExpiresAt.Valid {
+		resp.ExpiresAt = &export.ExpiresAt.Time
+		if export.Status == "ready" && time.Now().UTC().Before(export.ExpiresAt.Time) {
+			resp.DownloadURL = cfg.dataExportDownloadURL(export.ID, export.ExpiresAt.Time)
+		}
+	}
+	return resp
+}
+
+// dataExportDownloadURL signs a link that works without a login, since it's
+// usually opened from the "your export is ready" email
+func (cfg *apiConfig) dataExportDownloadURL(id uuid.UUID, archiveExpiresAt time.Time) string {
+	expires := time.Now().UTC().Add(dataExportLinkTTL)
+	if archiveExpiresAt.Before(expires) {
+		expires = archiveExpiresAt
+	}
+	path := "/api/users/export/" + id.String()
+	return cfg.BaseURL + path + "?" + auth.SignURL(path, expires, cfg.JWTSecret)
+}
+
+// start building an archive of everything stored about the caller. Returns 202 Accepted
+func (cfg *apiConfig) handlerCreateDataExport(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	exportDb, err := cfg.DbPtr.CreateDataExport(r.Context(), claims.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusConflict, "An export is already in progress", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start export", err)
+		return
+	}
+
+	cfg.recordAuditEvent(r, claims.UserID, auditDataExportRequested, map[string]string{"export_id": exportDb.ID.String()})
+
+	// the polling loop in processDataExports would get to it eventually; this just saves the wait
+	go cfg.runPendingDataExports(context.Background())
+
+	respondWithJSON(w, http.StatusAccepted, cfg.newDataExportResponse(database.GetDataExportsForUserRow(exportDb)))
+}
+
+// list the caller's exports, newest first
+func (cfg *apiConfig) handlerGetDataExports(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	exportsDb, err := cfg.DbPtr.GetDataExportsForUser(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve exports", err)
+		return
+	}
+
+	exports := []DataExport{}
+	for _, export := range exportsDb {
+		exports = append(exports, cfg.newDataExportResponse(export))
+	}
+
+	respondWithJSON(w, http.StatusOK, exports)
+}
+
+// download a finished archive. Authenticated by the URL signature alone
+func (cfg *apiConfig) handlerDownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	if err := auth.VerifySignedURL(r.URL.Path, r.URL.Query(), cfg.JWTSecret); err != nil {
+		respondWithError(w, http.StatusForbidden, "Download link is invalid or expired", err)
+		return
+	}
+
+	exportID, err := uuid.Parse(r.PathValue("exportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid export ID", err)
+		return
+	}
+
+	archive, err := cfg.DbPtr.GetDataExportArchive(r.Context(), exportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Export not found or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve export", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, exportID))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// processDataExports builds queued exports. Each replica runs one; the claim
+// query's SKIP LOCKED keeps them from building the same export twice.
+func (cfg *apiConfig) processDataExports(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cfg.runPendingDataExports(ctx)
+			pruned, err := cfg.DbPtr.DeleteExpiredDataExports(ctx)
+			if err != nil {
+				log.Printf("Couldn't prune expired exports: %s", err)
+			} else if pruned > 0 {
+				log.Printf("Pruned %d expired exports", pruned)
+			}
+		}
+	}
+}
+
+// runPendingDataExports builds exports until the queue is empty
+func (cfg *apiConfig) runPendingDataExports(ctx context.Context) {
+	for {
+		job, err := cfg.DbPtr.ClaimDataExport(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		if err != nil {
+			log.Printf("Couldn't claim export: %s", err)
+			return
+		}
+
+		if err := cfg.completeDataExport(ctx, job.ID, job.UserID); err != nil {
+			log.Printf("Export %s failed: %s", job.ID, err)
+			err = cfg.DbPtr.FailDataExport(ctx, database.FailDataExportParams{
+				ID:        job.ID,
+				Error:     sql.NullString{String: err.Error(), Valid: true},
+				ExpiresAt: sql.NullTime{Time: time.Now().UTC().Add(dataExportTTL), Valid: true},
+			})
+			if err != nil {
+				log.Printf("Couldn't mark export %s failed: %s", job.ID, err)
+			}
+		}
+	}
+}
+
+func (cfg *apiConfig) completeDataExport(ctx context.Context, exportID, userID uuid.UUID) error {
+	userDb, err := cfg.DbPtr.GetUserById(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	archive, err := cfg.buildDataExportArchive(ctx, userDb)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().UTC().Add(dataExportTTL)
+	err = cfg.DbPtr.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ID:        exportID,
+		Archive:   archive,
+		ExpiresAt: sql.NullTime{Time: expiresAt, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = cfg.Mailer.Send(ctx, mailer.Message{
+		To:      userDb.Email,
+		Subject: "Your Chirpy data export is ready",
+		Body:    fmt.Sprintf("The archive of your Chirpy data you asked for is ready. Download it within %s:\n\n%s\n", dataExportLinkTTL, cfg.dataExportDownloadURL(exportID, expiresAt)),
+	})
+	if err != nil {
+		log.Printf("Couldn't send export ready email: %s", err)
+	}
+	return nil
+}
+
+type ExportedLike struct {
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportedBlock struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportedNotification struct {
+	ID        uuid.UUID  `json:"id"`
+	Kind      string     `json:"kind"`
+	ActorID   uuid.UUID  `json:"actor_id"`
+	ChirpID   *uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+type ExportedUpload struct {
+	Upload
+	// variant name -> key
+	MediaKeys map[string]string `json:"media_keys"`
+}
+
+/* The archive contains
+	profile.json       the account, as GET-style user JSON
+	chirps.json        every chirp the user has posted
+	chirps.csv         the same chirps as id,created_at,updated_at,body
+	sessions.json      every device the user has logged in on
+	audit_events.json  security events on the account
+	follows.json       who the user follows and who follows them, including
+	                   requests still waiting for approval
+	likes.json         the chirps the user has liked, and when
+	blocks.json        the users they've blocked, and when
+	uploads.json       every upload, as GET /api/uploads/{uploadID} returns
+	                   it, with the blob store key of each variant's file
+	notifications.json every notification the user has, ungrouped
+*/
+
+func (cfg *apiConfig) buildDataExportArchive(ctx context.Context, user database.User) ([]byte, error) {
+	chirpsDb, err := cfg.DbPtr.GetChirpsForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	chirps := []Chirp{}
+	for _, chirp := range chirpsDb {
+		chirps = append(chirps, newChirpResponse(chirp))
+	}
+	if err := cfg.embedChirpDetails(ctx, chirps, user.ID); err != nil {
+		return nil, err
+	}
+
+	sessionsDb, err := cfg.DbPtr.GetSessionsForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []Session{}
+	for _, session := range sessionsDb {
+		sessions = append(sessions, Session{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+		})
+	}
+
+	eventsDb, err := cfg.DbPtr.GetAuditEventsForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	events := []AuditEvent{}
+	for _, event := range eventsDb {
+		events = append(events, AuditEvent{
+			ID:        event.ID,
+			Event:     event.Event,
+			IPAddress: event.IpAddress,
+			UserAgent: event.UserAgent,
+			Metadata:  event.Metadata,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+
+	followsDb, err := cfg.DbPtr.GetFollowsForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	follows := []Follow{}
+	for _, follow := range followsDb {
+		follows = append(follows, newFollowResponse(follow))
+	}
+
+	likesDb, err := cfg.DbPtr.GetLikesForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	likes := []ExportedLike{}
+	for _, like := range likesDb {
+		likes = append(likes, ExportedLike{ChirpID: like.ChirpID, CreatedAt: like.CreatedAt})
+	}
+
+	blocksDb, err := cfg.DbPtr.GetBlocksForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	blocks := []ExportedBlock{}
+	for _, block := range blocksDb {
+		blocks = append(blocks, ExportedBlock{UserID: block.BlockedID, CreatedAt: block.CreatedAt})
+	}
+
+	uploadsDb, err := cfg.DbPtr.GetUploadsForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	uploadIDs := make([]uuid.UUID, 0, len(uploadsDb))
+	for _, upload := range uploadsDb {
+		uploadIDs = append(uploadIDs, upload.ID)
+	}
+	variantsDb, err := cfg.DbPtr.GetUploadVariantsForUploads(ctx, uploadIDs)
+	if err != nil {
+		return nil, err
+	}
+	variants := map[uuid.UUID][]database.UploadVariant{}
+	for _, variant := range variantsDb {
+		variants[variant.UploadID] = append(variants[variant.UploadID], variant)
+	}
+	uploads := []ExportedUpload{}
+	for _, upload := range uploadsDb {
+		exported := ExportedUpload{
+			Upload:    cfg.newUploadResponse(upload, variants[upload.ID]),
+			MediaKeys: map[string]string{},
+		}
+		for _, variant := range variants[upload.ID] {
+			exported.MediaKeys[variant.Name] = mediaKey(variant.Sha256)
+		}
+		uploads = append(uploads, exported)
+	}
+
+	notificationsDb, err := cfg.DbPtr.GetNotificationsForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	notifications := []ExportedNotification{}
+	for _, notification := range notificationsDb {
+		exported := ExportedNotification{
+			ID:        notification.ID,
+			Kind:      notification.Kind,
+			ActorID:   notification.ActorID,
+			ChirpID:   nullUUIDPtr(notification.ChirpID),
+			CreatedAt: notification.CreatedAt,
+		}
+		if notification.ReadAt.Valid {
+			exported.ReadAt = &notification.ReadAt.Time
+		}
+		notifications = append(notifications, exported)
+	}
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+
+	writeJSON := func(name string, v interface{}) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	if err := writeJSON("profile.json", newUserResponse(user)); err != nil {
+		return nil, err
+	}
+	if err := writeJSON("chirps.json", chirps); err != nil {
+		return nil, err
+	}
+	if err := writeJSON("sessions.json", sessions); err != nil {
+		return nil, err
+	}
+	if err := writeJSON("audit_events.json", events); err != nil {
+		return nil, err
+	}
+	if err := writeJSON("follows.json", follows); err != nil {
+		return nil, err
+	}
+	if err := writeJSON("likes.json", likes); err != nil {
+		return nil, err
+	}
+	if err := writeJSON("blocks.json", blocks); err != nil {
+		return nil, err
+	}
+	if err := writeJSON("uploads.json", uploads); err != nil {
+		return nil, err
+	}
+	if err := writeJSON("notifications.json", notifications); err != nil {
+		return nil, err
+	}
+
+	f, err := zw.Create("chirps.csv")
+	if err != nil {
+		return nil, err
+	}
+	cw := csv.NewWriter(f)
+	cw.Write([]string{"id", "created_at", "updated_at", "body"})
+	for _, chirp := range chirps {
+		cw.Write([]string{chirp.ID.String(), chirp.CreatedAt.Format(time.RFC3339), chirp.UpdatedAt.Format(time.RFC3339), chirp.Body})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
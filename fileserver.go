@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// newAppFileServer serves root under /app/, except for the hidden
+// directories, which 404 as if they weren't there. The local blob store keeps
+// raw uploads, metadata and all, under UPLOAD_DIR, which defaults to a
+// directory inside root.
+func newAppFileServer(root string, hidden ...string) http.Handler {
+	fsys := hiddenDirsFS{FileSystem: http.Dir(root)}
+	absRoot, err := filepath.Abs(root)
+	if err == nil {
+		for _, dir := range hidden {
+			absDir, err := filepath.Abs(dir)
+			if err != nil {
+				continue
+			}
+			rel, err := filepath.Rel(absRoot, absDir)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				// outside root, so never served anyway
+				continue
+			}
+			fsys.hidden = append(fsys.hidden, path.Clean("/"+filepath.ToSlash(rel)))
+		}
+	}
+	return http.StripPrefix("/app", http.FileServer(fsys))
+}
+
+type hiddenDirsFS struct {
+	http.FileSystem
+	// slash-separated paths relative to the root, starting with "/"
+	hidden []string
+}
+
+func (f hiddenDirsFS) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	for _, dir := range f.hidden {
+		if dir == "/" || name == dir || strings.HasPrefix(name, dir+"/") {
+			return nil, fs.ErrNotExist
+		}
+	}
+	return f.FileSystem.Open(name)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppFileServerHidesUploads(t *testing.T) {
+	root := t.TempDir()
+	uploadDir := filepath.Join(root, "uploads")
+	if err := os.MkdirAll(filepath.Join(uploadDir, "incoming"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range map[string]string{
+		filepath.Join(root, "index.html"):                  "<html></html>",
+		filepath.Join(uploadDir, "incoming", "raw-upload"): "EXIF",
+		filepath.Join(uploadDir, "media", "abc"):           "stripped",
+	} {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a relative UPLOAD_DIR like the default has to be caught too
+	t.Chdir(root)
+	handler := newAppFileServer(".", "./uploads")
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/app/", want: http.StatusOK},
+		{path: "/app/uploads/incoming/raw-upload", want: http.StatusNotFound},
+		{path: "/app/uploads/incoming/", want: http.StatusNotFound},
+		{path: "/app/uploads/", want: http.StatusNotFound},
+		{path: "/app/uploads/media/abc", want: http.StatusNotFound},
+		{path: "/app/./uploads/incoming/raw-upload", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+}
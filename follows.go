@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/handle"
+	"github.com/google/uuid"
+)
+
+const (
+	followAccepted = "accepted"
+	// follows of a private account wait for its approval
+	followPending = "pending"
+)
+
+/* Following someone returns the relationship. "status" is "pending" until a
+   private account approves the request
+	{
+		"follower_id": "50746277-23c6-4d85-a890-564c0044c2fb",
+		"followee_id": "5a47789c-a617-444a-8a80-b50359247804",
+		"status": "accepted",
+		"created_at": "2021-07-01T00:00:00Z"
+	}
+*/
+
+type Follow struct {
+	FollowerID uuid.UUID `json:"follower_id"`
+	FolloweeID uuid.UUID `json:"followee_id"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newFollowResponse(follow database.Follow) Follow {
+	return Follow{
+		FollowerID: follow.FollowerID,
+		FolloweeID: follow.FolloweeID,
+		Status:     follow.Status,
+		CreatedAt:  follow.CreatedAt,
+	}
+}
+
+/* Follower and following lists are pages (see Page in pagination.go) of
+	{
+		"id": "5a47789c-a617-444a-8a80-b50359247804",
+		"handle": "lane",
+		...
+		"followed_at": "2021-07-01T00:00:00Z"
+	}
+*/
+
+type FollowListUser struct {
+	PublicUser
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// both list queries return the same columns
+func newFollowListUser(row database.GetFollowersRow) FollowListUser {
+	return FollowListUser{
+		PublicUser: PublicUser{
+			ID:          row.ID,
+			Handle:      row.Handle,
+			DisplayName: row.DisplayName,
+			Bio:         row.Bio,
+			AvatarURL:   row.AvatarUrl,
+			IsPrivate:   row.IsPrivate,
+			CreatedAt:   row.CreatedAt,
+		},
+		FollowedAt: row.FollowedAt,
+	}
+}
+
+func followListCursor(user FollowListUser) pageCursor {
+	return pageCursor{Time: user.FollowedAt, ID: user.ID}
+}
+
+// lookupUser finds a user by the {id} path value, which can be either their ID
+// or their handle. Accounts waiting to be deleted aren't found.
+func (cfg *apiConfig) lookupUser(ctx context.Context, idOrHandle string) (database.User, error) {
+	id, err := uuid.Parse(idOrHandle)
+	if err != nil {
+		return cfg.DbPtr.GetUserByHandle(ctx, handle.Normalize(idOrHandle))
+	}
+	userDb, err := cfg.DbPtr.GetUserById(ctx, id)
+	if err == nil && userDb.DeleteAfter.Valid {
+		return database.User{}, sql.ErrNoRows
+	}
+	return userDb, err
+}
+
+// canSeeAccount reports whether viewer may see who user follows, is followed
+// by and has liked. Private accounts only show that to their accepted followers.
+func (cfg *apiConfig) canSeeAccount(ctx context.Context, viewerID uuid.UUID, user database.User) (bool, error) {
+	if !user.IsPrivate || viewerID == user.ID {
+		return true, nil
+	}
+	if viewerID == uuid.Nil {
+		return false, nil
+	}
+	follow, err := cfg.DbPtr.GetFollow(ctx, database.GetFollowParams{
+		FollowerID: viewerID,
+		FolloweeID: user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return follow.Status == followAccepted, nil
+}
+
+// follow a user, or ask to if their account is private. Returns 201 Created,
+// or 200 OK if the caller already follows (or asked to follow) them
+func (cfg *apiConfig) handlerFollow(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	userDb, err := cfg.lookupUser(r.Context(), r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+	if userDb.ID == claims.UserID {
+		respondWithError(w, http.StatusBadRequest, "You can't follow yourself", fmt.Errorf("user %s tried to follow themselves", claims.UserID))
+		return
+	}
+	blocked, err := cfg.DbPtr.IsBlocked(r.Context(), database.IsBlockedParams{
+		BlockerID: userDb.ID,
+		BlockedID: claims.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't follow user", err)
+		return
+	}
+	if blocked {
+		respondWithError(w, http.StatusForbidden, "You can't follow this user", fmt.Errorf("user %s has blocked %s", userDb.ID, claims.UserID))
+		return
+	}
+
+	params := database.CreateFollowParams{
+		FollowerID: claims.UserID,
+		FolloweeID: userDb.ID,
+		Status:     followAccepted,
+		AcceptedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	}
+	if userDb.IsPrivate {
+		params.Status = followPending
+		params.AcceptedAt = sql.NullTime{}
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't follow user", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	followDb, err := qtx.CreateFollow(r.Context(), params)
+	if errors.Is(err, sql.ErrNoRows) {
+		// ON CONFLICT DO NOTHING: the follow already exists
+		followDb, err = qtx.GetFollow(r.Context(), database.GetFollowParams{
+			FollowerID: claims.UserID,
+			FolloweeID: userDb.ID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve follow", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, newFollowResponse(followDb))
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't follow user", err)
+		return
+	}
+
+	if followDb.Status == followAccepted {
+		if err := cfg.timelineFollowed(r.Context(), qtx, claims.UserID, userDb.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update timeline", err)
+			return
+		}
+		if err := cfg.notify(r.Context(), qtx, userDb.ID, notificationFollow, claims.UserID, uuid.NullUUID{}); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't follow user", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't follow user", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, newFollowResponse(followDb))
+}
+
+// unfollow a user, or withdraw a follow request. Returns 204 No Content
+func (cfg *apiConfig) handlerUnfollow(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	userDb, err := cfg.lookupUser(r.Context(), r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unfollow user", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	err = qtx.DeleteFollow(r.Context(), database.DeleteFollowParams{
+		FollowerID: claims.UserID,
+		FolloweeID: userDb.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unfollow user", err)
+		return
+	}
+	if err := cfg.timelineUnfollowed(r.Context(), qtx, claims.UserID, userDb.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update timeline", err)
+		return
+	}
+	if err := cfg.unnotify(r.Context(), qtx, uuid.NullUUID{UUID: userDb.ID, Valid: true}, notificationFollow, claims.UserID, uuid.NullUUID{}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unfollow user", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unfollow user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// list who follows a user, newest first
+func (cfg *apiConfig) handlerGetFollowers(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithFollowList(w, r, func(ctx context.Context, params database.GetFollowersParams) ([]database.GetFollowersRow, error) {
+		return cfg.DbPtr.GetFollowers(ctx, params)
+	})
+}
+
+// list who a user follows, newest first
+func (cfg *apiConfig) handlerGetFollowing(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithFollowList(w, r, func(ctx context.Context, params database.GetFollowersParams) ([]database.GetFollowersRow, error) {
+		rows, err := cfg.DbPtr.GetFollowing(ctx, database.GetFollowingParams(params))
+		followers := make([]database.GetFollowersRow, 0, len(rows))
+		for _, row := range rows {
+			followers = append(followers, database.GetFollowersRow(row))
+		}
+		return followers, err
+	})
+}
+
+func (cfg *apiConfig) respondWithFollowList(w http.ResponseWriter, r *http.Request, list func(context.Context, database.GetFollowersParams) ([]database.GetFollowersRow, error)) {
+	claims := claimsFromContext(r.Context())
+
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	userDb, err := cfg.lookupUser(r.Context(), r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+
+	allowed, err := cfg.canSeeAccount(r.Context(), claims.UserID, userDb)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve follow status", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "This account is private", fmt.Errorf("user %s can't see follows of private user %s", claims.UserID, userDb.ID))
+		return
+	}
+
+	rows, err := list(r.Context(), database.GetFollowersParams{
+		UserID:     userDb.ID,
+		Status:     followAccepted,
+		CursorTime: cursor.Time,
+		CursorID:   cursor.ID,
+		PageSize:   limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve follows", err)
+		return
+	}
+
+	users := make([]FollowListUser, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, newFollowListUser(row))
+	}
+
+	respondWithJSON(w, http.StatusOK, newPage(users, limit, followListCursor))
+}
+
+// list the requests waiting for the caller's approval, newest first
+func (cfg *apiConfig) handlerGetFollowRequests(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	rows, err := cfg.DbPtr.GetFollowers(r.Context(), database.GetFollowersParams{
+		UserID:     claims.UserID,
+		Status:     followPending,
+		CursorTime: cursor.Time,
+		CursorID:   cursor.ID,
+		PageSize:   limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve follow requests", err)
+		return
+	}
+
+	users := make([]FollowListUser, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, newFollowListUser(row))
+	}
+
+	respondWithJSON(w, http.StatusOK, newPage(users, limit, followListCursor))
+}
+
+// approve a pending follow request from {id}. Returns 204 No Content
+func (cfg *apiConfig) handlerApproveFollowRequest(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	userDb, err := cfg.lookupUser(r.Context(), r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't approve follow request", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	approved, err := qtx.AcceptFollowRequest(r.Context(), database.AcceptFollowRequestParams{
+		FollowerID: userDb.ID,
+		FolloweeID: claims.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't approve follow request", err)
+		return
+	}
+	if approved == 0 {
+		respondWithError(w, http.StatusNotFound, "Follow request not found", fmt.Errorf("no pending follow from %s to %s", userDb.ID, claims.UserID))
+		return
+	}
+	if err := cfg.timelineFollowed(r.Context(), qtx, userDb.ID, claims.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update timeline", err)
+		return
+	}
+	// the follow only starts now, so this is when its notification comes
+	if err := cfg.notify(r.Context(), qtx, claims.UserID, notificationFollow, userDb.ID, uuid.NullUUID{}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't approve follow request", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't approve follow request", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// turn down a pending follow request from {id}. Returns 204 No Content
+func (cfg *apiConfig) handlerRejectFollowRequest(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	userDb, err := cfg.lookupUser(r.Context(), r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+
+	rejected, err := cfg.DbPtr.RejectFollowRequest(r.Context(), database.RejectFollowRequestParams{
+		FollowerID: userDb.ID,
+		FolloweeID: claims.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reject follow request", err)
+		return
+	}
+	if rejected == 0 {
+		respondWithError(w, http.StatusNotFound, "Follow request not found", fmt.Errorf("no pending follow from %s to %s", userDb.ID, claims.UserID))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
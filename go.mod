@@ -11,3 +11,5 @@ require (
 require golang.org/x/crypto v0.37.0
 
 require github.com/golang-jwt/jwt/v5 v5.2.2
+
+require golang.org/x/text v0.24.0
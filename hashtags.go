@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+/* Chirps list the hashtags in their body as "hashtags", so clients can link them
+	"hashtags": [
+		{
+			"tag": "strasse",
+			"start": 6,
+			"end": 13
+		}
+	]
+   "start" and "end" count Unicode code points (not bytes) into "body", with
+   "end" exclusive, and cover the whole "#Straße". "tag" is the normalised
+   form without the #, which is what GET /api/tags/{tag}/chirps takes.
+
+   A hashtag is a # followed by letters, digits, combining marks or
+   underscores, with at least one letter, that isn't stuck to the end of a
+   word. Tags are case-folded (so #Straße and #STRASSE are the same tag) and
+   NFC-normalised.
+*/
+
+type Hashtag struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+const tagIndexBatchSize = 500
+
+func isTagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// normalizeTag case-folds a tag. A Caser keeps state, so each call gets its own.
+func normalizeTag(tag string) string {
+	return norm.NFC.String(cases.Fold().String(tag))
+}
+
+// parseHashtags finds the hashtags in a chirp body, in order
+func parseHashtags(body string) []Hashtag {
+	hashtags := []Hashtag{}
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' || (i > 0 && isTagRune(runes[i-1])) {
+			continue
+		}
+		end := i + 1
+		hasLetter := false
+		for end < len(runes) && isTagRune(runes[end]) {
+			hasLetter = hasLetter || unicode.IsLetter(runes[end])
+			end++
+		}
+		if hasLetter {
+			hashtags = append(hashtags, Hashtag{
+				Tag:   normalizeTag(string(runes[i+1 : end])),
+				Start: i,
+				End:   end,
+			})
+		}
+		i = end - 1
+	}
+	return hashtags
+}
+
+// chirpTags is the distinct tags in a chirp body, as stored in chirp_tags
+func chirpTags(body string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, hashtag := range parseHashtags(body) {
+		if !seen[hashtag.Tag] {
+			seen[hashtag.Tag] = true
+			tags = append(tags, hashtag.Tag)
+		}
+	}
+	return tags
+}
+
+// parseTag normalizes a single tag given with or without its #, in any case
+func parseTag(s string) (string, error) {
+	raw := "#" + strings.TrimPrefix(s, "#")
+	hashtags := parseHashtags(raw)
+	if len(hashtags) != 1 || hashtags[0].End != utf8.RuneCountInString(raw) {
+		return "", fmt.Errorf("%q isn't a hashtag", raw)
+	}
+	return hashtags[0].Tag, nil
+}
+
+// list the chirps with a hashtag, newest first, a page at a time
+func (cfg *apiConfig) handlerGetTagChirps(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	tag, err := parseTag(r.PathValue("tag"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid hashtag", err)
+		return
+	}
+
+	chirpsDb, err := cfg.DbPtr.GetTagChirps(r.Context(), database.GetTagChirpsParams{
+		Tag:        tag,
+		ViewerID:   claims.UserID,
+		CursorTime: cursor.Time,
+		CursorID:   cursor.ID,
+		PageSize:   limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps", err)
+		return
+	}
+
+	chirps := make([]Chirp, 0, len(chirpsDb))
+	for _, chirp := range chirpsDb {
+		chirps = append(chirps, newChirpResponse(chirp))
+	}
+	page := newPage(chirps, limit, chirpCursor)
+
+	if err := cfg.embedChirpDetails(r.Context(), page.Items, claims.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp details", err)
+		return
+	}
+	if wantsAuthor(r) {
+		if err := cfg.embedAuthors(r.Context(), page.Items); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp authors", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+// runIndexTags implements `chirpy index-tags`, which fills chirp_tags in for
+// chirps posted before hashtags were indexed. It's safe to run again.
+func runIndexTags(dbQueries *database.Queries) error {
+	ctx := context.Background()
+
+	after := uuid.Nil
+	indexed := 0
+	for {
+		rows, err := dbQueries.GetChirpsToTag(ctx, database.GetChirpsToTagParams{
+			ID:    after,
+			Limit: tagIndexBatchSize,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't retrieve chirps: %w", err)
+		}
+		for _, row := range rows {
+			tags := chirpTags(row.Body)
+			if len(tags) == 0 {
+				continue
+			}
+			err := dbQueries.CreateChirpTags(ctx, database.CreateChirpTagsParams{
+				ChirpID:   row.ID,
+				CreatedAt: row.CreatedAt,
+				Tags:      tags,
+			})
+			if err != nil {
+				return fmt.Errorf("couldn't tag chirp %s: %w", row.ID, err)
+			}
+			indexed++
+		}
+		if len(rows) < tagIndexBatchSize {
+			break
+		}
+		after = rows[len(rows)-1].ID
+	}
+
+	fmt.Printf("Indexed hashtags on %d chirps\n", indexed)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHashtags(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Hashtag
+	}{
+		{
+			name: "None",
+			body: "Hello, world!",
+			want: []Hashtag{},
+		},
+		{
+			name: "Several",
+			body: "#go is fun #GoLang",
+			want: []Hashtag{
+				{Tag: "go", Start: 0, End: 3},
+				{Tag: "golang", Start: 11, End: 18},
+			},
+		},
+		{
+			name: "Offsets count code points",
+			body: "Grüße aus der #Straße!",
+			want: []Hashtag{
+				{Tag: "strasse", Start: 14, End: 21},
+			},
+		},
+		{
+			name: "Case folding",
+			body: "#ΣΊΣΥΦΟΣ",
+			want: []Hashtag{
+				{Tag: "σίσυφοσ", Start: 0, End: 8},
+			},
+		},
+		{
+			name: "Decomposed accents",
+			body: "#cafe\u0301",
+			want: []Hashtag{
+				{Tag: "caf\u00e9", Start: 0, End: 6},
+			},
+		},
+		{
+			name: "Underscores and digits",
+			body: "#web_3 ok",
+			want: []Hashtag{
+				{Tag: "web_3", Start: 0, End: 6},
+			},
+		},
+		{
+			name: "Digits only",
+			body: "#1 fan",
+			want: []Hashtag{},
+		},
+		{
+			name: "Inside a word",
+			body: "issue#42 and C#sharp",
+			want: []Hashtag{},
+		},
+		{
+			name: "Bare hash",
+			body: "# heading ##",
+			want: []Hashtag{},
+		},
+		{
+			name: "After punctuation",
+			body: "(#go)",
+			want: []Hashtag{
+				{Tag: "go", Start: 1, End: 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseHashtags(tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHashtags(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChirpTagsAreDistinct(t *testing.T) {
+	got := chirpTags("#Go #go #GO #rust")
+	want := []string{"go", "rust"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chirpTags() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// API keys look like chirpy_<prefix>_<secret>. The prefix is stored in the
+// clear so the key can be found (and recognised in logs); only a hash of the
+// secret is kept.
+const apiKeyTag = "chirpy"
+
+// MakeAPIKey returns the full key to hand to the user once, plus the parts to store
+func MakeAPIKey() (key, prefix, secret string, err error) {
+	prefixBytes := make([]byte, 6)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(prefixBytes)
+
+	secret, err = makeRandomToken()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return fmt.Sprintf("%s_%s_%s", apiKeyTag, prefix, secret), prefix, secret, nil
+}
+
+// ParseAPIKey splits a key into its prefix and secret
+func ParseAPIKey(key string) (prefix, secret string, err error) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != apiKeyTag || parts[1] == "" || parts[2] == "" {
+		return "", "", fmt.Errorf("malformed API key")
+	}
+	return parts[1], parts[2], nil
+}
+
+// CheckAPIKeySecret compares a presented secret against the stored hash
+func CheckAPIKeySecret(hashedSecret, secret string) error {
+	if subtle.ConstantTimeCompare([]byte(hashedSecret), []byte(HashToken(secret))) != 1 {
+		return fmt.Errorf("API key secret doesn't match")
+	}
+	return nil
+}
+
+// GetAPIKey reads "Authorization: ApiKey <key>"
+func GetAPIKey(headers http.Header) (string, error) {
+	authHeader := headers.Get("Authorization")
+	if authHeader == "" {
+		return "", fmt.Errorf("no authorization header present")
+	}
+
+	fields := strings.Fields(authHeader)
+	if len(fields) != 2 || fields[0] != "ApiKey" {
+		return "", fmt.Errorf("authorization header must follow convention: 'ApiKey <key>'")
+	}
+
+	return fields[1], nil
+}
@@ -1,21 +1,61 @@
 package auth
 
 import (
+	"context"
 	"testing"
 	"time"
 	"net/http"
+	"net/url"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	validToken, _ := MakeJWT(userID, HMACKey("secret"), time.Hour, TokenOptions{})
+	scopedToken, _ := MakeJWT(userID, HMACKey("secret"), time.Hour, TokenOptions{
+		Audience: []string{"chirpy-api"},
+		Scopes:   []string{ScopeChirpsRead, ScopeChirpsWrite},
+	})
+	expiredToken, _ := MakeJWT(userID, HMACKey("secret"), -time.Minute, TokenOptions{})
+	justExpiredToken, _ := MakeJWT(userID, HMACKey("secret"), -5*time.Second, TokenOptions{})
+	notYetValidToken, _ := MakeJWT(userID, HMACKey("secret"), time.Hour, TokenOptions{NotBefore: time.Now().Add(time.Hour)})
+	otherAudienceToken, _ := MakeJWT(userID, HMACKey("secret"), time.Hour, TokenOptions{Audience: []string{"someone-else"}})
+	emailToken, _ := MakeEmailVerificationToken(userID, "user@example.com", "secret", time.Hour)
+	noJTIToken := signTestClaims(t, jwt.SigningMethodHS256, accessClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		Subject:   userID.String(),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}})
+	noExpiryToken := signTestClaims(t, jwt.SigningMethodHS256, accessClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:   string(TokenTypeAccess),
+		Subject:  userID.String(),
+		IssuedAt: jwt.NewNumericDate(time.Now()),
+		ID:       uuid.NewString(),
+	}})
+	badSubjectToken := signTestClaims(t, jwt.SigningMethodHS256, accessClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		Subject:   "not-a-uuid",
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		ID:        uuid.NewString(),
+	}})
+	hs512Token := signTestClaims(t, jwt.SigningMethodHS512, accessClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		Subject:   userID.String(),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		ID:        uuid.NewString(),
+	}})
 
 	tests := []struct {
 		name        string
 		tokenString string
 		tokenSecret string
+		opts        ValidationOptions
 		wantUserID  uuid.UUID
+		wantScopes  []string
 		wantErr     bool
 	}{
 		{
@@ -25,6 +65,15 @@ func TestValidateJWT(t *testing.T) {
 			wantUserID:  userID,
 			wantErr:     false,
 		},
+		{
+			name:        "Valid token with audience and scopes",
+			tokenString: scopedToken,
+			tokenSecret: "secret",
+			opts:        ValidationOptions{Audience: "chirpy-api"},
+			wantUserID:  userID,
+			wantScopes:  []string{ScopeChirpsRead, ScopeChirpsWrite},
+			wantErr:     false,
+		},
 		{
 			name:        "Invalid token",
 			tokenString: "invalid.token.string",
@@ -39,22 +88,111 @@ func TestValidateJWT(t *testing.T) {
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
+		{
+			name:        "Expired token",
+			tokenString: expiredToken,
+			tokenSecret: "secret",
+			wantErr:     true,
+		},
+		{
+			name:        "Expired token within leeway",
+			tokenString: justExpiredToken,
+			tokenSecret: "secret",
+			opts:        ValidationOptions{Leeway: 30 * time.Second},
+			wantUserID:  userID,
+			wantErr:     false,
+		},
+		{
+			name:        "Expired token beyond leeway",
+			tokenString: expiredToken,
+			tokenSecret: "secret",
+			opts:        ValidationOptions{Leeway: 30 * time.Second},
+			wantErr:     true,
+		},
+		{
+			name:        "Not yet valid",
+			tokenString: notYetValidToken,
+			tokenSecret: "secret",
+			opts:        ValidationOptions{Leeway: 30 * time.Second},
+			wantErr:     true,
+		},
+		{
+			name:        "Missing audience",
+			tokenString: validToken,
+			tokenSecret: "secret",
+			opts:        ValidationOptions{Audience: "chirpy-api"},
+			wantErr:     true,
+		},
+		{
+			name:        "Wrong audience",
+			tokenString: otherAudienceToken,
+			tokenSecret: "secret",
+			opts:        ValidationOptions{Audience: "chirpy-api"},
+			wantErr:     true,
+		},
+		{
+			name:        "Wrong issuer",
+			tokenString: emailToken,
+			tokenSecret: "secret",
+			wantErr:     true,
+		},
+		{
+			name:        "Missing jti",
+			tokenString: noJTIToken,
+			tokenSecret: "secret",
+			wantErr:     true,
+		},
+		{
+			name:        "Missing expiry",
+			tokenString: noExpiryToken,
+			tokenSecret: "secret",
+			wantErr:     true,
+		},
+		{
+			name:        "Subject isn't a user ID",
+			tokenString: badSubjectToken,
+			tokenSecret: "secret",
+			wantErr:     true,
+		},
+		{
+			name:        "Unexpected algorithm",
+			tokenString: hs512Token,
+			tokenSecret: "secret",
+			wantErr:     true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			gotClaims, err := ValidateJWT(tt.tokenString, HMACKey(tt.tokenSecret), tt.opts)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if gotUserID != tt.wantUserID {
-				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, tt.wantUserID)
+			if gotClaims.UserID != tt.wantUserID {
+				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotClaims.UserID, tt.wantUserID)
+			}
+			if !tt.wantErr && gotClaims.TokenID == "" {
+				t.Errorf("ValidateJWT() returned claims without a token ID")
+			}
+			for _, scope := range tt.wantScopes {
+				if !gotClaims.HasScope(scope) {
+					t.Errorf("ValidateJWT() claims missing scope %q, got %v", scope, gotClaims.Scopes)
+				}
 			}
 		})
 	}
 }
 
+func signTestClaims(t *testing.T, method jwt.SigningMethod, claims jwt.Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("couldn't sign test token: %v", err)
+	}
+	return token
+}
+
 func TestGetBearerToken(t *testing.T) {
 	tests := []struct{
 		name string
@@ -97,4 +235,267 @@ func TestGetBearerToken(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestValidateEmailVerificationToken(t *testing.T) {
+	userID := uuid.New()
+	validToken, _ := MakeEmailVerificationToken(userID, "user@example.com", "secret", time.Hour)
+	expiredToken, _ := MakeEmailVerificationToken(userID, "user@example.com", "secret", -time.Minute)
+	accessToken, _ := MakeJWT(userID, HMACKey("secret"), time.Hour, TokenOptions{})
+
+	tests := []struct {
+		name        string
+		tokenString string
+		tokenSecret string
+		wantUserID  uuid.UUID
+		wantEmail   string
+		wantErr     bool
+	}{
+		{
+			name:        "Valid token",
+			tokenString: validToken,
+			tokenSecret: "secret",
+			wantUserID:  userID,
+			wantEmail:   "user@example.com",
+			wantErr:     false,
+		},
+		{
+			name:        "Wrong secret",
+			tokenString: validToken,
+			tokenSecret: "wrong_secret",
+			wantErr:     true,
+		},
+		{
+			name:        "Expired token",
+			tokenString: expiredToken,
+			tokenSecret: "secret",
+			wantErr:     true,
+		},
+		{
+			name:        "Access token used for verification",
+			tokenString: accessToken,
+			tokenSecret: "secret",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUserID, gotEmail, err := ValidateEmailVerificationToken(tt.tokenString, tt.tokenSecret)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEmailVerificationToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotUserID != tt.wantUserID || gotEmail != tt.wantEmail {
+				t.Errorf("ValidateEmailVerificationToken() = %v, %q, want %v, %q", gotUserID, gotEmail, tt.wantUserID, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestValidateMagicLinkToken(t *testing.T) {
+	userID := uuid.New()
+	validToken, validID, _ := MakeMagicLinkToken(userID, "user@example.com", "secret", time.Hour)
+	expiredToken, _, _ := MakeMagicLinkToken(userID, "user@example.com", "secret", -time.Minute)
+	verificationToken, _ := MakeEmailVerificationToken(userID, "user@example.com", "secret", time.Hour)
+
+	tests := []struct {
+		name        string
+		tokenString string
+		tokenSecret string
+		wantUserID  uuid.UUID
+		wantEmail   string
+		wantID      string
+		wantErr     bool
+	}{
+		{
+			name:        "Valid token",
+			tokenString: validToken,
+			tokenSecret: "secret",
+			wantUserID:  userID,
+			wantEmail:   "user@example.com",
+			wantID:      validID,
+			wantErr:     false,
+		},
+		{
+			name:        "Wrong secret",
+			tokenString: validToken,
+			tokenSecret: "wrong_secret",
+			wantErr:     true,
+		},
+		{
+			name:        "Expired token",
+			tokenString: expiredToken,
+			tokenSecret: "secret",
+			wantErr:     true,
+		},
+		{
+			name:        "Verification token used to log in",
+			tokenString: verificationToken,
+			tokenSecret: "secret",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUserID, gotEmail, gotID, err := ValidateMagicLinkToken(tt.tokenString, tt.tokenSecret)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateMagicLinkToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotUserID != tt.wantUserID || gotEmail != tt.wantEmail || gotID != tt.wantID {
+				t.Errorf("ValidateMagicLinkToken() = %v, %q, %q, want %v, %q, %q", gotUserID, gotEmail, gotID, tt.wantUserID, tt.wantEmail, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			first, err := GenerateSigningKey(alg)
+			if err != nil {
+				t.Fatalf("GenerateSigningKey() error = %v", err)
+			}
+			stored := []SigningKey{first}
+			keyring, err := NewKeyring(context.Background(), func(ctx context.Context) ([]SigningKey, error) {
+				return stored, nil
+			})
+			if err != nil {
+				t.Fatalf("NewKeyring() error = %v", err)
+			}
+
+			userID := uuid.New()
+			oldToken, err := MakeJWT(userID, keyring, time.Hour, TokenOptions{})
+			if err != nil {
+				t.Fatalf("MakeJWT() error = %v", err)
+			}
+
+			// rotate: the first key is retired, a second one takes over
+			second, _ := GenerateSigningKey(alg)
+			second.CreatedAt = first.CreatedAt.Add(time.Second)
+			first.RetiredAt = time.Now()
+			stored = []SigningKey{first, second}
+			if err := keyring.Reload(context.Background()); err != nil {
+				t.Fatalf("Reload() error = %v", err)
+			}
+
+			newToken, _ := MakeJWT(userID, keyring, time.Hour, TokenOptions{})
+			for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+				if got, err := ValidateJWT(token, keyring, ValidationOptions{}); err != nil || got.UserID != userID {
+					t.Errorf("ValidateJWT(%s token) = %v, %v, want %v", name, got, err, userID)
+				}
+			}
+			if got := len(keyring.PublicKeys()); got != 2 {
+				t.Errorf("PublicKeys() returned %d keys, want 2", got)
+			}
+
+			// once the retired key is pruned its tokens stop validating
+			stored = []SigningKey{second}
+			keyring.Reload(context.Background())
+			if _, err := ValidateJWT(oldToken, keyring, ValidationOptions{}); err == nil {
+				t.Errorf("ValidateJWT() accepted a token signed by a pruned key")
+			}
+
+			// a shared-secret token must not get through the keyring
+			hmacToken, _ := MakeJWT(userID, HMACKey("secret"), time.Hour, TokenOptions{})
+			if _, err := ValidateJWT(hmacToken, keyring, ValidationOptions{}); err == nil {
+				t.Errorf("ValidateJWT() accepted an HS256 token")
+			}
+		})
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	key, prefix, secret, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("MakeAPIKey() error = %v", err)
+	}
+
+	gotKey, err := GetAPIKey(http.Header{"Authorization": []string{"ApiKey " + key}})
+	if err != nil || gotKey != key {
+		t.Fatalf("GetAPIKey() = %q, %v, want %q", gotKey, err, key)
+	}
+	if _, err := GetAPIKey(http.Header{"Authorization": []string{"Bearer " + key}}); err == nil {
+		t.Errorf("GetAPIKey() accepted a Bearer header")
+	}
+
+	gotPrefix, gotSecret, err := ParseAPIKey(gotKey)
+	if err != nil || gotPrefix != prefix || gotSecret != secret {
+		t.Fatalf("ParseAPIKey() = %q, %q, %v, want %q, %q", gotPrefix, gotSecret, err, prefix, secret)
+	}
+	for _, malformed := range []string{"", "chirpy_abc", "other_abc_def", "chirpy__def", "chirpy_abc_def_ghi"} {
+		if _, _, err := ParseAPIKey(malformed); err == nil {
+			t.Errorf("ParseAPIKey(%q) should have failed", malformed)
+		}
+	}
+
+	if err := CheckAPIKeySecret(HashToken(secret), secret); err != nil {
+		t.Errorf("CheckAPIKeySecret() error = %v", err)
+	}
+	if err := CheckAPIKeySecret(HashToken(secret), "wrong"); err == nil {
+		t.Errorf("CheckAPIKeySecret() accepted the wrong secret")
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	// example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		method    string
+		wantErr   bool
+	}{
+		{name: "Valid verifier", verifier: verifier, challenge: challenge, method: PKCEMethodS256, wantErr: false},
+		{name: "Wrong verifier", verifier: verifier[:42] + "Y", challenge: challenge, method: PKCEMethodS256, wantErr: true},
+		{name: "Plain method", verifier: verifier, challenge: verifier, method: "plain", wantErr: true},
+		{name: "Verifier too short", verifier: "abc", challenge: MakePKCEChallenge("abc"), method: PKCEMethodS256, wantErr: true},
+		{name: "Invalid character", verifier: verifier[:42] + "!", challenge: MakePKCEChallenge(verifier[:42] + "!"), method: PKCEMethodS256, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyPKCE(tt.verifier, tt.challenge, tt.method)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyPKCE() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifySignedURL(t *testing.T) {
+	path := "/api/users/export/6a8a1c1e-8c5e-4c86-a0a3-3b8ad53a0c4b"
+	valid, _ := url.ParseQuery(SignURL(path, time.Now().Add(time.Hour), "secret"))
+	expired, _ := url.ParseQuery(SignURL(path, time.Now().Add(-time.Minute), "secret"))
+	tampered, _ := url.ParseQuery(SignURL(path, time.Now().Add(time.Hour), "secret"))
+	tampered.Set("expires", "9999999999")
+
+	tests := []struct {
+		name    string
+		path    string
+		query   url.Values
+		secret  string
+		wantErr bool
+	}{
+		{name: "Valid signature", path: path, query: valid, secret: "secret", wantErr: false},
+		{name: "Wrong secret", path: path, query: valid, secret: "wrong_secret", wantErr: true},
+		{name: "Different path", path: path + "0", query: valid, secret: "secret", wantErr: true},
+		{name: "Expired", path: path, query: expired, secret: "secret", wantErr: true},
+		{name: "Extended expiry", path: path, query: tampered, secret: "secret", wantErr: true},
+		{name: "No signature", path: path, query: url.Values{}, secret: "secret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignedURL(tt.path, tt.query, tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifySignedURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	TokenTypeEmailVerification TokenType = "chirpy-email-verification"
+	TokenTypeMagicLink         TokenType = "chirpy-magic-link"
+)
+
+// emailClaims binds a token to the address it was mailed to, so changing the
+// email on an account invalidates any links still sitting in the old inbox
+type emailClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+func makeEmailToken(tokenType TokenType, userID uuid.UUID, email, tokenID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	claims := emailClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(tokenType),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+			ID:        tokenID,
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(tokenSecret))
+}
+
+func validateEmailToken(tokenType TokenType, tokenString, tokenSecret string) (emailClaims, error) {
+	claims := emailClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&claims,
+		func(token *jwt.Token) (interface{}, error) {
+			return []byte(tokenSecret), nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(string(tokenType)),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return emailClaims{}, err
+	}
+	if claims.Email == "" {
+		return emailClaims{}, fmt.Errorf("token is missing an email")
+	}
+	return claims, nil
+}
+
+// MakeEmailVerificationToken signs a short-lived token proving control of email
+func MakeEmailVerificationToken(userID uuid.UUID, email, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeEmailToken(TokenTypeEmailVerification, userID, email, uuid.NewString(), tokenSecret, expiresIn)
+}
+
+// ValidateEmailVerificationToken returns the user ID and email the token was issued for
+func ValidateEmailVerificationToken(tokenString, tokenSecret string) (uuid.UUID, string, error) {
+	claims, err := validateEmailToken(TokenTypeEmailVerification, tokenString, tokenSecret)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	return id, claims.Email, nil
+}
+
+// MakeMagicLinkToken signs a login link for email. The returned token ID is
+// what the server records so each link can only be used once.
+func MakeMagicLinkToken(userID uuid.UUID, email, tokenSecret string, expiresIn time.Duration) (token, tokenID string, err error) {
+	tokenID = uuid.NewString()
+	token, err = makeEmailToken(TokenTypeMagicLink, userID, email, tokenID, tokenSecret, expiresIn)
+	return token, tokenID, err
+}
+
+// ValidateMagicLinkToken returns the user ID, email and token ID a login link was issued for
+func ValidateMagicLinkToken(tokenString, tokenSecret string) (uuid.UUID, string, string, error) {
+	claims, err := validateEmailToken(TokenTypeMagicLink, tokenString, tokenSecret)
+	if err != nil {
+		return uuid.Nil, "", "", err
+	}
+	if claims.ID == "" {
+		return uuid.Nil, "", "", fmt.Errorf("token is missing an ID")
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", "", fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	return id, claims.Email, claims.ID, nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 	"strings"
 	"log"
+	"slices"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
@@ -16,54 +17,143 @@ const (
 	TokenTypeAccess TokenType = "chirpy-access"
 )
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	issue_time := jwt.NewNumericDate(time.Now().UTC())
-	expire_time := jwt.NewNumericDate(time.Now().UTC().Add(expiresIn))
-	claims := jwt.RegisteredClaims{
-		Issuer: string(TokenTypeAccess),
-		IssuedAt: issue_time,
-		ExpiresAt: expire_time,
-		Subject: userID.String(),
+// Claims is what a validated access token (or API key) says about its bearer
+type Claims struct {
+	UserID   uuid.UUID
+	TokenID  string
+	Audience []string
+	Scopes   []string
+	// Generation must match the user's current token generation; bumping it
+	// logs the user out everywhere
+	Generation int32
+	// SessionID is the login session the token was minted for, if any
+	SessionID string
+	// ClientID is the OAuth client the token was issued to, if any
+	ClientID string
+	// APIKeyID is set instead of TokenID when the caller used an API key
+	APIKeyID  uuid.UUID
+	IssuedAt  time.Time
+	NotBefore time.Time
+	ExpiresAt time.Time
+}
+
+func (c Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// accessClaims is the wire format. Scopes travel as a single space separated
+// "scope" claim, the same way OAuth 2.0 spells them.
+type accessClaims struct {
+	Scope      string `json:"scope,omitempty"`
+	Generation int32  `json:"gen"`
+	SessionID  string `json:"sid,omitempty"`
+	ClientID   string `json:"client_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenOptions are the optional parts of an access token
+type TokenOptions struct {
+	Audience   []string
+	Scopes     []string
+	Generation int32
+	SessionID  string
+	ClientID   string
+	// NotBefore defaults to the issue time
+	NotBefore time.Time
+}
+
+// ValidationOptions tune what ValidateJWT will accept
+type ValidationOptions struct {
+	// Audience, when set, must appear in the token's aud claim
+	Audience string
+	// Leeway is how much clock skew to tolerate on exp, nbf and iat
+	Leeway time.Duration
+}
+
+func MakeJWT(userID uuid.UUID, keys KeySet, expiresIn time.Duration, opts TokenOptions) (string, error) {
+	now := time.Now().UTC()
+	issue_time := jwt.NewNumericDate(now)
+	expire_time := jwt.NewNumericDate(now.Add(expiresIn))
+	not_before := issue_time
+	if !opts.NotBefore.IsZero() {
+		not_before = jwt.NewNumericDate(opts.NotBefore)
+	}
+	claims := accessClaims{
+		Scope:      strings.Join(opts.Scopes, " "),
+		Generation: opts.Generation,
+		SessionID:  opts.SessionID,
+		ClientID:   opts.ClientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeAccess),
+			IssuedAt:  issue_time,
+			NotBefore: not_before,
+			ExpiresAt: expire_time,
+			Subject:   userID.String(),
+			Audience:  opts.Audience,
+			ID:        uuid.NewString(),
+		},
+	}
+	method, kid, signingKey, err := keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signingKey := []byte(tokenSecret)
 	return token.SignedString(signingKey)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claimsStruct := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(
-		tokenString, 
-		&claimsStruct, 
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(tokenSecret), nil
-		},
+func ValidateJWT(tokenString string, keys KeySet, opts ValidationOptions) (Claims, error) {
+	parserOpts := []jwt.ParserOption{
+		// never let the token pick its own algorithm
+		jwt.WithValidMethods(keys.Algorithms()),
+		jwt.WithIssuer(string(TokenTypeAccess)),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(opts.Leeway),
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+
+	claimsStruct := accessClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&claimsStruct,
+		keys.VerificationKey,
+		parserOpts...,
 	)
 
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, err
 	}
 
-	userIDString, err := token.Claims.GetSubject()
-	if err != nil {
-		return uuid.Nil, err
+	if claimsStruct.ID == "" {
+		return Claims{}, fmt.Errorf("token has no jti")
 	}
 
-	issuer, err := token.Claims.GetIssuer()
+	id, err := uuid.Parse(claimsStruct.Subject)
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, fmt.Errorf("invalid user ID: %w", err)
 	}
 
-	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, fmt.Errorf("invalid issuer")
+	claims := Claims{
+		UserID:     id,
+		TokenID:    claimsStruct.ID,
+		Audience:   claimsStruct.Audience,
+		Scopes:     strings.Fields(claimsStruct.Scope),
+		Generation: claimsStruct.Generation,
+		SessionID:  claimsStruct.SessionID,
+		ClientID:   claimsStruct.ClientID,
+		IssuedAt:   claimsStruct.IssuedAt.Time,
+		ExpiresAt:  claimsStruct.ExpiresAt.Time,
 	}
-
-	id, err := uuid.Parse(userIDString)
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+	if claimsStruct.NotBefore != nil {
+		claims.NotBefore = claimsStruct.NotBefore.Time
 	}
 
-	return id, nil
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -74,7 +164,7 @@ func GetBearerToken(headers http.Header) (string, error) {
 	}
 
 	tokenFields := strings.Fields(authHeader)
-	
+
 	if len(tokenFields) != 2 {
 		log.Print("authorization header missing component")
 		return "", fmt.Errorf("authorization header must follow convention: 'Bearer <token>'")
@@ -86,4 +176,4 @@ func GetBearerToken(headers http.Header) (string, error) {
 	}
 
 	return tokenFields[1], nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var ErrUnknownKeyID = errors.New("unknown signing key ID")
+
+// KeySet is where access tokens get signed and verified. HMACKey covers the
+// shared secret case; Keyring covers asymmetric keys with rotation.
+type KeySet interface {
+	// SigningKey returns the key new tokens should be signed with
+	SigningKey() (method jwt.SigningMethod, kid string, key interface{}, err error)
+	// VerificationKey is a jwt.Keyfunc
+	VerificationKey(token *jwt.Token) (interface{}, error)
+	// Algorithms lists the only "alg" values ValidateJWT will accept
+	Algorithms() []string
+	// PublicKeys is what gets published at /.well-known/jwks.json
+	PublicKeys() []JWK
+}
+
+// HMACKey signs with HS256 using a shared secret
+type HMACKey string
+
+func (k HMACKey) SigningKey() (jwt.SigningMethod, string, interface{}, error) {
+	return jwt.SigningMethodHS256, "", []byte(k), nil
+}
+
+func (k HMACKey) VerificationKey(token *jwt.Token) (interface{}, error) {
+	return []byte(k), nil
+}
+
+func (k HMACKey) Algorithms() []string {
+	return []string{AlgHS256}
+}
+
+// PublicKeys is empty: a shared secret must never be published
+func (k HMACKey) PublicKeys() []JWK {
+	return nil
+}
+
+// SigningKey is one asymmetric key in a Keyring. A key with a zero RetiredAt
+// is active and signs new tokens; retired keys only verify tokens that were
+// signed before the last rotation.
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	CreatedAt  time.Time
+	RetiredAt  time.Time
+}
+
+func (k SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// GenerateSigningKey makes a fresh key for alg (RS256 or EdDSA)
+func GenerateSigningKey(alg string) (SigningKey, error) {
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case AlgRS256:
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	return SigningKey{
+		ID:         uuid.NewString(),
+		Algorithm:  alg,
+		PrivateKey: priv,
+		CreatedAt:  time.Now().UTC(),
+	}, nil
+}
+
+// MarshalPrivateKey encodes a private key as a PKCS #8 PEM block
+func MarshalPrivateKey(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// ParsePrivateKey is the inverse of MarshalPrivateKey
+func ParsePrivateKey(pemData string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// KeyLoader fetches the current set of keys from wherever they're stored
+type KeyLoader func(ctx context.Context) ([]SigningKey, error)
+
+// minReloadInterval stops a flood of tokens with made-up kids from hammering the loader
+const minReloadInterval = 5 * time.Second
+
+// Keyring holds every key that may still have valid tokens in the wild,
+// selected by the "kid" header
+type Keyring struct {
+	load KeyLoader
+
+	mu         sync.RWMutex
+	keys       map[string]SigningKey
+	active     SigningKey
+	lastReload time.Time
+}
+
+func NewKeyring(ctx context.Context, load KeyLoader) (*Keyring, error) {
+	k := &Keyring{load: load}
+	if err := k.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload replaces the keyring's contents with whatever the loader returns now
+func (k *Keyring) Reload(ctx context.Context) error {
+	keys, err := k.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]SigningKey, len(keys))
+	var active SigningKey
+	for _, key := range keys {
+		byID[key.ID] = key
+		if key.RetiredAt.IsZero() && key.CreatedAt.After(active.CreatedAt) {
+			active = key
+		}
+	}
+	if active.ID == "" {
+		return fmt.Errorf("keyring has no active signing key")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = byID
+	k.active = active
+	k.lastReload = time.Now()
+	return nil
+}
+
+func (k *Keyring) SigningKey() (jwt.SigningMethod, string, interface{}, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active.method(), k.active.ID, k.active.PrivateKey, nil
+}
+
+func (k *Keyring) VerificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid header")
+	}
+
+	key, ok := k.lookup(kid)
+	if !ok {
+		// another replica may have rotated since we last looked
+		k.mu.RLock()
+		stale := time.Since(k.lastReload) > minReloadInterval
+		k.mu.RUnlock()
+		if stale {
+			if err := k.Reload(context.Background()); err != nil {
+				return nil, err
+			}
+			key, ok = k.lookup(kid)
+		}
+	}
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("token alg %s doesn't match key %s", token.Method.Alg(), kid)
+	}
+	return key.PrivateKey.Public(), nil
+}
+
+func (k *Keyring) lookup(kid string) (SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (k *Keyring) Algorithms() []string {
+	return []string{AlgRS256, AlgEdDSA}
+}
+
+func (k *Keyring) PublicKeys() []JWK {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	jwks := make([]JWK, 0, len(k.keys))
+	for _, key := range k.keys {
+		jwks = append(jwks, newJWK(key))
+	}
+	return jwks
+}
+
+// JWK is the public half of a signing key, per RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+func newJWK(key SigningKey) JWK {
+	jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+	switch pub := key.PrivateKey.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
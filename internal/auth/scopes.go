@@ -0,0 +1,19 @@
+package auth
+
+const (
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+	ScopeUserRead    = "user:read"
+	ScopeUserWrite   = "user:write"
+	// ScopeOAuthConsent only lets the OAuth consent page approve or deny an
+	// authorization request. It's never granted to API keys or OAuth clients.
+	ScopeOAuthConsent = "oauth:consent"
+)
+
+// DefaultScopes is what a user gets when they log in themselves
+var DefaultScopes = []string{
+	ScopeChirpsRead,
+	ScopeChirpsWrite,
+	ScopeUserRead,
+	ScopeUserWrite,
+}
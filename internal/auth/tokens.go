@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// MakeRefreshToken returns 256 bits of randomness, hex encoded
+func MakeRefreshToken() (string, error) {
+	return makeRandomToken()
+}
+
+// MakeOpaqueToken returns a random single-use token (password resets and the like)
+func MakeOpaqueToken() (string, error) {
+	return makeRandomToken()
+}
+
+func makeRandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken is how opaque tokens are stored at rest. They're already high
+// entropy, so a fast hash is enough; there's nothing to brute force.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
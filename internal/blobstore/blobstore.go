@@ -0,0 +1,76 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps uploaded files somewhere (local disk, S3, ...). Keys are
+// slash-separated paths like "media/<sha256>".
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns ErrNotFound when there's nothing stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete is a no-op for keys that don't exist
+	Delete(ctx context.Context, key string) error
+}
+
+type Backend string
+
+const (
+	BackendLocal Backend = "local"
+	BackendS3    Backend = "s3"
+)
+
+// Config selects and configures a backend. Only the fields relevant to the
+// chosen backend need to be set.
+type Config struct {
+	Backend Backend
+
+	// local
+	Dir string
+
+	// s3 (or anything that speaks its API, like MinIO)
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	// address the bucket as endpoint/bucket/key rather than bucket.endpoint/key
+	S3PathStyle bool
+}
+
+func New(cfg Config) (BlobStore, error) {
+	switch cfg.Backend {
+	case BackendLocal, "":
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("local blob store requires a directory")
+		}
+		return NewLocalStore(cfg.Dir), nil
+	case BackendS3:
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+			return nil, fmt.Errorf("s3 blob store requires an endpoint and a bucket")
+		}
+		return NewS3Store(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKeyID, cfg.S3SecretAccessKey, cfg.S3PathStyle), nil
+	default:
+		return nil, fmt.Errorf("unknown blob store backend: %s", cfg.Backend)
+	}
+}
+
+// validateKey rejects keys that could escape the store's root
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return nil
+}
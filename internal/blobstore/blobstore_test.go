@@ -0,0 +1,139 @@
+package blobstore
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewLocalStore(t.TempDir())
+
+	if _, err := store.Get(ctx, "media/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() of a missing key error = %v, want ErrNotFound", err)
+	}
+
+	body := "hello, chirpy"
+	if err := store.Put(ctx, "media/abc", strings.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	rc, err := store.Get(ctx, "media/abc")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != body {
+		t.Errorf("Get() = %q, want %q", got, body)
+	}
+
+	if err := store.Delete(ctx, "media/abc"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := store.Delete(ctx, "media/abc"); err != nil {
+		t.Errorf("Delete() of a missing key error = %v, want nil", err)
+	}
+	if _, err := store.Get(ctx, "media/abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{key: "media/abc", wantErr: false},
+		{key: "abc", wantErr: false},
+		{key: "", wantErr: true},
+		{key: "/etc/passwd", wantErr: true},
+		{key: "media/../../etc/passwd", wantErr: true},
+		{key: "media//abc", wantErr: true},
+		{key: "./abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			err := validateKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateKey(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// the example from the AWS Signature Version 4 documentation
+func TestSigningKey(t *testing.T) {
+	got := hex.EncodeToString(signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam"))
+	want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if got != want {
+		t.Errorf("signingKey() = %s, want %s", got, want)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	objects := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/20240102/us-east-1/s3/aws4_request, SignedHeaders=") {
+			t.Errorf("unexpected Authorization header %q", auth)
+		}
+		if r.Header.Get("X-Amz-Date") != "20240102T030405Z" {
+			t.Errorf("unexpected X-Amz-Date header %q", r.Header.Get("X-Amz-Date"))
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(body)
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			io.WriteString(w, body)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	store := NewS3Store(srv.URL, "us-east-1", "chirpy", "minio", "minio-secret", true)
+	store.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+	ctx := context.Background()
+
+	body := "hello, chirpy"
+	if err := store.Put(ctx, "media/abc", strings.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if objects["/chirpy/media/abc"] != body {
+		t.Fatalf("Put() stored %v, want %q under /chirpy/media/abc", objects, body)
+	}
+
+	rc, err := store.Get(ctx, "media/abc")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != body {
+		t.Errorf("Get() = %q, want %q", got, body)
+	}
+
+	if err := store.Delete(ctx, "media/abc"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, "media/abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+}
@@ -7,29 +7,55 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const chirpHasReplies = `-- name: ChirpHasReplies :one
+SELECT EXISTS (SELECT 1 FROM chirps WHERE in_reply_to = $1)
+`
+
+func (q *Queries) ChirpHasReplies(ctx context.Context, inReplyTo uuid.NullUUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, chirpHasReplies, inReplyTo)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, root_id, quote_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, root_id, deleted_at, rechirp_of, quote_of
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	RootID    uuid.NullUUID
+	QuoteOf   uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyTo,
+		arg.RootID,
+		arg.QuoteOf,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,16 +63,212 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, rechirp_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
+    $2
+)
+ON CONFLICT (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL DO NOTHING
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, root_id, deleted_at, rechirp_of, quote_of
+`
+
+type CreateRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+// a user can only rechirp a chirp once; a second try returns no rows
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.RechirpOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const deleteChirp = `-- name: DeleteChirp :exec
+DELETE FROM chirps WHERE id = $1
+`
+
+func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteChirp, id)
+	return err
+}
+
+const deleteRechirp = `-- name: DeleteRechirp :one
+DELETE FROM chirps
+WHERE chirps.user_id = $1
+AND chirps.rechirp_of = (SELECT COALESCE(target.rechirp_of, target.id) FROM chirps AS target WHERE target.id = $2)
+RETURNING id, rechirp_of
+`
+
+type DeleteRechirpParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
+}
+
+type DeleteRechirpRow struct {
+	ID        uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+// chirp_id can be the original or any rechirp of it
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (DeleteRechirpRow, error) {
+	row := q.db.QueryRowContext(ctx, deleteRechirp, arg.UserID, arg.ChirpID)
+	var i DeleteRechirpRow
+	err := row.Scan(
+		&i.ID,
+		&i.RechirpOf,
 	)
 	return i, err
 }
 
+const deleteRechirpsOf = `-- name: DeleteRechirpsOf :exec
+DELETE FROM chirps WHERE rechirp_of = $1
+`
+
+func (q *Queries) DeleteRechirpsOf(ctx context.Context, rechirpOf uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRechirpsOf, rechirpOf)
+	return err
+}
+
+const deleteUnrepliedTombstone = `-- name: DeleteUnrepliedTombstone :one
+DELETE FROM chirps
+WHERE id = $1 AND deleted_at IS NOT NULL
+AND NOT EXISTS (SELECT 1 FROM chirps AS replies WHERE replies.in_reply_to = $1)
+RETURNING in_reply_to
+`
+
+// removes a tombstone once its last reply is gone, returning its own parent
+// so the caller can carry on up the thread
+func (q *Queries) DeleteUnrepliedTombstone(ctx context.Context, id uuid.UUID) (uuid.NullUUID, error) {
+	row := q.db.QueryRowContext(ctx, deleteUnrepliedTombstone, id)
+	var in_reply_to uuid.NullUUID
+	err := row.Scan(&in_reply_to)
+	return in_reply_to, err
+}
+
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.in_reply_to, parent.root_id, parent.deleted_at, parent.rechirp_of, parent.quote_of, 1 AS depth
+    FROM chirps
+    JOIN chirps AS parent ON parent.id = chirps.in_reply_to
+    WHERE chirps.id = $1
+    UNION ALL
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.in_reply_to, parent.root_id, parent.deleted_at, parent.rechirp_of, parent.quote_of, ancestors.depth + 1
+    FROM ancestors
+    JOIN chirps AS parent ON parent.id = ancestors.in_reply_to
+    WHERE ancestors.depth < $2::int
+)
+SELECT ancestors.id, ancestors.created_at, ancestors.updated_at, ancestors.body, ancestors.user_id, ancestors.in_reply_to, ancestors.root_id, ancestors.deleted_at, ancestors.rechirp_of, ancestors.quote_of, ancestors.depth::int AS depth,
+(ancestors.deleted_at IS NULL AND users.delete_after IS NULL AND (NOT users.is_private OR users.id = $3 OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = $3 AND follows.followee_id = users.id AND follows.status = 'accepted'
+)))::boolean AS visible
+FROM ancestors
+JOIN users ON users.id = ancestors.user_id
+ORDER BY ancestors.depth ASC
+`
+
+type GetChirpAncestorsParams struct {
+	ID       uuid.UUID
+	MaxDepth int32
+	ViewerID uuid.UUID
+}
+
+type GetChirpAncestorsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	RootID    uuid.NullUUID
+	DeletedAt sql.NullTime
+	RechirpOf uuid.NullUUID
+	QuoteOf   uuid.NullUUID
+	Depth     int32
+	Visible   bool
+}
+
+// the chain of chirps a chirp replies to, nearest first, up to max_depth of them
+func (q *Queries) GetChirpAncestors(ctx context.Context, arg GetChirpAncestorsParams) ([]GetChirpAncestorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, arg.ID, arg.MaxDepth, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpAncestorsRow
+	for rows.Next() {
+		var i GetChirpAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.Depth,
+			&i.Visible,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.root_id, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1 AND users.delete_after IS NULL AND chirps.deleted_at IS NULL
+AND (NOT users.is_private OR users.id = $2 OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = $2 AND follows.followee_id = users.id AND follows.status = 'accepted'
+))
 `
 
-func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirpByID, id)
+type GetChirpByIDParams struct {
+	ID       uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetChirpByID(ctx context.Context, arg GetChirpByIDParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByID, arg.ID, arg.ViewerID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -54,16 +276,179 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
 	)
 	return i, err
 }
 
+const getChirpDescendants = `-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.root_id, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, 1 AS depth
+    FROM chirps
+    WHERE chirps.in_reply_to = $1
+    UNION ALL
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.root_id, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, descendants.depth + 1
+    FROM descendants
+    JOIN chirps ON chirps.in_reply_to = descendants.id
+    WHERE descendants.depth < $2::int
+)
+SELECT descendants.id, descendants.created_at, descendants.updated_at, descendants.body, descendants.user_id, descendants.in_reply_to, descendants.root_id, descendants.deleted_at, descendants.rechirp_of, descendants.quote_of, descendants.depth::int AS depth,
+(descendants.deleted_at IS NULL AND users.delete_after IS NULL AND (NOT users.is_private OR users.id = $3 OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = $3 AND follows.followee_id = users.id AND follows.status = 'accepted'
+)))::boolean AS visible
+FROM descendants
+JOIN users ON users.id = descendants.user_id
+ORDER BY descendants.depth ASC, descendants.created_at ASC, descendants.id ASC
+LIMIT $4
+`
+
+type GetChirpDescendantsParams struct {
+	ID       uuid.NullUUID
+	MaxDepth int32
+	ViewerID uuid.UUID
+	MaxCount int32
+}
+
+type GetChirpDescendantsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	RootID    uuid.NullUUID
+	DeletedAt sql.NullTime
+	RechirpOf uuid.NullUUID
+	QuoteOf   uuid.NullUUID
+	Depth     int32
+	Visible   bool
+}
+
+// replies to a chirp and their replies in turn, breadth first and oldest
+// first within each level, down to max_depth and at most max_count of them
+func (q *Queries) GetChirpDescendants(ctx context.Context, arg GetChirpDescendantsParams) ([]GetChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpDescendants,
+		arg.ID,
+		arg.MaxDepth,
+		arg.ViewerID,
+		arg.MaxCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpDescendantsRow
+	for rows.Next() {
+		var i GetChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.Depth,
+			&i.Visible,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpReplies = `-- name: GetChirpReplies :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.root_id, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.in_reply_to = $1
+AND users.delete_after IS NULL AND chirps.deleted_at IS NULL
+AND (NOT users.is_private OR users.id = $2 OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = $2 AND follows.followee_id = users.id AND follows.status = 'accepted'
+))
+AND (chirps.created_at, chirps.id) < ($3::timestamp, $4::uuid)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $5
+`
+
+type GetChirpRepliesParams struct {
+	ID         uuid.NullUUID
+	ViewerID   uuid.UUID
+	CursorTime time.Time
+	CursorID   uuid.UUID
+	PageSize   int32
+}
+
+// direct replies the viewer can see, newest first, starting after the (created_at, id) cursor
+func (q *Queries) GetChirpReplies(ctx context.Context, arg GetChirpRepliesParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpReplies,
+		arg.ID,
+		arg.ViewerID,
+		arg.CursorTime,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at ASC
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.root_id, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE users.delete_after IS NULL AND chirps.deleted_at IS NULL
+AND (NOT users.is_private OR users.id = $1 OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = $1 AND follows.followee_id = users.id AND follows.status = 'accepted'
+))
+ORDER BY chirps.created_at ASC
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+// private accounts' chirps are only visible to themselves and accepted followers
+func (q *Queries) GetChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -77,6 +462,11 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
 		); err != nil {
 			return nil, err
 		}
@@ -90,3 +480,279 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	}
 	return items, nil
 }
+
+const getChirpsForUser = `-- name: GetChirpsForUser :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, deleted_at, rechirp_of, quote_of FROM chirps WHERE user_id = $1 AND deleted_at IS NULL ORDER BY created_at ASC
+`
+
+func (q *Queries) GetChirpsForUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRechirp = `-- name: GetRechirp :one
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, root_id, deleted_at, rechirp_of, quote_of FROM chirps WHERE user_id = $1 AND rechirp_of = $2
+`
+
+type GetRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+func (q *Queries) GetRechirp(ctx context.Context, arg GetRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getRechirp, arg.UserID, arg.RechirpOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const getReferencedChirps = `-- name: GetReferencedChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.root_id, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, (chirps.deleted_at IS NULL AND users.delete_after IS NULL AND (NOT users.is_private OR users.id = $1 OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = $1 AND follows.followee_id = users.id AND follows.status = 'accepted'
+)))::boolean AS visible
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = ANY($2::uuid[])
+`
+
+type GetReferencedChirpsParams struct {
+	ViewerID uuid.UUID
+	ChirpIds []uuid.UUID
+}
+
+type GetReferencedChirpsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	RootID    uuid.NullUUID
+	DeletedAt sql.NullTime
+	RechirpOf uuid.NullUUID
+	QuoteOf   uuid.NullUUID
+	Visible   bool
+}
+
+// the chirps rechirped or quoted by others, with visible saying which ones
+// the viewer may see
+func (q *Queries) GetReferencedChirps(ctx context.Context, arg GetReferencedChirpsParams) ([]GetReferencedChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getReferencedChirps, arg.ViewerID, pq.Array(arg.ChirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetReferencedChirpsRow
+	for rows.Next() {
+		var i GetReferencedChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.Visible,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getReplyCounts = `-- name: GetReplyCounts :many
+SELECT chirps.in_reply_to AS chirp_id, COUNT(*) AS reply_count
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.in_reply_to = ANY($1::uuid[])
+AND chirps.deleted_at IS NULL AND users.delete_after IS NULL
+GROUP BY chirps.in_reply_to
+`
+
+type GetReplyCountsRow struct {
+	ChirpID    uuid.NullUUID
+	ReplyCount int64
+}
+
+// how many live replies each chirp has
+func (q *Queries) GetReplyCounts(ctx context.Context, chirpIds []uuid.UUID) ([]GetReplyCountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getReplyCounts, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetReplyCountsRow
+	for rows.Next() {
+		var i GetReplyCountsRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.ReplyCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRepostCounts = `-- name: GetRepostCounts :many
+SELECT ids.id::uuid AS chirp_id,
+(SELECT COUNT(*) FROM chirps JOIN users ON users.id = chirps.user_id
+ WHERE chirps.rechirp_of = ids.id AND users.delete_after IS NULL) AS rechirp_count,
+(SELECT COUNT(*) FROM chirps JOIN users ON users.id = chirps.user_id
+ WHERE chirps.quote_of = ids.id AND chirps.deleted_at IS NULL AND users.delete_after IS NULL) AS quote_count
+FROM unnest($1::uuid[]) AS ids(id)
+`
+
+type GetRepostCountsRow struct {
+	ChirpID      uuid.UUID
+	RechirpCount int64
+	QuoteCount   int64
+}
+
+// how many times each chirp has been rechirped and quoted
+func (q *Queries) GetRepostCounts(ctx context.Context, chirpIds []uuid.UUID) ([]GetRepostCountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRepostCounts, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRepostCountsRow
+	for rows.Next() {
+		var i GetRepostCountsRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.RechirpCount,
+			&i.QuoteCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getThreadChirp = `-- name: GetThreadChirp :one
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.root_id, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, (chirps.deleted_at IS NULL AND users.delete_after IS NULL AND (NOT users.is_private OR users.id = $1 OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = $1 AND follows.followee_id = users.id AND follows.status = 'accepted'
+)))::boolean AS visible
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $2
+`
+
+type GetThreadChirpParams struct {
+	ID       uuid.UUID
+	ViewerID uuid.UUID
+}
+
+type GetThreadChirpRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	RootID    uuid.NullUUID
+	DeletedAt sql.NullTime
+	RechirpOf uuid.NullUUID
+	QuoteOf   uuid.NullUUID
+	Visible   bool
+}
+
+// like GetChirpByID, but tombstones and chirps the viewer can't see come back
+// too, with visible saying which is which
+func (q *Queries) GetThreadChirp(ctx context.Context, arg GetThreadChirpParams) (GetThreadChirpRow, error) {
+	row := q.db.QueryRowContext(ctx, getThreadChirp, arg.ID, arg.ViewerID)
+	var i GetThreadChirpRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.Visible,
+	)
+	return i, err
+}
+
+const tombstoneChirp = `-- name: TombstoneChirp :exec
+UPDATE chirps SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+// keeps a deleted chirp's place in its thread without its content
+func (q *Queries) TombstoneChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, tombstoneChirp, id)
+	return err
+}
@@ -5,23 +5,269 @@
 package database
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID              uuid.UUID
+	UserID          uuid.UUID
+	Name            string
+	Prefix          string
+	HashedSecret    string
+	Scopes          []string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	ExpiresAt       time.Time
+	LastUsedAt      sql.NullTime
+	TokenGeneration int32
+}
+
+type AuditEvent struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Event     string
+	IpAddress string
+	UserAgent string
+	Metadata  json.RawMessage
+	CreatedAt time.Time
+}
+
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	RootID    uuid.NullUUID
+	DeletedAt sql.NullTime
+	RechirpOf uuid.NullUUID
+	QuoteOf   uuid.NullUUID
 }
 
-type User struct {
-	ID             uuid.UUID
+type ChirpAttachment struct {
+	ChirpID  uuid.UUID
+	UploadID uuid.UUID
+	Position int32
+	AltText  string
+}
+
+type ChirpMention struct {
+	ChirpID     uuid.UUID
+	UserID      uuid.UUID
+	StartOffset int32
+	EndOffset   int32
+	CreatedAt   time.Time
+}
+
+type ChirpTag struct {
+	ChirpID   uuid.UUID
+	Tag       string
+	CreatedAt time.Time
+}
+
+type DataExport struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Status      string
+	Archive     []byte
+	Error       sql.NullString
+	CreatedAt   time.Time
+	StartedAt   sql.NullTime
+	CompletedAt sql.NullTime
+	ExpiresAt   sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	Status     string
+	CreatedAt  time.Time
+	AcceptedAt sql.NullTime
+}
+
+type Like struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type MagicLinkToken struct {
+	Jti       string
+	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Kind      string
+	ActorID   uuid.UUID
+	ChirpID   uuid.NullUUID
+	CreatedAt time.Time
+	ReadAt    sql.NullTime
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash            string
+	ClientID            uuid.UUID
+	UserID              uuid.UUID
+	RedirectUri         string
+	Scopes              []string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	CreatedAt           time.Time
+	ExpiresAt           time.Time
+	UsedAt              sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	OwnerID      uuid.UUID
+	Name         string
+	HashedSecret sql.NullString
+	RedirectUris []string
+	Scopes       []string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+	ClientID  uuid.NullUUID
+	Scopes    []string
+}
+
+type RevokedSession struct {
+	SessionID uuid.UUID
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt time.Time
+}
+
+type RevokedToken struct {
+	Jti       string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt time.Time
+}
+
+type Session struct {
+	ID               uuid.UUID
+	UserID           uuid.UUID
+	RefreshTokenHash string
+	UserAgent        string
+	IpAddress        string
+	CreatedAt        time.Time
+	LastUsedAt       time.Time
+}
+
+type SigningKey struct {
+	Kid        string
+	Algorithm  string
+	PrivateKey string
+	CreatedAt  time.Time
+	RetiredAt  sql.NullTime
+}
+
+type StreamEvent struct {
+	ID             int64
+	Kind           string
+	ChirpID        uuid.NullUUID
+	UserID         uuid.UUID
+	NotificationID uuid.NullUUID
 	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
+}
+
+type TimelineEntry struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	AuthorID  uuid.UUID
+	CreatedAt time.Time
+}
+
+type TrendingDenylist struct {
+	Tag       string
+	AddedBy   uuid.NullUUID
+	CreatedAt time.Time
+}
+
+type TrendingTag struct {
+	WindowSeconds int32
+	Tag           string
+	Score         float64
+	ChirpCount    int64
+	AuthorCount   int64
+	ComputedAt    time.Time
+}
+
+type Upload struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Sha256      string
+	ContentType string
+	Size        int64
+	CreatedAt   time.Time
+	Status      string
+	Width       sql.NullInt32
+	Height      sql.NullInt32
+	Blurhash    sql.NullString
+	Error       sql.NullString
+	StartedAt   sql.NullTime
+	ProcessedAt sql.NullTime
+}
+
+type UploadVariant struct {
+	UploadID    uuid.UUID
+	Name        string
+	Sha256      string
+	ContentType string
+	Width       int32
+	Height      int32
+	Size        int64
+}
+
+type User struct {
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Email                string
+	HashedPassword       string
+	EmailVerifiedAt      sql.NullTime
+	TokenGeneration      int32
+	PasswordLoginEnabled bool
+	DeleteAfter          sql.NullTime
+	Handle               string
+	DisplayName          string
+	Bio                  string
+	AvatarUrl            string
+	IsPrivate            bool
+	IsAdmin              bool
+	AvatarUploadID       uuid.NullUUID
 }
@@ -7,29 +7,70 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :one
+UPDATE users SET delete_after = NULL, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, token_generation, password_login_enabled, delete_after, handle, display_name, bio, avatar_url, is_private, is_admin, avatar_upload_id
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, cancelUserDeletion, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TokenGeneration,
+		&i.PasswordLoginEnabled,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsPrivate,
+		&i.IsAdmin,
+		&i.AvatarUploadID,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, password_login_enabled, handle)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
-RETURNING id, created_at, updated_at, email, hashed_password
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, token_generation, password_login_enabled, delete_after, handle, display_name, bio, avatar_url, is_private, is_admin, avatar_upload_id
 `
 
 type CreateUserParams struct {
-	Email          string
-	HashedPassword string
+	Email                string
+	HashedPassword       string
+	PasswordLoginEnabled bool
+	Handle               string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser,
+		arg.Email,
+		arg.HashedPassword,
+		arg.PasswordLoginEnabled,
+		arg.Handle,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -37,12 +78,75 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TokenGeneration,
+		&i.PasswordLoginEnabled,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsPrivate,
+		&i.IsAdmin,
+		&i.AvatarUploadID,
 	)
 	return i, err
 }
 
+const deleteUsersScheduledBefore = `-- name: DeleteUsersScheduledBefore :execrows
+DELETE FROM users WHERE delete_after <= $1
+`
+
+func (q *Queries) DeleteUsersScheduledBefore(ctx context.Context, deleteAfter sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUsersScheduledBefore, deleteAfter)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getAuthorSummaries = `-- name: GetAuthorSummaries :many
+SELECT id, handle, display_name, avatar_url FROM users
+WHERE id = ANY($1::uuid[])
+`
+
+type GetAuthorSummariesRow struct {
+	ID          uuid.UUID
+	Handle      string
+	DisplayName string
+	AvatarUrl   string
+}
+
+func (q *Queries) GetAuthorSummaries(ctx context.Context, ids []uuid.UUID) ([]GetAuthorSummariesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAuthorSummaries, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAuthorSummariesRow
+	for rows.Next() {
+		var i GetAuthorSummariesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Handle,
+			&i.DisplayName,
+			&i.AvatarUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, email_verified_at, token_generation, password_login_enabled, delete_after, handle, display_name, bio, avatar_url, is_private, is_admin, avatar_upload_id FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -54,12 +158,52 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TokenGeneration,
+		&i.PasswordLoginEnabled,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsPrivate,
+		&i.IsAdmin,
+		&i.AvatarUploadID,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, email_verified_at, token_generation, password_login_enabled, delete_after, handle, display_name, bio, avatar_url, is_private, is_admin, avatar_upload_id FROM users
+WHERE LOWER(handle) = LOWER($1) AND delete_after IS NULL
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TokenGeneration,
+		&i.PasswordLoginEnabled,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsPrivate,
+		&i.IsAdmin,
+		&i.AvatarUploadID,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT id, created_at, updated_at, email, hashed_password FROM users WHERE id = $1
+SELECT id, created_at, updated_at, email, hashed_password, email_verified_at, token_generation, password_login_enabled, delete_after, handle, display_name, bio, avatar_url, is_private, is_admin, avatar_upload_id FROM users WHERE id = $1
 `
 
 func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
@@ -71,6 +215,277 @@ func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TokenGeneration,
+		&i.PasswordLoginEnabled,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsPrivate,
+		&i.IsAdmin,
+		&i.AvatarUploadID,
+	)
+	return i, err
+}
+
+const getUserTokenGeneration = `-- name: GetUserTokenGeneration :one
+SELECT token_generation FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserTokenGeneration(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, getUserTokenGeneration, id)
+	var token_generation int32
+	err := row.Scan(&token_generation)
+	return token_generation, err
+}
+
+const incrementTokenGeneration = `-- name: IncrementTokenGeneration :one
+UPDATE users SET token_generation = token_generation + 1, updated_at = NOW()
+WHERE id = $1
+RETURNING token_generation
+`
+
+func (q *Queries) IncrementTokenGeneration(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, incrementTokenGeneration, id)
+	var token_generation int32
+	err := row.Scan(&token_generation)
+	return token_generation, err
+}
+
+const lockUsersScheduledBefore = `-- name: LockUsersScheduledBefore :many
+SELECT id FROM users WHERE delete_after <= $1
+FOR UPDATE
+`
+
+// holds the accounts due to be purged, so none can be recovered between
+// reading what they own and deleting them
+func (q *Queries) LockUsersScheduledBefore(ctx context.Context, deleteAfter sql.NullTime) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, lockUsersScheduledBefore, deleteAfter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :one
+UPDATE users SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, token_generation, password_login_enabled, delete_after, handle, display_name, bio, avatar_url, is_private, is_admin, avatar_upload_id
+`
+
+type MarkEmailVerifiedParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, markEmailVerified, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TokenGeneration,
+		&i.PasswordLoginEnabled,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsPrivate,
+		&i.IsAdmin,
+		&i.AvatarUploadID,
+	)
+	return i, err
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users SET delete_after = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, token_generation, password_login_enabled, delete_after, handle, display_name, bio, avatar_url, is_private, is_admin, avatar_upload_id
+`
+
+type ScheduleUserDeletionParams struct {
+	ID          uuid.UUID
+	DeleteAfter sql.NullTime
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.ID, arg.DeleteAfter)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TokenGeneration,
+		&i.PasswordLoginEnabled,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsPrivate,
+		&i.IsAdmin,
+		&i.AvatarUploadID,
+	)
+	return i, err
+}
+
+const setPasswordLoginEnabled = `-- name: SetPasswordLoginEnabled :one
+UPDATE users SET password_login_enabled = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, token_generation, password_login_enabled, delete_after, handle, display_name, bio, avatar_url, is_private, is_admin, avatar_upload_id
+`
+
+type SetPasswordLoginEnabledParams struct {
+	ID                   uuid.UUID
+	PasswordLoginEnabled bool
+}
+
+func (q *Queries) SetPasswordLoginEnabled(ctx context.Context, arg SetPasswordLoginEnabledParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setPasswordLoginEnabled, arg.ID, arg.PasswordLoginEnabled)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TokenGeneration,
+		&i.PasswordLoginEnabled,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsPrivate,
+		&i.IsAdmin,
+		&i.AvatarUploadID,
+	)
+	return i, err
+}
+
+const setUserAdmin = `-- name: SetUserAdmin :execrows
+UPDATE users SET is_admin = $1, updated_at = NOW()
+WHERE LOWER(handle) = LOWER($2) AND delete_after IS NULL
+`
+
+type SetUserAdminParams struct {
+	IsAdmin bool
+	Handle  string
+}
+
+func (q *Queries) SetUserAdmin(ctx context.Context, arg SetUserAdminParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserAdmin, arg.IsAdmin, arg.Handle)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :one
+UPDATE users SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, token_generation, password_login_enabled, delete_after, handle, display_name, bio, avatar_url, is_private, is_admin, avatar_upload_id
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TokenGeneration,
+		&i.PasswordLoginEnabled,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsPrivate,
+		&i.IsAdmin,
+		&i.AvatarUploadID,
+	)
+	return i, err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users SET handle = $2, display_name = $3, bio = $4, avatar_url = $5, is_private = $6, avatar_upload_id = $7, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, token_generation, password_login_enabled, delete_after, handle, display_name, bio, avatar_url, is_private, is_admin, avatar_upload_id
+`
+
+type UpdateUserProfileParams struct {
+	ID             uuid.UUID
+	Handle         string
+	DisplayName    string
+	Bio            string
+	AvatarUrl      string
+	IsPrivate      bool
+	AvatarUploadID uuid.NullUUID
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.ID,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarUrl,
+		arg.IsPrivate,
+		arg.AvatarUploadID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TokenGeneration,
+		&i.PasswordLoginEnabled,
+		&i.DeleteAfter,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.IsPrivate,
+		&i.IsAdmin,
+		&i.AvatarUploadID,
 	)
 	return i, err
 }
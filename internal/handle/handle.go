@@ -0,0 +1,76 @@
+// Package handle validates the public @names users pick for their profiles.
+package handle
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	MinLength = 3
+	MaxLength = 30
+)
+
+var ErrReserved = errors.New("handle is reserved")
+
+// reserved can't be claimed: they'd collide with routes under /api/users, or
+// let someone pass as staff
+var reserved = map[string]bool{
+	"admin":          true,
+	"administrator":  true,
+	"api":            true,
+	"app":            true,
+	"chirpy":         true,
+	"export":         true,
+	"help":           true,
+	"login":          true,
+	"logout":         true,
+	"me":             true,
+	"moderator":      true,
+	"null":           true,
+	"oauth":          true,
+	"password-login": true,
+	"profile":        true,
+	"root":           true,
+	"security":       true,
+	"settings":       true,
+	"staff":          true,
+	"support":        true,
+	"system":         true,
+	"undefined":      true,
+	"verify":         true,
+}
+
+// Normalize is the form handles are compared in: they're case-insensitive
+func Normalize(h string) string {
+	return strings.ToLower(strings.TrimPrefix(h, "@"))
+}
+
+// Validate checks length, characters (letters, digits and underscores) and
+// the reserved list
+func Validate(h string) error {
+	if len(h) < MinLength || len(h) > MaxLength {
+		return fmt.Errorf("handle must be between %d and %d characters", MinLength, MaxLength)
+	}
+	for _, c := range h {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return fmt.Errorf("handle may only contain letters, digits and underscores")
+		}
+	}
+	if reserved[Normalize(h)] {
+		return fmt.Errorf("%w: %s", ErrReserved, h)
+	}
+	return nil
+}
+
+// Generate makes a placeholder handle for accounts that didn't pick one
+func Generate() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "user_" + hex.EncodeToString(b), nil
+}
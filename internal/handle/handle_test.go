@@ -0,0 +1,52 @@
+package handle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		handle       string
+		wantErr      bool
+		wantReserved bool
+	}{
+		{name: "Simple", handle: "lane", wantErr: false},
+		{name: "Mixed case with digits and underscore", handle: "Lane_Wagner99", wantErr: false},
+		{name: "Too short", handle: "ab", wantErr: true},
+		{name: "Too long", handle: "abcdefghijklmnopqrstuvwxyz12345", wantErr: true},
+		{name: "Space", handle: "lane wagner", wantErr: true},
+		{name: "Hyphen", handle: "lane-wagner", wantErr: true},
+		{name: "Non-ASCII letter", handle: "lané", wantErr: true},
+		{name: "Reserved", handle: "admin", wantErr: true, wantReserved: true},
+		{name: "Reserved in another case", handle: "Support", wantErr: true, wantReserved: true},
+		{name: "Route name", handle: "export", wantErr: true, wantReserved: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.handle)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%q) error = %v, wantErr %v", tt.handle, err, tt.wantErr)
+			}
+			if errors.Is(err, ErrReserved) != tt.wantReserved {
+				t.Errorf("Validate(%q) error = %v, want reserved %v", tt.handle, err, tt.wantReserved)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	h, err := Generate()
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if err := Validate(h); err != nil {
+		t.Errorf("Generate() = %q, which doesn't validate: %v", h, err)
+	}
+	other, _ := Generate()
+	if Normalize(h) == Normalize(other) {
+		t.Errorf("Generate() returned %q twice", h)
+	}
+}
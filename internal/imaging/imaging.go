@@ -0,0 +1,255 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported image")
+	// ErrTooLarge is returned before decoding anything, so a small file that
+	// claims huge dimensions (a decompression bomb) never gets allocated
+	ErrTooLarge = errors.New("image dimensions are too large")
+)
+
+const (
+	MaxDimension = 8192
+	MaxPixels    = 40_000_000
+	// animated GIFs are limited by the pixels across all of their frames
+	MaxGIFPixels = 100_000_000
+
+	jpegQuality = 85
+)
+
+const (
+	VariantOriginal  = "original"
+	VariantMedium    = "medium"
+	VariantThumbnail = "thumbnail"
+)
+
+// the scaled-down variants, each fit within a size×size box
+var scaledVariants = []struct {
+	name string
+	size int
+}{
+	{VariantMedium, 1280},
+	{VariantThumbnail, 320},
+}
+
+// Variant is one re-encoded rendition of an image. None of them carry the
+// metadata (EXIF, GPS, comments) of the uploaded file.
+type Variant struct {
+	Name        string
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+type Result struct {
+	// dimensions of the original variant, after applying any EXIF orientation
+	Width    int
+	Height   int
+	BlurHash string
+	Variants []Variant
+}
+
+// Process validates an uploaded JPEG, PNG or GIF and re-encodes it as an
+// original, medium and thumbnail variant
+func Process(data []byte) (Result, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if err := checkDimensions(cfg.Width, cfg.Height); err != nil {
+		return Result{}, err
+	}
+
+	var original Variant
+	var still *image.RGBA
+	switch format {
+	case "jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Result{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+		// the orientation only lives in the EXIF we're about to drop, so bake it in
+		if orientation := jpegOrientation(data); orientation != 1 {
+			img = applyOrientation(toRGBA(img), orientation)
+		}
+		original, err = encodeJPEG(VariantOriginal, img)
+		if err != nil {
+			return Result{}, err
+		}
+		still = toRGBA(img)
+
+	case "png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Result{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+		original, err = encodePNG(VariantOriginal, img)
+		if err != nil {
+			return Result{}, err
+		}
+		still = toRGBA(img)
+
+	case "gif":
+		frames, err := gifFrameCount(data)
+		if err != nil {
+			return Result{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+		if frames*cfg.Width*cfg.Height > MaxGIFPixels {
+			return Result{}, fmt.Errorf("%w: %d frames of %dx%d", ErrTooLarge, frames, cfg.Width, cfg.Height)
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return Result{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+		// the original stays animated; the scaled variants are the first frame
+		buf := &bytes.Buffer{}
+		if err := gif.EncodeAll(buf, g); err != nil {
+			return Result{}, err
+		}
+		original = Variant{
+			Name:        VariantOriginal,
+			Data:        buf.Bytes(),
+			ContentType: "image/gif",
+			Width:       g.Config.Width,
+			Height:      g.Config.Height,
+		}
+		still = image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+		draw.Draw(still, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+
+	default:
+		return Result{}, fmt.Errorf("%w: %s", ErrUnsupported, format)
+	}
+
+	result := Result{
+		Width:    original.Width,
+		Height:   original.Height,
+		Variants: []Variant{original},
+	}
+	for _, scaled := range scaledVariants {
+		img := fit(still, scaled.size)
+		var variant Variant
+		if format == "jpeg" {
+			variant, err = encodeJPEG(scaled.name, img)
+		} else {
+			// PNG keeps any transparency
+			variant, err = encodePNG(scaled.name, img)
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		result.Variants = append(result.Variants, variant)
+	}
+
+	result.BlurHash = BlurHash(fit(still, 32), 4, 3)
+	return result, nil
+}
+
+func checkDimensions(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("%w: image is empty", ErrUnsupported)
+	}
+	if width > MaxDimension || height > MaxDimension || width*height > MaxPixels {
+		return fmt.Errorf("%w: %dx%d", ErrTooLarge, width, height)
+	}
+	return nil
+}
+
+func encodeJPEG(name string, img image.Image) (Variant, error) {
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return Variant{}, err
+	}
+	return Variant{
+		Name:        name,
+		Data:        buf.Bytes(),
+		ContentType: "image/jpeg",
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}, nil
+}
+
+func encodePNG(name string, img image.Image) (Variant, error) {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return Variant{}, err
+	}
+	return Variant{
+		Name:        name,
+		Data:        buf.Bytes(),
+		ContentType: "image/png",
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}, nil
+}
+
+// toRGBA copies img into an RGBA image whose bounds start at the origin
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+var errBadGIF = errors.New("malformed gif")
+
+// gifFrameCount walks the GIF block structure without decompressing any
+// frames, so the frame count can be checked before decoding them all
+func gifFrameCount(data []byte) (int, error) {
+	if len(data) < 13 {
+		return 0, errBadGIF
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&7 + 1)
+	}
+
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension: introducer and label, then sub-blocks
+			pos += 2
+		case 0x2C: // image descriptor, optional local color table, LZW code size, then sub-blocks
+			if pos+10 > len(data) {
+				return 0, errBadGIF
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&7 + 1)
+			}
+			pos++
+			frames++
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, errBadGIF
+		}
+
+		for {
+			if pos >= len(data) {
+				return 0, errBadGIF
+			}
+			n := int(data[pos])
+			pos++
+			if n == 0 {
+				break
+			}
+			pos += n
+		}
+	}
+	return frames, nil
+}
@@ -0,0 +1,205 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func solid(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// withExif splices an APP1 segment into a JPEG right after its SOI marker,
+// with an orientation tag and a fake GPS string to check it gets stripped
+func withExif(t *testing.T, jpg []byte, orientation uint16) []byte {
+	t.Helper()
+	tiff := &bytes.Buffer{}
+	tiff.WriteString("MM")
+	binary.Write(tiff, binary.BigEndian, uint16(42))
+	binary.Write(tiff, binary.BigEndian, uint32(8))
+	binary.Write(tiff, binary.BigEndian, uint16(1))
+	binary.Write(tiff, binary.BigEndian, uint16(0x0112))
+	binary.Write(tiff, binary.BigEndian, uint16(3))
+	binary.Write(tiff, binary.BigEndian, uint32(1))
+	binary.Write(tiff, binary.BigEndian, orientation)
+	binary.Write(tiff, binary.BigEndian, uint16(0))
+	binary.Write(tiff, binary.BigEndian, uint32(0))
+	tiff.WriteString("GPS 51.5007N 0.1246W")
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestProcessJPEG(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, solid(2000, 1000, color.RGBA{200, 30, 30, 255}), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := withExif(t, buf.Bytes(), 6)
+
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("jpegOrientation() = %d, want 6", got)
+	}
+
+	result, err := Process(data)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	// orientation 6 turns the landscape image into a portrait one
+	if result.Width != 1000 || result.Height != 2000 {
+		t.Errorf("Process() dimensions = %dx%d, want 1000x2000", result.Width, result.Height)
+	}
+
+	want := map[string][2]int{
+		VariantOriginal:  {1000, 2000},
+		VariantMedium:    {640, 1280},
+		VariantThumbnail: {160, 320},
+	}
+	if len(result.Variants) != len(want) {
+		t.Fatalf("Process() returned %d variants, want %d", len(result.Variants), len(want))
+	}
+	for _, v := range result.Variants {
+		if v.ContentType != "image/jpeg" {
+			t.Errorf("%s variant content type = %s, want image/jpeg", v.Name, v.ContentType)
+		}
+		if dims := want[v.Name]; v.Width != dims[0] || v.Height != dims[1] {
+			t.Errorf("%s variant = %dx%d, want %dx%d", v.Name, v.Width, v.Height, dims[0], dims[1])
+		}
+		if bytes.Contains(v.Data, []byte("Exif")) || bytes.Contains(v.Data, []byte("GPS")) {
+			t.Errorf("%s variant still contains EXIF data", v.Name)
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(v.Data))
+		if err != nil || cfg.Width != v.Width || cfg.Height != v.Height {
+			t.Errorf("%s variant decodes as %dx%d (err %v), want %dx%d", v.Name, cfg.Width, cfg.Height, err, v.Width, v.Height)
+		}
+	}
+	if result.BlurHash == "" {
+		t.Error("Process() didn't compute a blurhash")
+	}
+}
+
+func TestProcessAnimatedGIF(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	g := &gif.GIF{}
+	for i := 0; i < 3; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 40, 20), palette))
+		g.Delay = append(g.Delay, 10)
+	}
+	buf := &bytes.Buffer{}
+	if err := gif.EncodeAll(buf, g); err != nil {
+		t.Fatal(err)
+	}
+
+	if frames, err := gifFrameCount(buf.Bytes()); err != nil || frames != 3 {
+		t.Fatalf("gifFrameCount() = %d, %v, want 3", frames, err)
+	}
+
+	result, err := Process(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	original, err := gif.DecodeAll(bytes.NewReader(result.Variants[0].Data))
+	if err != nil {
+		t.Fatalf("original variant isn't a GIF: %v", err)
+	}
+	if len(original.Image) != 3 {
+		t.Errorf("original variant has %d frames, want 3", len(original.Image))
+	}
+	if result.Variants[1].ContentType != "image/png" {
+		t.Errorf("medium variant content type = %s, want image/png", result.Variants[1].ContentType)
+	}
+}
+
+// a valid PNG header claiming dimensions far beyond what the file could hold
+func pngBomb(t *testing.T, w, h uint32) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, solid(1, 1, color.White)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// IHDR data starts after the 8 byte signature, 4 byte length and 4 byte type
+	binary.BigEndian.PutUint32(data[16:], w)
+	binary.BigEndian.PutUint32(data[20:], h)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestProcessRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "Decompression bomb", data: pngBomb(t, 100000, 100000), want: ErrTooLarge},
+		{name: "Too wide", data: pngBomb(t, MaxDimension+1, 10), want: ErrTooLarge},
+		{name: "Too many pixels", data: pngBomb(t, 8000, 8000), want: ErrTooLarge},
+		{name: "Not an image", data: []byte("definitely not an image"), want: ErrUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Process(tt.data)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Process() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// a 2x1 image: red on the left, blue on the right
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	src.Set(1, 0, color.RGBA{0, 0, 255, 255})
+
+	red := color.RGBA{255, 0, 0, 255}
+	tests := []struct {
+		orientation int
+		// where the red pixel ends up
+		x, y int
+	}{
+		{orientation: 1, x: 0, y: 0},
+		{orientation: 2, x: 1, y: 0},
+		{orientation: 3, x: 1, y: 0},
+		{orientation: 6, x: 0, y: 0},
+		{orientation: 8, x: 0, y: 1},
+	}
+
+	for _, tt := range tests {
+		got := applyOrientation(src, tt.orientation)
+		if got.RGBAAt(tt.x, tt.y) != red {
+			t.Errorf("applyOrientation(%d): red isn't at (%d, %d)", tt.orientation, tt.x, tt.y)
+		}
+	}
+}
+
+func TestBlurHash(t *testing.T) {
+	// every AC component of a flat image is zero, which always encodes as "fQ"
+	got := BlurHash(solid(32, 32, color.Black), 4, 3)
+	want := "L00000" + strings.Repeat("fQ", 11)
+	if got != want {
+		t.Errorf("BlurHash() = %s, want %s", got, want)
+	}
+}
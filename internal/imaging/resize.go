@@ -0,0 +1,58 @@
+package imaging
+
+import "image"
+
+// fit scales src down to fit within a size×size box, keeping its aspect
+// ratio. Images that already fit are returned as is.
+func fit(src *image.RGBA, size int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	dw, dh := size, size
+	if w > h {
+		dh = max(1, h*size/w)
+	} else {
+		dw = max(1, w*size/h)
+	}
+	return resize(src, dw, dh)
+}
+
+// resize averages the block of source pixels under each destination pixel.
+// That's only a good filter for shrinking, which is all we do.
+func resize(src *image.RGBA, dw, dh int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, (dy+1)*sh/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*sw/dw, (dx+1)*sw/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]uint64
+			for y := y0; y < y1; y++ {
+				row := src.Pix[src.PixOffset(b.Min.X+x0, b.Min.Y+y):][:(x1-x0)*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += uint64(row[i])
+					sum[1] += uint64(row[i+1])
+					sum[2] += uint64(row[i+2])
+					sum[3] += uint64(row[i+3])
+				}
+			}
+
+			n := uint64((x1 - x0) * (y1 - y0))
+			out := dst.Pix[dst.PixOffset(dx, dy):][:4]
+			for c := range out {
+				out[c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
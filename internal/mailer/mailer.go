@@ -0,0 +1,82 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email handed to a Mailer for delivery
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages through some transport (SMTP, a local file, memory, ...)
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type Transport string
+
+const (
+	TransportSMTP   Transport = "smtp"
+	TransportFile   Transport = "file"
+	TransportStdout Transport = "stdout"
+	TransportMemory Transport = "memory"
+)
+
+// Config selects and configures a transport. Only the fields relevant to the
+// chosen transport need to be set.
+type Config struct {
+	Transport Transport
+	From      string
+
+	// smtp
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// file
+	Dir string
+}
+
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Transport {
+	case TransportSMTP:
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("smtp transport requires a host")
+		}
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From), nil
+	case TransportFile:
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("file transport requires a directory")
+		}
+		return NewFileMailer(cfg.Dir, cfg.From), nil
+	case TransportStdout, "":
+		return NewWriterMailer(os.Stdout, cfg.From), nil
+	case TransportMemory:
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport: %s", cfg.Transport)
+	}
+}
+
+// formatMessage renders msg as an RFC 5322 message suitable for SMTP or an .eml file
+func formatMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+	m.Send(context.Background(), Message{To: "a@example.com", Subject: "first"})
+	m.Send(context.Background(), Message{To: "b@example.com", Subject: "second"})
+	m.Send(context.Background(), Message{To: "a@example.com", Subject: "third"})
+
+	if got := len(m.Sent()); got != 3 {
+		t.Fatalf("Sent() returned %d messages, want 3", got)
+	}
+	last, ok := m.Last("a@example.com")
+	if !ok || last.Subject != "third" {
+		t.Errorf("Last() = %+v, %v, want subject 'third'", last, ok)
+	}
+	if _, ok := m.Last("nobody@example.com"); ok {
+		t.Errorf("Last() found a message for an unknown recipient")
+	}
+}
+
+func TestFileAndWriterMailers(t *testing.T) {
+	msg := Message{To: "a@example.com", Subject: "Hello", Body: "line one\nline two"}
+
+	dir := t.TempDir()
+	if err := NewFileMailer(dir, "chirpy@example.com").Send(context.Background(), msg); err != nil {
+		t.Fatalf("FileMailer.Send() error = %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 .eml file, found %d", len(files))
+	}
+	dat, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(dat), "Subject: Hello\r\n") || !strings.Contains(string(dat), "line one\r\nline two") {
+		t.Errorf("unexpected file contents: %q", dat)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := NewWriterMailer(buf, "chirpy@example.com").Send(context.Background(), msg); err != nil {
+		t.Fatalf("WriterMailer.Send() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "To: a@example.com") {
+		t.Errorf("unexpected writer output: %q", buf.String())
+	}
+}
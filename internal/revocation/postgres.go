@@ -0,0 +1,60 @@
+package revocation
+
+import (
+	"context"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// PostgresBackend keeps revocations in the revoked_tokens and
+// revoked_sessions tables and token generations on the users table
+type PostgresBackend struct {
+	db *database.Queries
+}
+
+func NewPostgresBackend(db *database.Queries) *PostgresBackend {
+	return &PostgresBackend{db: db}
+}
+
+func (b *PostgresBackend) Revoke(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error {
+	return b.db.RevokeToken(ctx, database.RevokeTokenParams{
+		Jti:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (b *PostgresBackend) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return b.db.IsTokenRevoked(ctx, jti)
+}
+
+func (b *PostgresBackend) RevokeSession(ctx context.Context, sessionID, userID uuid.UUID, expiresAt time.Time) error {
+	return b.db.RevokeSessionTokens(ctx, database.RevokeSessionTokensParams{
+		SessionID: sessionID,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (b *PostgresBackend) IsSessionRevoked(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	return b.db.IsSessionRevoked(ctx, sessionID)
+}
+
+func (b *PostgresBackend) PurgeExpired(ctx context.Context) (int64, error) {
+	tokens, err := b.db.DeleteExpiredRevokedTokens(ctx)
+	if err != nil {
+		return 0, err
+	}
+	sessions, err := b.db.DeleteExpiredRevokedSessions(ctx)
+	return tokens + sessions, err
+}
+
+func (b *PostgresBackend) Generation(ctx context.Context, userID uuid.UUID) (int32, error) {
+	return b.db.GetUserTokenGeneration(ctx, userID)
+}
+
+func (b *PostgresBackend) BumpGeneration(ctx context.Context, userID uuid.UUID) (int32, error) {
+	return b.db.IncrementTokenGeneration(ctx, userID)
+}
@@ -0,0 +1,239 @@
+package revocation
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Backend is the durable side of the store, shared by every replica
+type Backend interface {
+	Revoke(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	RevokeSession(ctx context.Context, sessionID, userID uuid.UUID, expiresAt time.Time) error
+	IsSessionRevoked(ctx context.Context, sessionID uuid.UUID) (bool, error)
+	PurgeExpired(ctx context.Context) (int64, error)
+	Generation(ctx context.Context, userID uuid.UUID) (int32, error)
+	BumpGeneration(ctx context.Context, userID uuid.UUID) (int32, error)
+}
+
+// Store answers "has this access token been revoked?" for the auth middleware.
+//
+// Revocations are cached until the token would have stopped validating anyway,
+// leeway after it expires, since the answer can never change back. "Not revoked" answers and token generations are
+// only cached for negativeTTL: a revocation made on another replica takes at
+// most that long to be seen here.
+type Store struct {
+	backend     Backend
+	negativeTTL time.Duration
+	// how long past exp tokens are still accepted; see auth.ValidateJWT
+	leeway time.Duration
+
+	mu          sync.Mutex
+	revoked     map[string]time.Time // jti -> token expiry
+	notRevoked  map[string]time.Time // jti -> cache expiry
+	generations map[uuid.UUID]cachedGeneration
+	// the same, for the login sessions tokens carry in their sid
+	revokedSessions    map[uuid.UUID]time.Time
+	notRevokedSessions map[uuid.UUID]time.Time
+}
+
+type cachedGeneration struct {
+	generation int32
+	expiresAt  time.Time
+}
+
+func New(backend Backend, negativeTTL, leeway time.Duration) *Store {
+	return &Store{
+		backend:     backend,
+		negativeTTL: negativeTTL,
+		leeway:      leeway,
+		revoked:     map[string]time.Time{},
+		notRevoked:  map[string]time.Time{},
+		generations: map[uuid.UUID]cachedGeneration{},
+
+		revokedSessions:    map[uuid.UUID]time.Time{},
+		notRevokedSessions: map[uuid.UUID]time.Time{},
+	}
+}
+
+// Revoke denylists jti for the rest of its life, which runs until leeway past
+// expiresAt. Tokens past that are ignored; they're dead anyway.
+func (s *Store) Revoke(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error {
+	expiresAt = expiresAt.Add(s.leeway)
+	if !time.Now().Before(expiresAt) {
+		return nil
+	}
+
+	if err := s.backend.Revoke(ctx, jti, userID, expiresAt); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[jti] = expiresAt
+	delete(s.notRevoked, jti)
+	return nil
+}
+
+func (s *Store) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	if exp, ok := s.revoked[jti]; ok && now.Before(exp) {
+		s.mu.Unlock()
+		return true, nil
+	}
+	if exp, ok := s.notRevoked[jti]; ok && now.Before(exp) {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.mu.Unlock()
+
+	revoked, err := s.backend.IsRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if revoked {
+		// we don't know the exact expiry here; holding it for negativeTTL is
+		// enough to stop repeated lookups for a token that keeps being replayed
+		s.revoked[jti] = now.Add(s.negativeTTL)
+	} else {
+		s.notRevoked[jti] = now.Add(s.negativeTTL)
+	}
+	return revoked, nil
+}
+
+// RevokeSession denylists every access token minted for a login session,
+// including ones held by other devices. expiresAt is when the last of them
+// expires.
+func (s *Store) RevokeSession(ctx context.Context, sessionID, userID uuid.UUID, expiresAt time.Time) error {
+	if err := s.backend.RevokeSession(ctx, sessionID, userID, expiresAt); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokedSessions[sessionID] = expiresAt
+	delete(s.notRevokedSessions, sessionID)
+	return nil
+}
+
+// IsSessionRevoked is IsRevoked for a token's session, cached the same way
+func (s *Store) IsSessionRevoked(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	if exp, ok := s.revokedSessions[sessionID]; ok && now.Before(exp) {
+		s.mu.Unlock()
+		return true, nil
+	}
+	if exp, ok := s.notRevokedSessions[sessionID]; ok && now.Before(exp) {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.mu.Unlock()
+
+	revoked, err := s.backend.IsSessionRevoked(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if revoked {
+		s.revokedSessions[sessionID] = now.Add(s.negativeTTL)
+	} else {
+		s.notRevokedSessions[sessionID] = now.Add(s.negativeTTL)
+	}
+	return revoked, nil
+}
+
+// Generation returns the user's current token generation. Access tokens minted
+// with an older generation are no longer valid.
+func (s *Store) Generation(ctx context.Context, userID uuid.UUID) (int32, error) {
+	s.mu.Lock()
+	if cached, ok := s.generations[userID]; ok && time.Now().Before(cached.expiresAt) {
+		s.mu.Unlock()
+		return cached.generation, nil
+	}
+	s.mu.Unlock()
+
+	gen, err := s.backend.Generation(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generations[userID] = cachedGeneration{generation: gen, expiresAt: time.Now().Add(s.negativeTTL)}
+	return gen, nil
+}
+
+// BumpGeneration invalidates every access token the user currently holds
+func (s *Store) BumpGeneration(ctx context.Context, userID uuid.UUID) (int32, error) {
+	gen, err := s.backend.BumpGeneration(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generations[userID] = cachedGeneration{generation: gen, expiresAt: time.Now().Add(s.negativeTTL)}
+	return gen, nil
+}
+
+// Run purges expired entries from the cache and the backend every interval
+// until ctx is cancelled
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.purgeCache()
+			if _, err := s.backend.PurgeExpired(ctx); err != nil {
+				log.Printf("Couldn't purge expired token revocations: %s", err)
+			}
+		}
+	}
+}
+
+func (s *Store) purgeCache() {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for jti, exp := range s.revoked {
+		if !now.Before(exp) {
+			delete(s.revoked, jti)
+		}
+	}
+	for jti, exp := range s.notRevoked {
+		if !now.Before(exp) {
+			delete(s.notRevoked, jti)
+		}
+	}
+	for sessionID, exp := range s.revokedSessions {
+		if !now.Before(exp) {
+			delete(s.revokedSessions, sessionID)
+		}
+	}
+	for sessionID, exp := range s.notRevokedSessions {
+		if !now.Before(exp) {
+			delete(s.notRevokedSessions, sessionID)
+		}
+	}
+	for userID, cached := range s.generations {
+		if !now.Before(cached.expiresAt) {
+			delete(s.generations, userID)
+		}
+	}
+}
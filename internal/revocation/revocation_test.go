@@ -0,0 +1,162 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type fakeBackend struct {
+	revoked         map[string]time.Time
+	revokedSessions map[uuid.UUID]time.Time
+	generations     map[uuid.UUID]int32
+	lookups         int
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		revoked:         map[string]time.Time{},
+		revokedSessions: map[uuid.UUID]time.Time{},
+		generations:     map[uuid.UUID]int32{},
+	}
+}
+
+func (b *fakeBackend) Revoke(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error {
+	b.revoked[jti] = expiresAt
+	return nil
+}
+
+func (b *fakeBackend) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	b.lookups++
+	_, ok := b.revoked[jti]
+	return ok, nil
+}
+
+func (b *fakeBackend) RevokeSession(ctx context.Context, sessionID, userID uuid.UUID, expiresAt time.Time) error {
+	b.revokedSessions[sessionID] = expiresAt
+	return nil
+}
+
+func (b *fakeBackend) IsSessionRevoked(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	b.lookups++
+	_, ok := b.revokedSessions[sessionID]
+	return ok, nil
+}
+
+func (b *fakeBackend) PurgeExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (b *fakeBackend) Generation(ctx context.Context, userID uuid.UUID) (int32, error) {
+	b.lookups++
+	return b.generations[userID], nil
+}
+
+func (b *fakeBackend) BumpGeneration(ctx context.Context, userID uuid.UUID) (int32, error) {
+	b.generations[userID]++
+	return b.generations[userID], nil
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBackend()
+	store := New(backend, time.Hour, 0)
+	userID := uuid.New()
+
+	if err := store.Revoke(ctx, "live", userID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	store.Revoke(ctx, "already-expired", userID, time.Now().Add(-time.Minute))
+	if _, ok := backend.revoked["already-expired"]; ok {
+		t.Errorf("Revoke() stored a token that had already expired")
+	}
+
+	tests := []struct {
+		jti  string
+		want bool
+	}{
+		{jti: "live", want: true},
+		{jti: "never-revoked", want: false},
+		{jti: "never-revoked", want: false},
+	}
+	for _, tt := range tests {
+		got, err := store.IsRevoked(ctx, tt.jti)
+		if err != nil || got != tt.want {
+			t.Errorf("IsRevoked(%q) = %v, %v, want %v", tt.jti, got, err, tt.want)
+		}
+	}
+	// "live" is answered from the local revocation, "never-revoked" once from
+	// the backend and then from the negative cache
+	if backend.lookups != 1 {
+		t.Errorf("backend was asked %d times, want 1", backend.lookups)
+	}
+
+	// another replica revokes a token we've already cached as live; we keep
+	// trusting the cache until negativeTTL runs out
+	backend.revoked["never-revoked"] = time.Now().Add(time.Hour)
+	if got, _ := store.IsRevoked(ctx, "never-revoked"); got {
+		t.Errorf("IsRevoked() bypassed the negative cache")
+	}
+
+	if gen, _ := store.Generation(ctx, userID); gen != 0 {
+		t.Errorf("Generation() = %d, want 0", gen)
+	}
+	store.BumpGeneration(ctx, userID)
+	if gen, _ := store.Generation(ctx, userID); gen != 1 {
+		t.Errorf("Generation() after bump = %d, want 1", gen)
+	}
+}
+
+func TestStoreSessions(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBackend()
+	store := New(backend, time.Minute, 0)
+	userID := uuid.New()
+	signedOut, live := uuid.New(), uuid.New()
+
+	if err := store.RevokeSession(ctx, signedOut, userID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeSession() error = %v", err)
+	}
+	if got, err := store.IsSessionRevoked(ctx, signedOut); err != nil || !got {
+		t.Errorf("IsSessionRevoked(signed out) = %v, %v, want true", got, err)
+	}
+	if got, err := store.IsSessionRevoked(ctx, live); err != nil || got {
+		t.Errorf("IsSessionRevoked(live) = %v, %v, want false", got, err)
+	}
+	store.IsSessionRevoked(ctx, live)
+	if backend.lookups != 1 {
+		t.Errorf("backend was asked %d times, want 1", backend.lookups)
+	}
+}
+
+func TestRevokeInsideLeeway(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBackend()
+	store := New(backend, time.Hour, 30*time.Second)
+	userID := uuid.New()
+
+	// expired, but still accepted for another 20 seconds
+	expiresAt := time.Now().Add(-10 * time.Second)
+	if err := store.Revoke(ctx, "in-leeway", userID, expiresAt); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if got, _ := store.IsRevoked(ctx, "in-leeway"); !got {
+		t.Errorf("IsRevoked() = false for a token revoked inside its leeway")
+	}
+	if stored, ok := backend.revoked["in-leeway"]; !ok || !stored.After(time.Now()) {
+		t.Errorf("backend keeps the revocation until %v, want until the leeway runs out", stored)
+	}
+
+	// entries are purged from the cache no earlier than that either
+	store.purgeCache()
+	if _, ok := store.revoked["in-leeway"]; !ok {
+		t.Errorf("purgeCache() dropped a revocation that's still inside its leeway")
+	}
+
+	store.Revoke(ctx, "past-leeway", userID, time.Now().Add(-time.Minute))
+	if _, ok := backend.revoked["past-leeway"]; ok {
+		t.Errorf("Revoke() stored a token that no longer validates")
+	}
+}
@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/lib/pq"
+)
+
+// Channel is the Postgres NOTIFY channel events are published on; see
+// PublishStreamEvent
+const Channel = "chirpy_stream"
+
+// catchUpLimit caps how many events are read back from the log after the
+// listener reconnects. Subscribers that far behind get dropped anyway.
+const catchUpLimit = 1000
+
+// Listen relays the events every replica publishes to this hub until ctx is
+// cancelled. When the connection drops, the events published meanwhile are
+// read back from the log once it's back, so subscribers may see an event
+// twice but shouldn't miss any.
+func (h *Hub) Listen(ctx context.Context, dbURL string, db *database.Queries) {
+	listener := pq.NewListener(dbURL, time.Second, time.Minute, func(_ pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Stream listener: %s", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(Channel); err != nil {
+		log.Printf("Couldn't listen for stream events: %s", err)
+		return
+	}
+
+	var lastID int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			if n == nil {
+				// the connection was re-established
+				lastID = h.catchUp(ctx, db, lastID)
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+				log.Printf("Couldn't decode stream event %q: %s", n.Extra, err)
+				continue
+			}
+			lastID = max(lastID, event.ID)
+			h.Publish(event)
+		case <-time.After(90 * time.Second):
+			// notices a dead connection even when nothing's being published
+			go listener.Ping()
+		}
+	}
+}
+
+// catchUp publishes the events logged after lastID and returns the new last ID
+func (h *Hub) catchUp(ctx context.Context, db *database.Queries, lastID int64) int64 {
+	if lastID == 0 {
+		return lastID
+	}
+	rows, err := db.GetStreamEventsSince(ctx, database.GetStreamEventsSinceParams{
+		ID:    lastID,
+		Limit: catchUpLimit,
+	})
+	if err != nil {
+		log.Printf("Couldn't catch up on stream events: %s", err)
+		return lastID
+	}
+	for _, row := range rows {
+		h.Publish(FromRow(row))
+		lastID = row.ID
+	}
+	return lastID
+}
+
+// FromRow turns a row of the log into an Event
+func FromRow(row database.StreamEvent) Event {
+	return Event{
+		ID:             row.ID,
+		Kind:           row.Kind,
+		ChirpID:        row.ChirpID,
+		UserID:         row.UserID,
+		NotificationID: row.NotificationID,
+	}
+}
@@ -0,0 +1,88 @@
+package stream
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Event is one entry in the stream_events log, as it's passed between
+// replicas and on to subscribers. What it means depends on Kind; the API
+// decides which subscribers see it and how it's rendered.
+type Event struct {
+	ID             int64         `json:"id"`
+	Kind           string        `json:"kind"`
+	ChirpID        uuid.NullUUID `json:"chirp_id"`
+	UserID         uuid.UUID     `json:"user_id"`
+	NotificationID uuid.NullUUID `json:"notification_id"`
+}
+
+// Hub fans events out to everyone subscribed on this replica.
+//
+// Publish never blocks: a subscriber that falls bufferSize events behind is
+// dropped, which closes its channel. Clients of the SSE streams reconnect and
+// catch up from the log, which is cheaper than holding everyone else up.
+type Hub struct {
+	bufferSize int
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]bool
+}
+
+type Subscription struct {
+	hub    *Hub
+	events chan Event
+}
+
+func NewHub(bufferSize int) *Hub {
+	return &Hub{
+		bufferSize:  bufferSize,
+		subscribers: map[*Subscription]bool{},
+	}
+}
+
+// Subscribe starts receiving every event published from now on. Call Close
+// when done.
+func (h *Hub) Subscribe() *Subscription {
+	sub := &Subscription{
+		hub:    h,
+		events: make(chan Event, h.bufferSize),
+	}
+	h.mu.Lock()
+	h.subscribers[sub] = true
+	h.mu.Unlock()
+	return sub
+}
+
+// Events delivers the subscription's events. It's closed if the subscriber
+// falls too far behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[sub] {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Publish hands an event to every subscriber on this replica
+func (h *Hub) Publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
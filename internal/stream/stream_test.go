@@ -0,0 +1,57 @@
+package stream
+
+import "testing"
+
+func TestPublishReachesEverySubscriber(t *testing.T) {
+	hub := NewHub(4)
+	first := hub.Subscribe()
+	defer first.Close()
+	second := hub.Subscribe()
+	defer second.Close()
+
+	hub.Publish(Event{ID: 1, Kind: "chirp"})
+
+	for _, sub := range []*Subscription{first, second} {
+		select {
+		case event := <-sub.Events():
+			if event.ID != 1 {
+				t.Errorf("got event %d, want 1", event.ID)
+			}
+		default:
+			t.Error("subscriber didn't get the event")
+		}
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	hub := NewHub(2)
+	slow := hub.Subscribe()
+	defer slow.Close()
+
+	for id := int64(1); id <= 3; id++ {
+		hub.Publish(Event{ID: id})
+	}
+
+	var got []int64
+	for event := range slow.Events() {
+		got = append(got, event.ID)
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("got events %v before the channel closed, want [1 2]", got)
+	}
+
+	// closing after being dropped is fine
+	slow.Close()
+}
+
+func TestClosedSubscriptionGetsNothing(t *testing.T) {
+	hub := NewHub(2)
+	sub := hub.Subscribe()
+	sub.Close()
+
+	hub.Publish(Event{ID: 1})
+
+	if _, ok := <-sub.Events(); ok {
+		t.Error("closed subscription got an event")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/database"
+)
+
+// how often each replica re-reads signing_keys to pick up rotations
+const keyringReloadInterval = time.Minute
+
+// newKeySet picks how access tokens are signed. HS256 (the default) uses
+// JWT_SECRET; RS256 and EdDSA use the keyring stored in signing_keys.
+func newKeySet(ctx context.Context, alg, secret string, db *database.Queries) (auth.KeySet, error) {
+	if alg == "" || alg == auth.AlgHS256 {
+		return auth.HMACKey(secret), nil
+	}
+
+	keys, err := db.GetSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hasActive := false
+	for _, key := range keys {
+		if !key.RetiredAt.Valid {
+			hasActive = true
+		}
+	}
+	if !hasActive {
+		kid, err := rotateSigningKeys(ctx, db, alg)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't create initial signing key: %w", err)
+		}
+		log.Printf("Created initial %s signing key %s", alg, kid)
+	}
+
+	keyring, err := auth.NewKeyring(ctx, loadSigningKeys(db))
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for range time.Tick(keyringReloadInterval) {
+			if err := keyring.Reload(context.Background()); err != nil {
+				log.Printf("Couldn't reload signing keys: %s", err)
+			}
+		}
+	}()
+
+	return keyring, nil
+}
+
+func loadSigningKeys(db *database.Queries) auth.KeyLoader {
+	return func(ctx context.Context) ([]auth.SigningKey, error) {
+		rows, err := db.GetSigningKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		keys := make([]auth.SigningKey, 0, len(rows))
+		for _, row := range rows {
+			priv, err := auth.ParsePrivateKey(row.PrivateKey)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't parse signing key %s: %w", row.Kid, err)
+			}
+			keys = append(keys, auth.SigningKey{
+				ID:         row.Kid,
+				Algorithm:  row.Algorithm,
+				PrivateKey: priv,
+				CreatedAt:  row.CreatedAt,
+				RetiredAt:  row.RetiredAt.Time,
+			})
+		}
+		return keys, nil
+	}
+}
+
+// rotateSigningKeys makes a new active key and retires the rest. Retired keys
+// keep verifying until every token they signed has expired, then get pruned.
+func rotateSigningKeys(ctx context.Context, db *database.Queries, alg string) (string, error) {
+	key, err := auth.GenerateSigningKey(alg)
+	if err != nil {
+		return "", err
+	}
+
+	pemData, err := auth.MarshalPrivateKey(key.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.CreateSigningKey(ctx, database.CreateSigningKeyParams{
+		Kid:        key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: pemData,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := db.RetireSigningKeysExcept(ctx, key.ID); err != nil {
+		return "", err
+	}
+
+	pruned, err := db.DeleteSigningKeysRetiredBefore(ctx, sql.NullTime{
+		Time:  time.Now().UTC().Add(-accessTokenTTL),
+		Valid: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d expired signing keys", pruned)
+	}
+
+	return key.ID, nil
+}
+
+// runRotateKeys implements `chirpy rotate-keys [-alg RS256|EdDSA]`
+func runRotateKeys(args []string, db *database.Queries, defaultAlg string) error {
+	fs := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	alg := fs.String("alg", defaultAlg, "algorithm for the new key (RS256 or EdDSA)")
+	fs.Parse(args)
+
+	if *alg == "" || *alg == auth.AlgHS256 {
+		return fmt.Errorf("rotate-keys needs an asymmetric algorithm; set -alg or JWT_SIGNING_ALG")
+	}
+
+	kid, err := rotateSigningKeys(context.Background(), db, *alg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("New %s signing key %s is now active\n", *alg, kid)
+	return nil
+}
+
+/* Returns 200 OK with the public keys that verify access tokens
+	{
+		"keys": [
+			{"kty": "OKP", "kid": "8f0c...", "use": "sig", "alg": "EdDSA", "crv": "Ed25519", "x": "11qY..."}
+		]
+	}
+*/
+
+type JWKSResponse struct {
+	Keys []auth.JWK `json:"keys"`
+}
+
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	keys := cfg.Keys.PublicKeys()
+	if keys == nil {
+		keys = []auth.JWK{}
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, JWKSResponse{Keys: keys})
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+/* GET /api/users/{id}/likes returns a page (see Page in pagination.go) of the
+   chirps a user liked, most recently liked first, each with "liked_at"
+	{
+		"id": "94b7e44c-3604-42e3-bef7-ebfcc3efff8f",
+		"body": "Hello, world!",
+		...
+		"liked_at": "2021-07-01T00:00:00Z"
+	}
+*/
+
+type LikedChirp struct {
+	Chirp
+	LikedAt time.Time `json:"liked_at"`
+}
+
+// embedLikes fills in LikeCount on each chirp, and LikedByMe when there's a
+// logged-in viewer, with a query each for all of them
+func (cfg *apiConfig) embedLikes(ctx context.Context, chirps []Chirp, viewerID uuid.UUID) error {
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+	if len(chirpIDs) == 0 {
+		return nil
+	}
+
+	rows, err := cfg.DbPtr.GetLikeCounts(ctx, chirpIDs)
+	if err != nil {
+		return err
+	}
+	counts := map[uuid.UUID]int64{}
+	for _, row := range rows {
+		counts[row.ChirpID] = row.LikeCount
+	}
+	for i := range chirps {
+		chirps[i].LikeCount = counts[chirps[i].ID]
+	}
+
+	if viewerID == uuid.Nil {
+		return nil
+	}
+	likedIDs, err := cfg.DbPtr.GetLikedChirpIDs(ctx, database.GetLikedChirpIDsParams{
+		UserID:   viewerID,
+		ChirpIds: chirpIDs,
+	})
+	if err != nil {
+		return err
+	}
+	liked := map[uuid.UUID]bool{}
+	for _, id := range likedIDs {
+		liked[id] = true
+	}
+	for i := range chirps {
+		likedByMe := liked[chirps[i].ID]
+		chirps[i].LikedByMe = &likedByMe
+	}
+	return nil
+}
+
+// like a chirp the caller can see. Returns 201 Created with the chirp, or
+// 200 OK if they'd already liked it
+func (cfg *apiConfig) handlerLikeChirp(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	// liking a rechirp likes the chirp it shares
+	chirpDb, err := cfg.lookupOriginalChirp(r.Context(), chirpID, claims.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp", err)
+		return
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't like chirp", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	// the (user_id, chirp_id) primary key makes repeated and concurrent likes no-ops
+	liked, err := qtx.LikeChirp(r.Context(), database.LikeChirpParams{
+		UserID:  claims.UserID,
+		ChirpID: chirpDb.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't like chirp", err)
+		return
+	}
+	if liked > 0 {
+		err = cfg.notify(r.Context(), qtx, chirpDb.UserID, notificationLike, claims.UserID, uuid.NullUUID{UUID: chirpDb.ID, Valid: true})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't like chirp", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't like chirp", err)
+		return
+	}
+
+	chirps := []Chirp{newChirpResponse(chirpDb)}
+	if err := cfg.embedChirpDetails(r.Context(), chirps, claims.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp details", err)
+		return
+	}
+
+	status := http.StatusCreated
+	if liked == 0 {
+		status = http.StatusOK
+	}
+	respondWithJSON(w, status, chirps[0])
+}
+
+// take back a like. Returns 204 No Content, whether or not there was one
+func (cfg *apiConfig) handlerUnlikeChirp(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlike chirp", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	// unliking a rechirp unlikes the chirp it shares, like liking does
+	likedID, err := qtx.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		UserID:  claims.UserID,
+		ChirpID: chirpID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlike chirp", err)
+		return
+	}
+	if err := cfg.unnotify(r.Context(), qtx, uuid.NullUUID{}, notificationLike, claims.UserID, uuid.NullUUID{UUID: likedID, Valid: true}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlike chirp", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlike chirp", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// list the chirps a user liked, a page at a time. Private accounts' likes are
+// only shown to their accepted followers
+func (cfg *apiConfig) handlerGetUserLikes(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	userDb, err := cfg.lookupUser(r.Context(), r.PathValue("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+
+	allowed, err := cfg.canSeeAccount(r.Context(), claims.UserID, userDb)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve follow status", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "This account is private", fmt.Errorf("user %s can't see likes of private user %s", claims.UserID, userDb.ID))
+		return
+	}
+
+	rows, err := cfg.DbPtr.GetUserLikes(r.Context(), database.GetUserLikesParams{
+		UserID:     userDb.ID,
+		ViewerID:   claims.UserID,
+		CursorTime: cursor.Time,
+		CursorID:   cursor.ID,
+		PageSize:   limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve likes", err)
+		return
+	}
+
+	likes := make([]LikedChirp, 0, len(rows))
+	for _, row := range rows {
+		likes = append(likes, LikedChirp{
+			Chirp: newChirpResponse(database.Chirp{
+				ID:        row.ID,
+				CreatedAt: row.CreatedAt,
+				UpdatedAt: row.UpdatedAt,
+				Body:      row.Body,
+				UserID:    row.UserID,
+				InReplyTo: row.InReplyTo,
+				RootID:    row.RootID,
+				DeletedAt: row.DeletedAt,
+				RechirpOf: row.RechirpOf,
+				QuoteOf:   row.QuoteOf,
+			}),
+			LikedAt: row.LikedAt,
+		})
+	}
+	page := newPage(likes, limit, func(like LikedChirp) pageCursor {
+		return pageCursor{Time: like.LikedAt, ID: like.ID}
+	})
+
+	chirps := make([]Chirp, 0, len(page.Items))
+	for _, like := range page.Items {
+		chirps = append(chirps, like.Chirp)
+	}
+	if err := cfg.embedChirpDetails(r.Context(), chirps, claims.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp details", err)
+		return
+	}
+	if wantsAuthor(r) {
+		if err := cfg.embedAuthors(r.Context(), chirps); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp authors", err)
+			return
+		}
+	}
+	for i := range page.Items {
+		page.Items[i].Chirp = chirps[i]
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Likes are committed from separate connections here, so unlike the timeline
+// benchmarks this can't run inside a rolled back transaction; the users it
+// makes are deleted afterwards, taking their chirps and likes with them.
+func TestConcurrentLikes(t *testing.T) {
+	db := openTestDB(t)
+	q := database.New(db)
+	ctx := context.Background()
+
+	const likers = 20
+	const attemptsEach = 5
+
+	userIDs := createTestUsers(t, db, likers+1)
+	t.Cleanup(func() {
+		for _, id := range userIDs {
+			db.ExecContext(context.Background(), `DELETE FROM users WHERE id = $1`, id)
+		}
+	})
+
+	chirp, err := q.CreateChirp(ctx, database.CreateChirpParams{
+		Body:   "like me",
+		UserID: userIDs[0],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var created int64
+	for _, userID := range userIDs[1:] {
+		for range attemptsEach {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				liked, err := q.LikeChirp(ctx, database.LikeChirpParams{UserID: userID, ChirpID: chirp.ID})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				created += liked
+				mu.Unlock()
+			}()
+		}
+	}
+	wg.Wait()
+
+	if created != likers {
+		t.Errorf("%d likes were created, want %d", created, likers)
+	}
+	counts, err := q.GetLikeCounts(ctx, []uuid.UUID{chirp.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 1 || counts[0].LikeCount != likers {
+		t.Errorf("got like counts %+v, want %d", counts, likers)
+	}
+}
+
+// TestUnlikeThroughRechirp runs in a transaction that's rolled back afterwards
+func TestUnlikeThroughRechirp(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	q := database.New(tx)
+
+	userIDs := createTestUsers(t, tx, 2)
+	author, liker := userIDs[0], userIDs[1]
+
+	original, err := q.CreateChirp(ctx, database.CreateChirpParams{
+		Body:   "like me",
+		UserID: author,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rechirp, err := q.CreateRechirp(ctx, database.CreateRechirpParams{
+		UserID:    author,
+		RechirpOf: uuid.NullUUID{UUID: original.ID, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.LikeChirp(ctx, database.LikeChirpParams{UserID: liker, ChirpID: original.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	unliked, err := q.UnlikeChirp(ctx, database.UnlikeChirpParams{UserID: liker, ChirpID: rechirp.ID})
+	if err != nil {
+		t.Fatalf("UnlikeChirp() through the rechirp: %s", err)
+	}
+	if unliked != original.ID {
+		t.Errorf("UnlikeChirp() = %s, want the original %s", unliked, original.ID)
+	}
+	_, err = q.UnlikeChirp(ctx, database.UnlikeChirpParams{UserID: liker, ChirpID: original.ID})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("second UnlikeChirp() error = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -3,11 +3,20 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
 	"log"
 )
 
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = 60 * 24 * time.Hour
+)
+
 /* accepts a request body with the following shape and saves in UserRequestBody type (found in users.go)
 {
 	"password": "04234",
@@ -15,20 +24,63 @@ import (
 }
 */
 
+/* Returns 200 OK with the user and a fresh token pair
+{
+	"id": "5a47789c-a617-444a-8a80-b50359247804",
+	"created_at": "2021-07-01T00:00:00Z",
+	"updated_at": "2021-07-01T00:00:00Z",
+	"email": "lane@example.com",
+	"email_verified_at": null,
+	"token": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9...",
+	"refresh_token": "56aa826d22baab4b5ec2cea41a59ecbba03e542aedbb31d9b80326ac8ffcfa2a"
+}
+*/
+
+type LoginResponse struct {
+	User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
+	userDb, ok := cfg.checkPasswordLogin(w, r)
+	if !ok {
+		return
+	}
+
+	resp, err := cfg.issueTokenPair(r, userDb)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+		return
+	}
+
+	cfg.recordAuditEvent(r, userDb.ID, auditLogin, nil)
+
+	// Return user data (User type in users.go) with 200 OK
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// checkPasswordLogin decodes an email and password from the request body and
+// returns the user they belong to. It responds itself when they don't match.
+func (cfg *apiConfig) checkPasswordLogin(w http.ResponseWriter, r *http.Request) (database.User, bool) {
 	decoder := json.NewDecoder(r.Body)
 	reqBody := UserRequestBody{}
 	err := decoder.Decode(&reqBody)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode request body", err)
-		return		
+		return database.User{}, false
 	}
 
 	// Look up if user exists in database (by email)
 	userDb, err := cfg.DbPtr.GetUserByEmail(context.Background(), reqBody.Email)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Email doesn't appear in users database", err)
-		return
+		return database.User{}, false
+	}
+
+	if !userDb.PasswordLoginEnabled {
+		respondWithError(w, http.StatusUnauthorized, "Password login is turned off for this account; log in with a magic link", fmt.Errorf("password login disabled for user %s", userDb.ID))
+		return database.User{}, false
 	}
 
 	// check password against stored hash. reject if not (with 401 Unauthorized), accept if yes
@@ -38,16 +90,83 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	err = auth.CheckPasswordHash(stored_pwd, req_pwd)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Password doesn't match stored hash -- unauthorized", err)
-		return
+		return database.User{}, false
 	}
-	
-	// Return user data (User type in users.go) with 200 OK
-	user := User{
-		Id: userDb.ID,
-		Created_At: userDb.CreatedAt,
-		Updated_At: userDb.UpdatedAt,
-		Email: userDb.Email,
+
+	return userDb, true
+}
+
+// mint a refresh token, record the login as a session and hand back an
+// access token bound to that session
+func (cfg *apiConfig) issueTokenPair(r *http.Request, userDb database.User) (LoginResponse, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	// logging in during the grace period cancels a pending account deletion
+	cancelledDeletion := userDb.DeleteAfter.Valid
+	if cancelledDeletion {
+		userDb, err = qtx.CancelUserDeletion(r.Context(), userDb.ID)
+		if err != nil {
+			return LoginResponse{}, err
+		}
+	}
+
+	_, err = qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		UserID:    userDb.ID,
+		ExpiresAt: time.Now().UTC().Add(refreshTokenTTL),
+	})
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	session, err := qtx.CreateSession(r.Context(), database.CreateSessionParams{
+		UserID:           userDb.ID,
+		RefreshTokenHash: auth.HashToken(refreshToken),
+		UserAgent:        r.UserAgent(),
+		IpAddress:        cfg.clientIP(r),
+	})
+	if err != nil {
+		return LoginResponse{}, err
 	}
 
-	respondWithJSON(w, http.StatusOK, user)
-}
\ No newline at end of file
+	if err := tx.Commit(); err != nil {
+		return LoginResponse{}, err
+	}
+
+	if cancelledDeletion {
+		cfg.recordAuditEvent(r, userDb.ID, auditAccountDeletionCancelled, nil)
+	}
+
+	accessToken, err := cfg.makeAccessToken(userDb, session.ID, auth.DefaultScopes)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	return LoginResponse{
+		User:         newUserResponse(userDb),
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+func (cfg *apiConfig) makeAccessToken(userDb database.User, sessionID uuid.UUID, scopes []string) (string, error) {
+	opts := auth.TokenOptions{
+		Audience:   []string{cfg.TokenAudience},
+		Scopes:     scopes,
+		Generation: userDb.TokenGeneration,
+	}
+	if sessionID != uuid.Nil {
+		opts.SessionID = sessionID.String()
+	}
+	return auth.MakeJWT(userDb.ID, cfg.Keys, accessTokenTTL, opts)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+)
+
+// revoke the access token used to make this request. Returns 204 No Content
+func (cfg *apiConfig) handlerLogout(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	err := cfg.Revocations.Revoke(r.Context(), claims.TokenID, claims.UserID, claims.ExpiresAt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access token", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// log out everywhere: every refresh token is revoked and the token generation
+// is bumped so every access token issued so far stops working. Returns 204 No Content
+func (cfg *apiConfig) handlerLogoutAll(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	err := cfg.DbPtr.RevokeAllRefreshTokensForUser(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke refresh tokens", err)
+		return
+	}
+
+	_, err = cfg.Revocations.BumpGeneration(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	cfg.recordAuditEvent(r, claims.UserID, auditLogoutAll, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/mailer"
+)
+
+const (
+	magicLinkTTL = 15 * time.Minute
+	// at most magicLinkRateLimit links are mailed to one address per magicLinkRateWindow
+	magicLinkRateLimit  = 5
+	magicLinkRateWindow = time.Hour
+)
+
+/* Accepts a JSON body with the following shape
+	{
+		"email": "user@example.com"
+	}
+*/
+
+// email a login link. Always returns 202 so it can't be used to probe for accounts
+func (cfg *apiConfig) handlerMagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	reqBody := UserRequestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	// in the background, like password resets, so the response time doesn't
+	// give away whether the address has an account
+	go cfg.startMagicLinkLogin(context.Background(), reqBody.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// startMagicLinkLogin mails a login link if the address has an account
+func (cfg *apiConfig) startMagicLinkLogin(ctx context.Context, email string) {
+	userDb, err := cfg.DbPtr.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("Couldn't look up user for magic link: %s", err)
+		return
+	}
+	if err := cfg.sendMagicLinkEmail(ctx, userDb); err != nil {
+		log.Printf("Couldn't send magic link email: %s", err)
+	}
+}
+
+var errMagicLinkRateLimited = errors.New("too many magic links requested")
+
+func (cfg *apiConfig) sendMagicLinkEmail(ctx context.Context, user database.User) error {
+	// the rate limit lives in the database so it holds across replicas, and
+	// the lock makes checking it and adding a link one step
+	tx, err := cfg.DbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	if err := qtx.LockMagicLinkEmail(ctx, user.Email); err != nil {
+		return err
+	}
+	sent, err := qtx.CountMagicLinkTokensSince(ctx, database.CountMagicLinkTokensSinceParams{
+		Email:     user.Email,
+		CreatedAt: time.Now().UTC().Add(-magicLinkRateWindow),
+	})
+	if err != nil {
+		return err
+	}
+	if sent >= magicLinkRateLimit {
+		return fmt.Errorf("%w for %s", errMagicLinkRateLimited, user.Email)
+	}
+
+	token, tokenID, err := auth.MakeMagicLinkToken(user.ID, user.Email, cfg.JWTSecret, magicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	err = qtx.CreateMagicLinkToken(ctx, database.CreateMagicLinkTokenParams{
+		Jti:       tokenID,
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().UTC().Add(magicLinkTTL),
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/login/magic/callback?token=%s", cfg.BaseURL, url.QueryEscape(token))
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy login link",
+		Body:    fmt.Sprintf("Open the link below to log in to Chirpy. It expires in %s and can only be used once.\n\n%s\n\nIf you didn't ask for this, you can ignore this email.\n", magicLinkTTL, link),
+	})
+}
+
+// exchange a login link for the same token pair handlerLogin issues
+func (cfg *apiConfig) handlerMagicLinkCallback(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondWithError(w, http.StatusBadRequest, "No login token provided", fmt.Errorf("no login token provided"))
+		return
+	}
+
+	userID, email, tokenID, err := auth.ValidateMagicLinkToken(token, cfg.JWTSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Login link is invalid or expired", err)
+		return
+	}
+
+	// consuming is a single conditional UPDATE, so a link can only ever be used once
+	_, err = cfg.DbPtr.ConsumeMagicLinkToken(r.Context(), database.ConsumeMagicLinkTokenParams{
+		Jti:    tokenID,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "Login link is invalid, expired or already used", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up login link", err)
+		return
+	}
+
+	userDb, err := cfg.DbPtr.GetUserById(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Login link is invalid or expired", err)
+		return
+	}
+	// a link mailed to an old address mustn't log in after the email changes
+	if userDb.Email != email {
+		respondWithError(w, http.StatusUnauthorized, "Login link is invalid or expired", fmt.Errorf("login link was sent to a previous email address"))
+		return
+	}
+
+	resp, err := cfg.issueTokenPair(r, userDb)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+		return
+	}
+
+	cfg.recordAuditEvent(r, userDb.ID, auditLoginMagicLink, nil)
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// pruneMagicLinks deletes used and expired links once they no longer count
+// towards the rate limit
+func (cfg *apiConfig) pruneMagicLinks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pruned, err := cfg.DbPtr.DeleteMagicLinkTokensCreatedBefore(ctx, time.Now().UTC().Add(-magicLinkRateWindow))
+			if err != nil {
+				log.Printf("Couldn't prune magic links: %s", err)
+			} else if pruned > 0 {
+				log.Printf("Pruned %d old magic links", pruned)
+			}
+		}
+	}
+}
+
+/* Accepts a JSON body with the following shape
+	{
+		"enabled": false
+	}
+*/
+
+type PasswordLoginRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// turn password login on or off for the caller's account. Returns 200 OK with the user
+func (cfg *apiConfig) handlerSetPasswordLogin(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := PasswordLoginRequest{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	if reqBody.Enabled {
+		userDb, err := cfg.DbPtr.GetUserById(r.Context(), claims.UserID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't look up user", err)
+			return
+		}
+		if userDb.HashedPassword == "" {
+			respondWithError(w, http.StatusBadRequest, "Set a password with a password reset before enabling password login", fmt.Errorf("user %s has no password", claims.UserID))
+			return
+		}
+	}
+
+	userDb, err := cfg.DbPtr.SetPasswordLoginEnabled(r.Context(), database.SetPasswordLoginEnabledParams{
+		ID:                   claims.UserID,
+		PasswordLoginEnabled: reqBody.Enabled,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update password login", err)
+		return
+	}
+
+	cfg.recordAuditEvent(r, claims.UserID, auditPasswordLoginChanged, map[string]string{"enabled": strconv.FormatBool(reqBody.Enabled)})
+
+	respondWithJSON(w, http.StatusOK, newUserResponse(userDb))
+}
@@ -6,8 +6,16 @@ import (
 	"sync/atomic"
 	"os"
 	"database/sql"
+	"context"
 	"fmt"
+	"strconv"
+	"time"
+	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/blobstore"
 	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/mailer"
+	"github.com/benjaminafoster/chirpy/internal/revocation"
+	"github.com/benjaminafoster/chirpy/internal/stream"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -17,7 +25,35 @@ import (
 type apiConfig struct {
 	FileserverHits  atomic.Int32
 	DbPtr       *database.Queries
+	DbConn      *sql.DB
 	Platform    string
+	JWTSecret   string
+	// signs and verifies access tokens
+	Keys        auth.KeySet
+	TokenAudience string
+	// clock skew tolerated when validating access tokens
+	TokenLeeway time.Duration
+	Revocations *revocation.Store
+	BaseURL     string
+	Mailer      mailer.Mailer
+	// when set, X-Forwarded-For is trusted for client IPs
+	TrustProxyHeaders bool
+	// when set, users must verify their email before they can post chirps
+	RequireVerifiedEmail bool
+	// how long a deleted account can still be recovered by logging in
+	DeletionGracePeriod time.Duration
+	// where uploaded media is kept
+	Blobs       blobstore.BlobStore
+	// when set, chirps are copied into followers' timelines as they're posted
+	TimelineFanOutOnWrite bool
+	// the windows hashtags trend over; GET /api/trending defaults to the first
+	TrendingWindows []trendingWindow
+	// how many authors a tag needs before it can trend
+	TrendingMinAuthors int32
+	// fans stream events out to this replica's SSE subscribers
+	Stream      *stream.Hub
+	// shares the rendering of stream events between subscribers
+	StreamRenders *streamRenderCache
 }
 
 
@@ -26,6 +62,7 @@ func main() {
 	const filepathRoot = "."
 	const port = "8080"
 	godotenv.Load()
+	var err error
 	dbURL := os.Getenv("DB_URL")
 
 	platform := os.Getenv("PLATFORM")
@@ -33,6 +70,106 @@ func main() {
 		log.Fatal("Platform env variable must be set")
 	}
 
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		log.Fatal("JWT_SECRET env variable must be set")
+	}
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
+	}
+
+	tokenAudience := os.Getenv("JWT_AUDIENCE")
+	if tokenAudience == "" {
+		tokenAudience = "chirpy-api"
+	}
+
+	tokenLeeway := 30 * time.Second
+	if leeway := os.Getenv("JWT_LEEWAY"); leeway != "" {
+		tokenLeeway, err = time.ParseDuration(leeway)
+		if err != nil {
+			log.Fatalf("error parsing JWT_LEEWAY: %s", err)
+		}
+	}
+
+	revocationCacheTTL := 5 * time.Second
+	if ttl := os.Getenv("REVOCATION_CACHE_TTL"); ttl != "" {
+		revocationCacheTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("error parsing REVOCATION_CACHE_TTL: %s", err)
+		}
+	}
+
+	deletionGracePeriod := 30 * 24 * time.Hour
+	if grace := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD"); grace != "" {
+		deletionGracePeriod, err = time.ParseDuration(grace)
+		if err != nil {
+			log.Fatalf("error parsing ACCOUNT_DELETION_GRACE_PERIOD: %s", err)
+		}
+	}
+
+	requireVerified, _ := strconv.ParseBool(os.Getenv("REQUIRE_VERIFIED_EMAIL"))
+	trustProxyHeaders, _ := strconv.ParseBool(os.Getenv("TRUST_PROXY_HEADERS"))
+	timelineFanOutOnWrite, _ := strconv.ParseBool(os.Getenv("TIMELINE_FANOUT_ON_WRITE"))
+
+	trendingWindows, err := parseTrendingWindows("1h,24h")
+	if windows := os.Getenv("TRENDING_WINDOWS"); windows != "" {
+		trendingWindows, err = parseTrendingWindows(windows)
+	}
+	if err != nil {
+		log.Fatalf("error parsing TRENDING_WINDOWS: %s", err)
+	}
+
+	trendingMinAuthors := 3
+	if minAuthors := os.Getenv("TRENDING_MIN_AUTHORS"); minAuthors != "" {
+		trendingMinAuthors, err = strconv.Atoi(minAuthors)
+		if err != nil {
+			log.Fatalf("error parsing TRENDING_MIN_AUTHORS: %s", err)
+		}
+	}
+
+	trendingInterval := 5 * time.Minute
+	if interval := os.Getenv("TRENDING_INTERVAL"); interval != "" {
+		trendingInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("error parsing TRENDING_INTERVAL: %s", err)
+		}
+	}
+
+	mail, err := mailer.New(mailer.Config{
+		Transport:    mailer.Transport(os.Getenv("MAIL_TRANSPORT")),
+		From:         os.Getenv("MAIL_FROM"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     os.Getenv("SMTP_PORT"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		Dir:          os.Getenv("MAIL_DIR"),
+	})
+	if err != nil {
+		log.Fatalf("error configuring mailer: %s", err)
+	}
+
+	uploadDir := os.Getenv("UPLOAD_DIR")
+	if uploadDir == "" {
+		uploadDir = "./uploads"
+	}
+	s3PathStyle, _ := strconv.ParseBool(os.Getenv("S3_PATH_STYLE"))
+
+	blobs, err := blobstore.New(blobstore.Config{
+		Backend:           blobstore.Backend(os.Getenv("BLOB_STORE")),
+		Dir:               uploadDir,
+		S3Endpoint:        os.Getenv("S3_ENDPOINT"),
+		S3Region:          os.Getenv("S3_REGION"),
+		S3Bucket:          os.Getenv("S3_BUCKET"),
+		S3AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3PathStyle:       s3PathStyle,
+	})
+	if err != nil {
+		log.Fatalf("error configuring blob store: %s", err)
+	}
+
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		fmt.Printf("error connecting to postgres DB: %s", err)
@@ -41,20 +178,150 @@ func main() {
 
 	dbQueries := database.New(db)
 
-	apiCfg := apiConfig{FileserverHits: atomic.Int32{}, DbPtr: dbQueries, Platform: platform}
+	signingAlg := os.Getenv("JWT_SIGNING_ALG")
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "rotate-keys":
+			if err := runRotateKeys(os.Args[2:], dbQueries, signingAlg); err != nil {
+				log.Fatalf("error rotating signing keys: %s", err)
+			}
+		case "rebuild-timelines":
+			if err := runRebuildTimelines(db, dbQueries); err != nil {
+				log.Fatalf("error rebuilding timelines: %s", err)
+			}
+		case "grant-admin":
+			if err := runGrantAdmin(os.Args[2:], dbQueries); err != nil {
+				log.Fatalf("error granting admin: %s", err)
+			}
+		case "index-tags":
+			if err := runIndexTags(dbQueries); err != nil {
+				log.Fatalf("error indexing hashtags: %s", err)
+			}
+		default:
+			log.Fatalf("unknown command: %s", os.Args[1])
+		}
+		return
+	}
+
+	keys, err := newKeySet(context.Background(), signingAlg, jwtSecret, dbQueries)
+	if err != nil {
+		log.Fatalf("error loading signing keys: %s", err)
+	}
+
+	revocations := revocation.New(revocation.NewPostgresBackend(dbQueries), revocationCacheTTL, tokenLeeway)
+	go revocations.Run(context.Background(), time.Minute)
+
+	apiCfg := apiConfig{
+		FileserverHits:       atomic.Int32{},
+		DbPtr:                dbQueries,
+		DbConn:               db,
+		Platform:             platform,
+		JWTSecret:            jwtSecret,
+		Keys:                 keys,
+		TokenAudience:        tokenAudience,
+		TokenLeeway:          tokenLeeway,
+		Revocations:          revocations,
+		BaseURL:              baseURL,
+		Mailer:               mail,
+		RequireVerifiedEmail: requireVerified,
+		TrustProxyHeaders:    trustProxyHeaders,
+		DeletionGracePeriod:  deletionGracePeriod,
+		Blobs:                blobs,
+		TimelineFanOutOnWrite: timelineFanOutOnWrite,
+		TrendingWindows:      trendingWindows,
+		TrendingMinAuthors:   int32(trendingMinAuthors),
+		Stream:               stream.NewHub(streamBufferSize),
+		StreamRenders:        newStreamRenderCache(streamRenderCacheSize),
+	}
+
+	go apiCfg.pruneMagicLinks(context.Background(), time.Hour)
+	go apiCfg.purgeDeletedUsers(context.Background(), 10*time.Minute)
+	go apiCfg.processDataExports(context.Background(), time.Minute)
+	go apiCfg.processUploads(context.Background(), time.Minute)
+	go apiCfg.sweepUnusedUploads(context.Background(), 10*time.Minute)
+	go apiCfg.refreshTrending(context.Background(), trendingInterval)
+	go apiCfg.Stream.Listen(context.Background(), dbURL, dbQueries)
+	go apiCfg.pruneStreamEvents(context.Background(), 10*time.Minute)
 
-	fileserverHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
+	fileserverHandler := newAppFileServer(filepathRoot, uploadDir)
 
 	mux := http.NewServeMux()
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(fileserverHandler))
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
 	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
 	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
-	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetChirp)
-	mux.HandleFunc("POST /api/chirps", apiCfg.handlerCreateChirp)
+	mux.HandleFunc("GET /admin/trending/denylist", apiCfg.middlewareAdmin(apiCfg.handlerGetTrendingDenylist))
+	mux.HandleFunc("POST /admin/trending/denylist", apiCfg.middlewareAdmin(apiCfg.handlerDenyTrendingTag))
+	mux.HandleFunc("DELETE /admin/trending/denylist/{tag}", apiCfg.middlewareAdmin(apiCfg.handlerAllowTrendingTag))
+	mux.HandleFunc("GET /api/chirps", apiCfg.middlewareOptionalAuth(auth.ScopeChirpsRead, apiCfg.handlerGetChirps))
+	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.middlewareOptionalAuth(auth.ScopeChirpsRead, apiCfg.handlerGetChirp))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/replies", apiCfg.middlewareOptionalAuth(auth.ScopeChirpsRead, apiCfg.handlerGetChirpReplies))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerLikeChirp))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerUnlikeChirp))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerRechirp))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerUndoRechirp))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.middlewareOptionalAuth(auth.ScopeChirpsRead, apiCfg.handlerGetChirpThread))
+	mux.HandleFunc("POST /api/chirps", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerCreateChirp))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerDeleteChirp))
+	mux.HandleFunc("GET /api/timeline/home", apiCfg.middlewareAuth(auth.ScopeChirpsRead, apiCfg.handlerGetHomeTimeline))
+	mux.HandleFunc("GET /api/mentions", apiCfg.middlewareAuth(auth.ScopeChirpsRead, apiCfg.handlerGetMentions))
+	mux.HandleFunc("GET /api/notifications", apiCfg.middlewareAuth(auth.ScopeUserRead, apiCfg.handlerGetNotifications))
+	mux.HandleFunc("GET /api/notifications/unread-count", apiCfg.middlewareAuth(auth.ScopeUserRead, apiCfg.handlerGetUnreadNotificationCount))
+	mux.HandleFunc("POST /api/notifications/read", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerMarkAllNotificationsRead))
+	mux.HandleFunc("POST /api/notifications/{id}/read", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerMarkNotificationRead))
+	mux.HandleFunc("GET /api/stream/public", apiCfg.middlewareOptionalAuth(auth.ScopeChirpsRead, apiCfg.handlerStreamPublic))
+	mux.HandleFunc("GET /api/stream/home", apiCfg.middlewareAuth(auth.ScopeChirpsRead, apiCfg.handlerStreamHome))
+	mux.HandleFunc("GET /api/tags/{tag}/chirps", apiCfg.middlewareOptionalAuth(auth.ScopeChirpsRead, apiCfg.handlerGetTagChirps))
+	mux.HandleFunc("GET /api/trending", apiCfg.middlewareOptionalAuth(auth.ScopeChirpsRead, apiCfg.handlerGetTrending))
+	mux.HandleFunc("POST /api/uploads", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerCreateUpload))
+	mux.HandleFunc("GET /api/uploads/{uploadID}", apiCfg.middlewareAuth(auth.ScopeChirpsRead, apiCfg.handlerGetUpload))
+	mux.HandleFunc("GET /media/{hash}", apiCfg.handlerGetMedia)
 	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
+	mux.HandleFunc("DELETE /api/users", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerDeleteUser))
+	mux.HandleFunc("POST /api/users/export", apiCfg.middlewareAuth(auth.ScopeUserRead, apiCfg.handlerCreateDataExport))
+	mux.HandleFunc("GET /api/users/export", apiCfg.middlewareAuth(auth.ScopeUserRead, apiCfg.handlerGetDataExports))
+	mux.HandleFunc("GET /api/users/export/{exportID}", apiCfg.handlerDownloadDataExport)
+	mux.HandleFunc("GET /api/users/{handle}", apiCfg.middlewareOptionalAuth(auth.ScopeUserRead, apiCfg.handlerGetUserProfile))
+	mux.HandleFunc("POST /api/users/{id}/follow", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerFollow))
+	mux.HandleFunc("DELETE /api/users/{id}/follow", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerUnfollow))
+	mux.HandleFunc("POST /api/users/{id}/block", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerBlock))
+	mux.HandleFunc("DELETE /api/users/{id}/block", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerUnblock))
+	mux.HandleFunc("GET /api/users/{id}/{list}", apiCfg.handlerGetUserList)
+	mux.HandleFunc("GET /api/blocks", apiCfg.middlewareAuth(auth.ScopeUserRead, apiCfg.handlerGetBlocks))
+	mux.HandleFunc("GET /api/follow-requests", apiCfg.middlewareAuth(auth.ScopeUserRead, apiCfg.handlerGetFollowRequests))
+	mux.HandleFunc("POST /api/follow-requests/{id}/approve", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerApproveFollowRequest))
+	mux.HandleFunc("DELETE /api/follow-requests/{id}", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerRejectFollowRequest))
+	mux.HandleFunc("PUT /api/users/profile", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerUpdateProfile))
+	mux.HandleFunc("GET /api/users/verify", apiCfg.handlerVerifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.handlerResendVerification)
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/magic", apiCfg.handlerMagicLinkLogin)
+	mux.HandleFunc("GET /api/login/magic/callback", apiCfg.handlerMagicLinkCallback)
+	mux.HandleFunc("PUT /api/users/password-login", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerSetPasswordLogin))
+	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
+	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
+	mux.HandleFunc("POST /api/logout", apiCfg.middlewareAuth("", apiCfg.handlerLogout))
+	mux.HandleFunc("POST /api/logout/all", apiCfg.middlewareAuth("", apiCfg.handlerLogoutAll))
+	mux.HandleFunc("GET /api/sessions", apiCfg.middlewareAuth(auth.ScopeUserRead, apiCfg.handlerGetSessions))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerDeleteSession))
+	mux.HandleFunc("POST /api/keys", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerCreateAPIKey))
+	mux.HandleFunc("GET /api/keys", apiCfg.middlewareAuth(auth.ScopeUserRead, apiCfg.handlerGetAPIKeys))
+	mux.HandleFunc("GET /api/keys/{keyID}", apiCfg.middlewareAuth(auth.ScopeUserRead, apiCfg.handlerGetAPIKey))
+	mux.HandleFunc("PUT /api/keys/{keyID}", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerUpdateAPIKey))
+	mux.HandleFunc("DELETE /api/keys/{keyID}", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerDeleteAPIKey))
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerCreateOAuthClient))
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.middlewareAuth(auth.ScopeUserRead, apiCfg.handlerGetOAuthClients))
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.middlewareAuth(auth.ScopeUserWrite, apiCfg.handlerDeleteOAuthClient))
+	mux.HandleFunc("GET /oauth/clients/{clientID}", apiCfg.handlerGetOAuthClientInfo)
+	mux.HandleFunc("GET /oauth/authorize", apiCfg.handlerOAuthAuthorize)
+	mux.HandleFunc("POST /oauth/login", apiCfg.handlerOAuthLogin)
+	mux.HandleFunc("POST /oauth/authorize", apiCfg.middlewareAuth(auth.ScopeOAuthConsent, apiCfg.handlerOAuthAuthorizeDecision))
+	mux.HandleFunc("POST /oauth/token", apiCfg.handlerOAuthToken)
+	mux.HandleFunc("POST /oauth/introspect", apiCfg.handlerOAuthIntrospect)
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.handlerForgotPassword)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.handlerResetPassword)
 	
 	
 
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/handle"
+	"github.com/google/uuid"
+)
+
+/* Chirps list the users they @mention as "mentions"
+	"mentions": [
+		{
+			"user_id": "5a47789c-a617-444a-8a80-b50359247804",
+			"handle": "lane",
+			"start": 4,
+			"end": 9
+		}
+	]
+   "start" and "end" are code point offsets into "body", like hashtags', and
+   cover the whole "@lane". Mentions are resolved to users when the chirp is
+   posted, so they keep pointing at the same account if its handle changes;
+   "handle" is the current one. An @handle that doesn't belong to anyone, or
+   belongs to someone who has blocked the author, isn't a mention.
+
+   Mentioned users get a notification, and GET /api/mentions returns a page
+   (see Page in pagination.go) of the chirps mentioning the caller, newest first
+*/
+
+type Mention struct {
+	UserID uuid.UUID `json:"user_id"`
+	Handle string    `json:"handle"`
+	Start  int       `json:"start"`
+	End    int       `json:"end"`
+}
+
+// mentionMatch is an @handle in a chirp body, before it's resolved to a user
+type mentionMatch struct {
+	Handle string
+	Start  int
+	End    int
+}
+
+func isHandleRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_'
+}
+
+// parseMentions finds the @handles in a chirp body, in order. Like hashtags,
+// they can't be stuck to the end of a word, which rules out email addresses.
+func parseMentions(body string) []mentionMatch {
+	mentions := []mentionMatch{}
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || (i > 0 && (isTagRune(runes[i-1]) || runes[i-1] == '@')) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isHandleRune(runes[end]) {
+			end++
+		}
+		if length := end - i - 1; length >= handle.MinLength && length <= handle.MaxLength {
+			mentions = append(mentions, mentionMatch{
+				Handle: handle.Normalize(string(runes[i+1 : end])),
+				Start:  i,
+				End:    end,
+			})
+		}
+		i = end - 1
+	}
+	return mentions
+}
+
+// saveMentions resolves the @handles in a new chirp, stores them and notifies
+// the users mentioned. A private account's mentions only notify those who can
+// see its chirps.
+func (cfg *apiConfig) saveMentions(ctx context.Context, q *database.Queries, author database.User, chirp database.Chirp) error {
+	matches := parseMentions(chirp.Body)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	handles := []string{}
+	for _, match := range matches {
+		handles = append(handles, match.Handle)
+	}
+	users, err := q.ResolveMentions(ctx, database.ResolveMentionsParams{
+		Handles:  handles,
+		AuthorID: author.ID,
+	})
+	if err != nil {
+		return err
+	}
+	userIDs := map[string]uuid.UUID{}
+	for _, user := range users {
+		userIDs[handle.Normalize(user.Handle)] = user.ID
+	}
+
+	params := database.CreateChirpMentionsParams{
+		ChirpID:   chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+	}
+	notified := map[uuid.UUID]bool{}
+	for _, match := range matches {
+		userID, ok := userIDs[match.Handle]
+		if !ok {
+			continue
+		}
+		params.UserIds = append(params.UserIds, userID)
+		params.StartOffsets = append(params.StartOffsets, int32(match.Start))
+		params.EndOffsets = append(params.EndOffsets, int32(match.End))
+
+		if notified[userID] {
+			continue
+		}
+		notified[userID] = true
+		if err := cfg.notifyOfChirp(ctx, q, userID, notificationMention, author, chirp.ID); err != nil {
+			return err
+		}
+	}
+	if len(params.UserIds) == 0 {
+		return nil
+	}
+	return q.CreateChirpMentions(ctx, params)
+}
+
+// embedMentions fills in Mentions on each chirp with a single query for all of them
+func (cfg *apiConfig) embedMentions(ctx context.Context, chirps []Chirp) error {
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+	if len(chirpIDs) == 0 {
+		return nil
+	}
+
+	rows, err := cfg.DbPtr.GetChirpMentions(ctx, chirpIDs)
+	if err != nil {
+		return err
+	}
+	mentions := map[uuid.UUID][]Mention{}
+	for _, row := range rows {
+		mentions[row.ChirpID] = append(mentions[row.ChirpID], Mention{
+			UserID: row.UserID,
+			Handle: row.Handle,
+			Start:  int(row.StartOffset),
+			End:    int(row.EndOffset),
+		})
+	}
+
+	for i := range chirps {
+		if m, ok := mentions[chirps[i].ID]; ok {
+			chirps[i].Mentions = m
+		}
+	}
+	return nil
+}
+
+// list the chirps that mention the caller, newest first, a page at a time
+func (cfg *apiConfig) handlerGetMentions(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	chirpsDb, err := cfg.DbPtr.GetMentions(r.Context(), database.GetMentionsParams{
+		UserID:     claims.UserID,
+		CursorTime: cursor.Time,
+		CursorID:   cursor.ID,
+		PageSize:   limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve mentions", err)
+		return
+	}
+
+	chirps := make([]Chirp, 0, len(chirpsDb))
+	for _, chirp := range chirpsDb {
+		chirps = append(chirps, newChirpResponse(chirp))
+	}
+	page := newPage(chirps, limit, chirpCursor)
+
+	if err := cfg.embedChirpDetails(r.Context(), page.Items, claims.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp details", err)
+		return
+	}
+	if wantsAuthor(r) {
+		if err := cfg.embedAuthors(r.Context(), page.Items); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp authors", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
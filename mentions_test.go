@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []mentionMatch
+	}{
+		{
+			name: "None",
+			body: "Hello, world!",
+			want: []mentionMatch{},
+		},
+		{
+			name: "Several",
+			body: "hi @lane and @Allan_B!",
+			want: []mentionMatch{
+				{Handle: "lane", Start: 3, End: 8},
+				{Handle: "allan_b", Start: 13, End: 21},
+			},
+		},
+		{
+			name: "Offsets count code points",
+			body: "Grüße @lane",
+			want: []mentionMatch{
+				{Handle: "lane", Start: 6, End: 11},
+			},
+		},
+		{
+			name: "Email address",
+			body: "mail lane@example.com",
+			want: []mentionMatch{},
+		},
+		{
+			name: "Too short",
+			body: "@ab @",
+			want: []mentionMatch{},
+		},
+		{
+			name: "Too long",
+			body: "@abcdefghijklmnopqrstuvwxyz12345",
+			want: []mentionMatch{},
+		},
+		{
+			name: "Doubled at sign",
+			body: "@@lane",
+			want: []mentionMatch{},
+		},
+		{
+			name: "After punctuation",
+			body: "(@lane's)",
+			want: []mentionMatch{
+				{Handle: "lane", Start: 1, End: 6},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseMentions(tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMentions(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+type contextKey string
+
+const claimsContextKey contextKey = "claims"
+
+// middlewareAuth only lets through requests carrying a valid access token
+// with the given scope. Handlers read the caller with claimsFromContext.
+func (cfg *apiConfig) middlewareAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := cfg.authenticate(r)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate access token", err)
+			return
+		}
+
+		if scope != "" && !claims.HasScope(scope) {
+			respondWithError(w, http.StatusForbidden, "Access token is missing the "+scope+" scope", fmt.Errorf("token %s lacks scope %s", claims.TokenID, scope))
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims)))
+	}
+}
+
+// middlewareOptionalAuth lets anonymous requests through too, for endpoints
+// that show more to a logged-in caller. A token that's present but invalid is
+// still rejected rather than quietly treated as logged out. claimsFromContext
+// returns zero claims (UserID uuid.Nil) for anonymous callers.
+func (cfg *apiConfig) middlewareOptionalAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next(w, r)
+			return
+		}
+		cfg.middlewareAuth(scope, next)(w, r)
+	}
+}
+
+// middlewareAdmin only lets through users with is_admin set, logged in
+// themselves rather than through an API key or third-party app
+func (cfg *apiConfig) middlewareAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return cfg.middlewareAuth("", func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFromContext(r.Context())
+		if !requireFirstParty(w, claims) {
+			return
+		}
+
+		userDb, err := cfg.DbPtr.GetUserById(r.Context(), claims.UserID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+			return
+		}
+		if !userDb.IsAdmin {
+			respondWithError(w, http.StatusForbidden, "Only admins can do that", fmt.Errorf("user %s isn't an admin", claims.UserID))
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// authenticate resolves either "Bearer <jwt>" or "ApiKey <key>" to the
+// caller's claims, without requiring any scope
+func (cfg *apiConfig) authenticate(r *http.Request) (auth.Claims, error) {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "ApiKey ") {
+		return cfg.authenticateAPIKey(r)
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	return cfg.validateAccessToken(r.Context(), token)
+}
+
+// validateAccessToken checks signature and claims, then that the token
+// hasn't been revoked since it was issued
+func (cfg *apiConfig) validateAccessToken(ctx context.Context, token string) (auth.Claims, error) {
+	claims, err := auth.ValidateJWT(token, cfg.Keys, auth.ValidationOptions{
+		Audience: cfg.TokenAudience,
+		Leeway:   cfg.TokenLeeway,
+	})
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	revoked, err := cfg.Revocations.IsRevoked(ctx, claims.TokenID)
+	if err != nil {
+		return auth.Claims{}, fmt.Errorf("couldn't check token revocation: %w", err)
+	}
+	if revoked {
+		return auth.Claims{}, fmt.Errorf("token %s has been revoked", claims.TokenID)
+	}
+
+	if claims.SessionID != "" {
+		sessionID, err := uuid.Parse(claims.SessionID)
+		if err != nil {
+			return auth.Claims{}, fmt.Errorf("token %s has an invalid session: %w", claims.TokenID, err)
+		}
+		revoked, err := cfg.Revocations.IsSessionRevoked(ctx, sessionID)
+		if err != nil {
+			return auth.Claims{}, fmt.Errorf("couldn't check session revocation: %w", err)
+		}
+		if revoked {
+			return auth.Claims{}, fmt.Errorf("session %s has been signed out", sessionID)
+		}
+	}
+
+	generation, err := cfg.Revocations.Generation(ctx, claims.UserID)
+	if err != nil {
+		return auth.Claims{}, fmt.Errorf("couldn't check token generation: %w", err)
+	}
+	if claims.Generation < generation {
+		return auth.Claims{}, fmt.Errorf("token %s predates the user's last log out everywhere", claims.TokenID)
+	}
+
+	return claims, nil
+}
+
+// claimsFromContext returns the caller's claims inside a middlewareAuth handler
+func claimsFromContext(ctx context.Context) auth.Claims {
+	claims, _ := ctx.Value(claimsContextKey).(auth.Claims)
+	return claims
+}
+
+// requireFirstParty rejects callers using an API key or a token issued to a
+// third-party OAuth client. Account management needs the user's own login.
+func requireFirstParty(w http.ResponseWriter, claims auth.Claims) bool {
+	if claims.APIKeyID != uuid.Nil {
+		respondWithError(w, http.StatusForbidden, "This endpoint can't be used with an API key", fmt.Errorf("API key %s used on a first-party endpoint", claims.APIKeyID))
+		return false
+	}
+	if claims.ClientID != "" {
+		respondWithError(w, http.StatusForbidden, "This endpoint can't be used by third-party apps", fmt.Errorf("OAuth client %s used a first-party endpoint", claims.ClientID))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// someone followed the user. Requests to follow private accounts aren't
+	// notifications; they're listed at /api/follow-requests, and notified
+	// once they're approved
+	notificationFollow = "follow"
+	// someone liked one of the user's chirps
+	notificationLike = "like"
+	// someone replied to one of the user's chirps
+	notificationReply = "reply"
+	// someone @mentioned the user in a chirp
+	notificationMention = "mention"
+	// someone rechirped one of the user's chirps
+	notificationRechirp = "rechirp"
+)
+
+// groupedNotificationKinds are folded together per chirp in the inbox, as
+// in "5 people liked your chirp". Replies and mentions each stay separate.
+var groupedNotificationKinds = []string{notificationFollow, notificationLike, notificationRechirp}
+
+/* GET /api/notifications returns a page (see Page in pagination.go) of the
+   caller's notifications, newest first. ?unread=true leaves out the read ones
+	{
+		"id": "3f0f6b1e-8c0a-4b6e-9b1a-2d4c6e8f0a1b",
+		"kind": "like",
+		"chirp_id": "94b7e44c-3604-42e3-bef7-ebfcc3efff8f",
+		"actors": [
+			{
+				"id": "5a47789c-a617-444a-8a80-b50359247804",
+				"handle": "lane",
+				...
+			}
+		],
+		"actor_count": 5,
+		"summary": "5 people liked your chirp",
+		"unread": true,
+		"created_at": "2021-07-01T00:00:00Z"
+	}
+   "kind" is one of follow, like, reply, mention or rechirp. Follows, likes
+   and rechirps of the same chirp are grouped into one notification, kept
+   apart from any that were already read; "actors" lists the latest three and
+   "actor_count" says how many there are. "chirp_id" is the chirp that was
+   liked or rechirped, or the reply or mention itself, and null for follows.
+   "id" and "created_at" are the newest notification in the group.
+
+   GET /api/notifications/unread-count returns {"count": 7}, the number of
+   unread notifications before grouping. POST /api/notifications/{id}/read
+   marks one read, along with the older ones grouped with it, and
+   POST /api/notifications/read marks them all read.
+
+   Undoing a like, rechirp or follow takes its notification back. Blocking
+   someone deletes the notifications they caused, and they can't cause more.
+*/
+
+type Notification struct {
+	ID         uuid.UUID       `json:"id"`
+	Kind       string          `json:"kind"`
+	ChirpID    *uuid.UUID      `json:"chirp_id"`
+	Actors     []AuthorSummary `json:"actors"`
+	ActorCount int64           `json:"actor_count"`
+	Summary    string          `json:"summary"`
+	Unread     bool            `json:"unread"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type UnreadCountResponse struct {
+	Count int64 `json:"count"`
+}
+
+func notificationCursor(notification Notification) pageCursor {
+	return pageCursor{Time: notification.CreatedAt, ID: notification.ID}
+}
+
+// notificationSummary describes a notification in a sentence, naming the
+// actor when there's only one
+func notificationSummary(kind string, actors []AuthorSummary, actorCount int64) string {
+	var action string
+	switch kind {
+	case notificationFollow:
+		action = "followed you"
+	case notificationLike:
+		action = "liked your chirp"
+	case notificationReply:
+		action = "replied to your chirp"
+	case notificationMention:
+		action = "mentioned you"
+	case notificationRechirp:
+		action = "rechirped your chirp"
+	default:
+		action = kind
+	}
+	if actorCount == 1 && len(actors) == 1 {
+		return "@" + actors[0].Handle + " " + action
+	}
+	if actorCount == 1 {
+		return "Someone " + action
+	}
+	return fmt.Sprintf("%d people %s", actorCount, action)
+}
+
+// notify records that actorID did something the user should hear about.
+// It takes the caller's Queries so it happens in the same transaction as
+// the change. Notifying someone of their own actions, or of those of an
+// account they've blocked, does nothing.
+func (cfg *apiConfig) notify(ctx context.Context, q *database.Queries, userID uuid.UUID, kind string, actorID uuid.UUID, chirpID uuid.NullUUID) error {
+	notification, err := q.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:  userID,
+		Kind:    kind,
+		ActorID: actorID,
+		ChirpID: chirpID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return publishStreamEvent(ctx, q, streamEventNotification, userID, chirpID, uuid.NullUUID{UUID: notification.ID, Valid: true})
+}
+
+// notifyOfChirp is notify for a chirp the actor posted, such as a reply or a
+// rechirp. A private account's chirps only notify those who can see them.
+func (cfg *apiConfig) notifyOfChirp(ctx context.Context, q *database.Queries, userID uuid.UUID, kind string, author database.User, chirpID uuid.UUID) error {
+	canSee, err := cfg.canSeeAccount(ctx, userID, author)
+	if err != nil {
+		return err
+	}
+	if !canSee {
+		return nil
+	}
+	return cfg.notify(ctx, q, userID, kind, author.ID, uuid.NullUUID{UUID: chirpID, Valid: true})
+}
+
+// unnotify takes back the notification for something the actor has undone:
+// a like or rechirp of chirpID, or with no chirp, following userID
+func (cfg *apiConfig) unnotify(ctx context.Context, q *database.Queries, userID uuid.NullUUID, kind string, actorID uuid.UUID, chirpID uuid.NullUUID) error {
+	return q.DeleteNotification(ctx, database.DeleteNotificationParams{
+		Kind:    kind,
+		ActorID: actorID,
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+}
+
+// actorSummaries looks up the users behind notifications in one query
+func (cfg *apiConfig) actorSummaries(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]AuthorSummary, error) {
+	actors := map[uuid.UUID]AuthorSummary{}
+	if len(ids) == 0 {
+		return actors, nil
+	}
+	rows, err := cfg.DbPtr.GetAuthorSummaries(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		actors[row.ID] = AuthorSummary{
+			ID:          row.ID,
+			Handle:      row.Handle,
+			DisplayName: row.DisplayName,
+			AvatarURL:   row.AvatarUrl,
+		}
+	}
+	return actors, nil
+}
+
+// notificationResponse is a single notification, ungrouped, as the streams
+// send them
+func (cfg *apiConfig) notificationResponse(ctx context.Context, notification database.Notification) (Notification, error) {
+	actors, err := cfg.actorSummaries(ctx, []uuid.UUID{notification.ActorID})
+	if err != nil {
+		return Notification{}, err
+	}
+	resp := Notification{
+		ID:         notification.ID,
+		Kind:       notification.Kind,
+		ChirpID:    nullUUIDPtr(notification.ChirpID),
+		Actors:     []AuthorSummary{},
+		ActorCount: 1,
+		Unread:     !notification.ReadAt.Valid,
+		CreatedAt:  notification.CreatedAt,
+	}
+	if actor, ok := actors[notification.ActorID]; ok {
+		resp.Actors = append(resp.Actors, actor)
+	}
+	resp.Summary = notificationSummary(resp.Kind, resp.Actors, resp.ActorCount)
+	return resp, nil
+}
+
+// list the caller's notifications, grouped, newest first
+func (cfg *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	rows, err := cfg.DbPtr.GetNotificationGroups(r.Context(), database.GetNotificationGroupsParams{
+		UserID:       claims.UserID,
+		UnreadOnly:   r.URL.Query().Get("unread") == "true",
+		GroupedKinds: groupedNotificationKinds,
+		CursorTime:   cursor.Time,
+		CursorID:     cursor.ID,
+		PageSize:     limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve notifications", err)
+		return
+	}
+
+	actorIDs := []uuid.UUID{}
+	for _, row := range rows {
+		actorIDs = append(actorIDs, row.ActorIds...)
+	}
+	actors, err := cfg.actorSummaries(r.Context(), actorIDs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve notification actors", err)
+		return
+	}
+
+	notifications := make([]Notification, 0, len(rows))
+	for _, row := range rows {
+		notification := Notification{
+			ID:         row.ID,
+			Kind:       row.Kind,
+			ChirpID:    nullUUIDPtr(row.ChirpID),
+			Actors:     []AuthorSummary{},
+			ActorCount: row.ActorCount,
+			Unread:     row.Unread,
+			CreatedAt:  row.CreatedAt,
+		}
+		for _, id := range row.ActorIds {
+			if actor, ok := actors[id]; ok {
+				notification.Actors = append(notification.Actors, actor)
+			}
+		}
+		notification.Summary = notificationSummary(row.Kind, notification.Actors, row.ActorCount)
+		notifications = append(notifications, notification)
+	}
+
+	respondWithJSON(w, http.StatusOK, newPage(notifications, limit, notificationCursor))
+}
+
+func (cfg *apiConfig) handlerGetUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	count, err := cfg.DbPtr.CountUnreadNotifications(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count notifications", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, UnreadCountResponse{Count: count})
+}
+
+// mark a notification read, with the rest of its group. Returns 204 No
+// Content, whether or not it was unread
+func (cfg *apiConfig) handlerMarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	notificationID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid notification ID", err)
+		return
+	}
+
+	err = cfg.DbPtr.MarkNotificationGroupRead(r.Context(), database.MarkNotificationGroupReadParams{
+		ID:           notificationID,
+		UserID:       claims.UserID,
+		GroupedKinds: groupedNotificationKinds,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't mark notification read", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mark all the caller's notifications read. Returns 204 No Content
+func (cfg *apiConfig) handlerMarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	if err := cfg.DbPtr.MarkNotificationsRead(r.Context(), claims.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't mark notifications read", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
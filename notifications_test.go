@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestNotificationSummary(t *testing.T) {
+	lane := AuthorSummary{Handle: "lane"}
+	allan := AuthorSummary{Handle: "allan"}
+
+	tests := []struct {
+		name       string
+		kind       string
+		actors     []AuthorSummary
+		actorCount int64
+		want       string
+	}{
+		{
+			name:       "One actor",
+			kind:       notificationFollow,
+			actors:     []AuthorSummary{lane},
+			actorCount: 1,
+			want:       "@lane followed you",
+		},
+		{
+			name:       "Grouped",
+			kind:       notificationLike,
+			actors:     []AuthorSummary{lane, allan},
+			actorCount: 5,
+			want:       "5 people liked your chirp",
+		},
+		{
+			name:       "Actor not found",
+			kind:       notificationReply,
+			actors:     []AuthorSummary{},
+			actorCount: 1,
+			want:       "Someone replied to your chirp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := notificationSummary(tt.kind, tt.actors, tt.actorCount)
+			if got != tt.want {
+				t.Errorf("notificationSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNotificationGroups runs in a transaction that's rolled back afterwards
+func TestNotificationGroups(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	q := database.New(tx)
+	cfg := &apiConfig{DbPtr: q}
+
+	userIDs := createTestUsers(t, tx, 4)
+	recipient := userIDs[0]
+
+	chirp, err := q.CreateChirp(ctx, database.CreateChirpParams{
+		Body:   "like me",
+		UserID: recipient,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirpID := uuid.NullUUID{UUID: chirp.ID, Valid: true}
+	for _, liker := range userIDs[1:] {
+		if err := cfg.notify(ctx, q, recipient, notificationLike, liker, chirpID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cfg.notify(ctx, q, recipient, notificationFollow, userIDs[1], uuid.NullUUID{}); err != nil {
+		t.Fatal(err)
+	}
+	// nobody is notified of their own likes
+	if err := cfg.notify(ctx, q, recipient, notificationLike, recipient, chirpID); err != nil {
+		t.Fatal(err)
+	}
+	// taking back a like takes back its notification
+	if err := cfg.unnotify(ctx, q, uuid.NullUUID{}, notificationLike, userIDs[3], chirpID); err != nil {
+		t.Fatal(err)
+	}
+
+	getGroups := func() []database.GetNotificationGroupsRow {
+		t.Helper()
+		groups, err := q.GetNotificationGroups(ctx, database.GetNotificationGroupsParams{
+			UserID:       recipient,
+			GroupedKinds: groupedNotificationKinds,
+			CursorTime:   firstPage.Time,
+			CursorID:     firstPage.ID,
+			PageSize:     10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return groups
+	}
+
+	groups := getGroups()
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2: %+v", len(groups), groups)
+	}
+	var likes database.GetNotificationGroupsRow
+	for _, group := range groups {
+		if group.Kind == notificationLike {
+			likes = group
+		}
+	}
+	if likes.ActorCount != 2 || !likes.Unread || likes.ChirpID != chirpID {
+		t.Errorf("got like group %+v, want 2 unread actors on chirp %s", likes, chirp.ID)
+	}
+
+	err = q.MarkNotificationGroupRead(ctx, database.MarkNotificationGroupReadParams{
+		ID:           likes.ID,
+		UserID:       recipient,
+		GroupedKinds: groupedNotificationKinds,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unread, err := q.CountUnreadNotifications(ctx, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unread != 1 {
+		t.Errorf("got %d unread notifications after marking the likes read, want 1", unread)
+	}
+}
@@ -0,0 +1,695 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// OAuth 2.0 authorization code flow with PKCE (RFC 6749, RFC 7636), plus
+// token introspection (RFC 7662). Access tokens issued here are ordinary
+// chirpy JWTs carrying the granted scopes and a client_id claim, so
+// middlewareAuth accepts them like any other.
+
+const (
+	oauthCodeTTL         = 5 * time.Minute
+	oauthRefreshTokenTTL = 30 * 24 * time.Hour
+	oauthConsentPage     = "/app/oauth/consent.html"
+	// the consent page's own login only needs to last while the user decides
+	oauthConsentTokenTTL = 10 * time.Minute
+)
+
+/* Accepts a JSON body with the following shape
+	{
+		"name": "Chirp Scheduler",
+		"redirect_uris": ["https://scheduler.example.com/callback"],
+		"scopes": ["chirps:read", "chirps:write"],
+		"confidential": true
+	}
+*/
+
+type OAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	// confidential clients get a secret; public ones (SPAs, mobile apps) rely on PKCE alone
+	Confidential bool `json:"confidential"`
+}
+
+/* Returns clients in this shape. "client_secret" only appears in the response
+   to registration, and only for confidential clients
+	{
+		"client_id": "b5c0e1c4-9d8f-4b5e-8f0a-4cbb1b8f6d2e",
+		"name": "Chirp Scheduler",
+		"redirect_uris": ["https://scheduler.example.com/callback"],
+		"scopes": ["chirps:read", "chirps:write"],
+		"confidential": true,
+		"created_at": "2021-07-01T00:00:00Z",
+		"client_secret": "56aa826d..."
+	}
+*/
+
+type OAuthClient struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+func newOAuthClientResponse(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		Confidential: client.HashedSecret.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// redirect URIs must be absolute, fragment free, and https unless they point at localhost
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Fragment != "" || u.Host == "" {
+		return fmt.Errorf("redirect URI %q must be absolute and have no fragment", raw)
+	}
+	if u.Scheme == "https" {
+		return nil
+	}
+	if u.Scheme == "http" && (u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1") {
+		return nil
+	}
+	return fmt.Errorf("redirect URI %q must use https", raw)
+}
+
+// register a third-party client. Returns 201
+func (cfg *apiConfig) handlerCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := OAuthClientRequest{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	if reqBody.Name == "" || len(reqBody.RedirectURIs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Clients need a name and at least one redirect URI", fmt.Errorf("missing client name or redirect URIs"))
+		return
+	}
+	for _, uri := range reqBody.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+	if len(reqBody.Scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Clients need at least one scope", fmt.Errorf("missing client scopes"))
+		return
+	}
+	for _, scope := range reqBody.Scopes {
+		if !slices.Contains(auth.DefaultScopes, scope) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unknown scope %q", scope), fmt.Errorf("unknown scope %q", scope))
+			return
+		}
+	}
+
+	secret := ""
+	hashedSecret := sql.NullString{}
+	if reqBody.Confidential {
+		secret, err = auth.MakeOpaqueToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate client secret", err)
+			return
+		}
+		hashedSecret = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	clientDb, err := cfg.DbPtr.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      claims.UserID,
+		Name:         reqBody.Name,
+		HashedSecret: hashedSecret,
+		RedirectUris: reqBody.RedirectURIs,
+		Scopes:       reqBody.Scopes,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save OAuth client", err)
+		return
+	}
+
+	cfg.recordAuditEvent(r, claims.UserID, auditOAuthClientCreated, map[string]string{"client_id": clientDb.ID.String()})
+
+	resp := newOAuthClientResponse(clientDb)
+	resp.ClientSecret = secret
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+// list the clients the caller has registered
+func (cfg *apiConfig) handlerGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	clientsDb, err := cfg.DbPtr.GetOAuthClientsForOwner(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve OAuth clients", err)
+		return
+	}
+
+	clients := []OAuthClient{}
+	for _, client := range clientsDb {
+		clients = append(clients, newOAuthClientResponse(client))
+	}
+
+	respondWithJSON(w, http.StatusOK, clients)
+}
+
+// delete a client, along with its refresh tokens and authorization codes.
+// Access tokens already issued to it stay valid until they expire, at most
+// accessTokenTTL later. Returns 204 No Content
+func (cfg *apiConfig) handlerDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	deleted, err := cfg.DbPtr.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      clientID,
+		OwnerID: claims.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete OAuth client", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "OAuth client not found", fmt.Errorf("no OAuth client %s for user %s", clientID, claims.UserID))
+		return
+	}
+
+	cfg.recordAuditEvent(r, claims.UserID, auditOAuthClientDeleted, map[string]string{"client_id": clientID.String()})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/* Public details the consent page shows the user
+	{
+		"client_id": "b5c0e1c4-9d8f-4b5e-8f0a-4cbb1b8f6d2e",
+		"name": "Chirp Scheduler",
+		"scopes": ["chirps:read", "chirps:write"]
+	}
+*/
+
+type OAuthClientInfo struct {
+	ClientID uuid.UUID `json:"client_id"`
+	Name     string    `json:"name"`
+	Scopes   []string  `json:"scopes"`
+}
+
+func (cfg *apiConfig) handlerGetOAuthClientInfo(w http.ResponseWriter, r *http.Request) {
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	clientDb, err := cfg.DbPtr.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "OAuth client not found", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, OAuthClientInfo{
+		ClientID: clientDb.ID,
+		Name:     clientDb.Name,
+		Scopes:   clientDb.Scopes,
+	})
+}
+
+// authorizeRequest is the set of /oauth/authorize parameters, whether they
+// arrive as a query string (GET) or JSON from the consent page (POST)
+type authorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+// oauthError is an error that gets sent back to the client's redirect URI
+type oauthError struct {
+	Code        string
+	Description string
+}
+
+func (e oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// validate checks the client and redirect URI first: if either is wrong we
+// must not redirect anywhere. Everything else is reported to the redirect URI.
+func (cfg *apiConfig) validateAuthorizeRequest(r *http.Request, req authorizeRequest) (database.OauthClient, []string, error) {
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return database.OauthClient{}, nil, fmt.Errorf("invalid client_id: %w", err)
+	}
+	client, err := cfg.DbPtr.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, nil, fmt.Errorf("unknown client_id: %w", err)
+	}
+	if !slices.Contains(client.RedirectUris, req.RedirectURI) {
+		return database.OauthClient{}, nil, fmt.Errorf("redirect_uri %q isn't registered for this client", req.RedirectURI)
+	}
+
+	if req.ResponseType != "code" {
+		return client, nil, oauthError{"unsupported_response_type", "only the authorization code flow is supported"}
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != auth.PKCEMethodS256 {
+		return client, nil, oauthError{"invalid_request", "PKCE with code_challenge_method=S256 is required"}
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return client, nil, oauthError{"invalid_scope", fmt.Sprintf("scope %q isn't allowed for this client", scope)}
+		}
+	}
+
+	return client, scopes, nil
+}
+
+// oauthRedirect builds redirect_uri?params&state=...
+func oauthRedirect(redirectURI, state string, params url.Values) string {
+	if state != "" {
+		params.Set("state", state)
+	}
+	sep := "?"
+	if strings.Contains(redirectURI, "?") {
+		sep = "&"
+	}
+	return redirectURI + sep + params.Encode()
+}
+
+// start the flow: check the request, then send the user to the consent page
+func (cfg *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := authorizeRequest{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	}
+
+	_, _, err := cfg.validateAuthorizeRequest(r, req)
+	var oauthErr oauthError
+	if errors.As(err, &oauthErr) {
+		http.Redirect(w, r, oauthRedirect(req.RedirectURI, req.State, url.Values{
+			"error":             {oauthErr.Code},
+			"error_description": {oauthErr.Description},
+		}), http.StatusFound)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid authorization request", err)
+		return
+	}
+
+	http.Redirect(w, r, oauthConsentPage+"?"+r.URL.RawQuery, http.StatusFound)
+}
+
+/* Returns 200 OK with where the consent page should send the browser next
+	{
+		"redirect_to": "https://scheduler.example.com/callback?code=...&state=..."
+	}
+*/
+
+type AuthorizeDecisionResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// the consent page posts the user's decision here, authenticated as the user
+/* POST /oauth/login is the consent page's login. It takes the same body as
+   POST /api/login but starts no session: it returns only
+	{
+		"token": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
+	}
+   an access token good for ten minutes whose only scope is oauth:consent
+*/
+
+type OAuthConsentLoginResponse struct {
+	Token string `json:"token"`
+}
+
+func (cfg *apiConfig) handlerOAuthLogin(w http.ResponseWriter, r *http.Request) {
+	userDb, ok := cfg.checkPasswordLogin(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := auth.MakeJWT(userDb.ID, cfg.Keys, oauthConsentTokenTTL, auth.TokenOptions{
+		Audience:   []string{cfg.TokenAudience},
+		Scopes:     []string{auth.ScopeOAuthConsent},
+		Generation: userDb.TokenGeneration,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue token", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, OAuthConsentLoginResponse{Token: token})
+}
+
+func (cfg *apiConfig) handlerOAuthAuthorizeDecision(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if !requireFirstParty(w, claims) {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	req := authorizeRequest{}
+	err := decoder.Decode(&req)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	client, scopes, err := cfg.validateAuthorizeRequest(r, req)
+	var oauthErr oauthError
+	if errors.As(err, &oauthErr) {
+		respondWithJSON(w, http.StatusOK, AuthorizeDecisionResponse{RedirectTo: oauthRedirect(req.RedirectURI, req.State, url.Values{
+			"error":             {oauthErr.Code},
+			"error_description": {oauthErr.Description},
+		})})
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid authorization request", err)
+		return
+	}
+
+	if !req.Approve {
+		respondWithJSON(w, http.StatusOK, AuthorizeDecisionResponse{RedirectTo: oauthRedirect(req.RedirectURI, req.State, url.Values{
+			"error":             {"access_denied"},
+			"error_description": {"the user denied the request"},
+		})})
+		return
+	}
+
+	code, err := auth.MakeOpaqueToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate authorization code", err)
+		return
+	}
+
+	err = cfg.DbPtr.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:            auth.HashToken(code),
+		ClientID:            client.ID,
+		UserID:              claims.UserID,
+		RedirectUri:         req.RedirectURI,
+		Scopes:              scopes,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           time.Now().UTC().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save authorization code", err)
+		return
+	}
+
+	cfg.recordAuditEvent(r, claims.UserID, auditOAuthAuthorized, map[string]string{
+		"client_id": client.ID.String(),
+		"scope":     strings.Join(scopes, " "),
+	})
+
+	respondWithJSON(w, http.StatusOK, AuthorizeDecisionResponse{RedirectTo: oauthRedirect(req.RedirectURI, req.State, url.Values{
+		"code": {code},
+	})})
+}
+
+/* Token endpoint responses follow RFC 6749 section 5
+	{
+		"access_token": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9...",
+		"token_type": "Bearer",
+		"expires_in": 3600,
+		"refresh_token": "56aa826d...",
+		"scope": "chirps:read chirps:write"
+	}
+*/
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// respondWithOAuthError uses the RFC 6749 error shape rather than respondWithError's
+func respondWithOAuthError(w http.ResponseWriter, code int, errCode, description string, err error) {
+	if err != nil {
+		log.Println(err)
+	}
+	type oauthErrorResponse struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, code, oauthErrorResponse{Error: errCode, ErrorDescription: description})
+}
+
+// authenticateOAuthClient reads client credentials from HTTP Basic auth or
+// the form body. Public clients only send a client_id.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	clientIDString, secret, hasBasic := r.BasicAuth()
+	if !hasBasic {
+		clientIDString = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(clientIDString)
+	if err != nil {
+		return database.OauthClient{}, fmt.Errorf("invalid client_id: %w", err)
+	}
+	client, err := cfg.DbPtr.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, fmt.Errorf("unknown client_id: %w", err)
+	}
+
+	if client.HashedSecret.Valid {
+		if err := auth.CheckAPIKeySecret(client.HashedSecret.String, secret); err != nil {
+			return database.OauthClient{}, fmt.Errorf("bad client secret for %s", clientID)
+		}
+	}
+	return client, nil
+}
+
+// exchange an authorization code or refresh token for tokens
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "couldn't parse form body", err)
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed", err)
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		cfg.oauthAuthorizationCodeGrant(w, r, client)
+	case "refresh_token":
+		cfg.oauthRefreshTokenGrant(w, r, client)
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token", nil)
+	}
+}
+
+func (cfg *apiConfig) oauthAuthorizationCodeGrant(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	// consuming is a single conditional UPDATE, so a code can only ever be exchanged once
+	code, err := cfg.DbPtr.ConsumeOAuthAuthorizationCode(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "authorization code is invalid, expired or already used", err)
+		return
+	}
+
+	if code.ClientID != client.ID || code.RedirectUri != r.PostForm.Get("redirect_uri") {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "authorization code was issued to a different client or redirect_uri", nil)
+		return
+	}
+
+	if err := auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge, code.CodeChallengeMethod); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "PKCE verification failed", err)
+		return
+	}
+
+	cfg.respondWithOAuthTokens(w, r, client, code.UserID, code.Scopes)
+}
+
+func (cfg *apiConfig) oauthRefreshTokenGrant(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	// refresh tokens rotate: spending one is a single conditional UPDATE, so a
+	// token can only ever be exchanged once
+	refreshToken, err := cfg.DbPtr.RotateOAuthRefreshToken(r.Context(), database.RotateOAuthRefreshTokenParams{
+		TokenHash: auth.HashToken(r.PostForm.Get("refresh_token")),
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+	})
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "refresh token is invalid, expired or revoked", err)
+		return
+	}
+
+	cfg.respondWithOAuthTokens(w, r, client, refreshToken.UserID, refreshToken.Scopes)
+}
+
+func (cfg *apiConfig) respondWithOAuthTokens(w http.ResponseWriter, r *http.Request, client database.OauthClient, userID uuid.UUID, scopes []string) {
+	userDb, err := cfg.DbPtr.GetUserById(r.Context(), userID)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "user no longer exists", err)
+		return
+	}
+
+	accessToken, err := auth.MakeJWT(userDb.ID, cfg.Keys, accessTokenTTL, auth.TokenOptions{
+		Audience:   []string{cfg.TokenAudience},
+		Scopes:     scopes,
+		Generation: userDb.TokenGeneration,
+		ClientID:   client.ID.String(),
+	})
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "couldn't issue access token", err)
+		return
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "couldn't issue refresh token", err)
+		return
+	}
+
+	_, err = cfg.DbPtr.CreateOAuthRefreshToken(r.Context(), database.CreateOAuthRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		UserID:    userDb.ID,
+		ExpiresAt: time.Now().UTC().Add(oauthRefreshTokenTTL),
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:    scopes,
+	})
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "couldn't save refresh token", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	})
+}
+
+/* Introspection responses follow RFC 7662. Inactive tokens only get {"active": false}
+	{
+		"active": true,
+		"scope": "chirps:read chirps:write",
+		"client_id": "b5c0e1c4-9d8f-4b5e-8f0a-4cbb1b8f6d2e",
+		"sub": "5a47789c-a617-444a-8a80-b50359247804",
+		"aud": ["chirpy-api"],
+		"iss": "chirpy-access",
+		"jti": "0b8e6f34-...",
+		"token_type": "Bearer",
+		"exp": 1625101200,
+		"iat": 1625097600,
+		"nbf": 1625097600
+	}
+*/
+
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	TokenID   string   `json:"jti,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+}
+
+// let a confidential client (usually a resource server) ask about a token
+func (cfg *apiConfig) handlerOAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "couldn't parse form body", err)
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err == nil && !client.HashedSecret.Valid {
+		err = fmt.Errorf("public client %s can't introspect tokens", client.ID)
+	}
+	if err != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	claims, err := cfg.validateAccessToken(r.Context(), r.PostForm.Get("token"))
+	if err != nil {
+		respondWithJSON(w, http.StatusOK, IntrospectionResponse{Active: false})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(claims.Scopes, " "),
+		ClientID:  claims.ClientID,
+		Subject:   claims.UserID.String(),
+		Audience:  claims.Audience,
+		Issuer:    string(auth.TokenTypeAccess),
+		TokenID:   claims.TokenID,
+		TokenType: "Bearer",
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		IssuedAt:  claims.IssuedAt.Unix(),
+		NotBefore: claims.NotBefore.Unix(),
+	})
+}
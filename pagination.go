@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+/* Paginated endpoints return
+	{
+		"items": [...],
+		"next_cursor": "MTYyNTE4NDAwNTAwMDAwMF82YThh..."
+	}
+   Pass next_cursor back as ?cursor= for the next page; it's left out on the last one.
+   ?limit= sets the page size, up to 100 (default 20)
+*/
+
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// pageCursor points just past the last item of a page. Items are ordered
+// newest first by (Time, ID), with ID breaking ties.
+type pageCursor struct {
+	Time time.Time
+	ID   uuid.UUID
+}
+
+// firstPage sorts after every real item
+var firstPage = pageCursor{
+	Time: time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC),
+	ID:   uuid.Max,
+}
+
+func (c pageCursor) String() string {
+	raw := strconv.FormatInt(c.Time.UnixMicro(), 10) + "_" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parsePageCursor(s string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	micros, id, ok := strings.Cut(string(raw), "_")
+	if !ok {
+		return pageCursor{}, fmt.Errorf("invalid cursor")
+	}
+	t, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	cursorID, err := uuid.Parse(id)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return pageCursor{Time: time.UnixMicro(t).UTC(), ID: cursorID}, nil
+}
+
+// parsePage reads ?cursor= and ?limit=. Queries should fetch limit+1 rows so
+// newPage can tell whether there's another page.
+func parsePage(r *http.Request) (pageCursor, int32, error) {
+	cursor := firstPage
+	if s := r.URL.Query().Get("cursor"); s != "" {
+		var err error
+		cursor, err = parsePageCursor(s)
+		if err != nil {
+			return pageCursor{}, 0, err
+		}
+	}
+
+	limit := defaultPageSize
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return pageCursor{}, 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+	return cursor, int32(limit), nil
+}
+
+// newPage trims the extra row fetched past limit and turns it into a cursor
+func newPage[T any](items []T, limit int32, cursorOf func(T) pageCursor) Page[T] {
+	page := Page[T]{Items: items}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(items) > int(limit) {
+		page.Items = items[:limit]
+		page.NextCursor = cursorOf(page.Items[limit-1]).String()
+	}
+	return page
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/mailer"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+/* Accepts a JSON body with the following shape
+	{
+		"email": "user@example.com"
+	}
+*/
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// start a password reset. Always returns 202 so it can't be used to probe for accounts
+func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	reqBody := ForgotPasswordRequest{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	// in the background, so an address with an account takes no longer to
+	// answer than one without
+	go cfg.startPasswordReset(context.Background(), reqBody.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// startPasswordReset mails a reset link if the address has an account
+func (cfg *apiConfig) startPasswordReset(ctx context.Context, email string) {
+	userDb, err := cfg.DbPtr.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("Couldn't look up user for password reset: %s", err)
+		return
+	}
+	if err := cfg.sendPasswordResetEmail(ctx, userDb); err != nil {
+		log.Printf("Couldn't send password reset email: %s", err)
+	}
+}
+
+func (cfg *apiConfig) sendPasswordResetEmail(ctx context.Context, user database.User) error {
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	// only the hash is stored; the plaintext token only ever exists in the email
+	err = cfg.DbPtr.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/app/reset-password.html?token=%s", cfg.BaseURL, url.QueryEscape(token))
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body:    fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\nOpen the link below to choose a new one. It expires in %s and can only be used once.\n\n%s\n\nIf this wasn't you, you can ignore this email.\n", passwordResetTTL, link),
+	})
+}
+
+/* Accepts a JSON body with the following shape
+	{
+		"token": "56aa826d22baab4b5ec2cea41a59ecbba03e542aedbb31d9b80326ac8ffcfa2a",
+		"password": "new_password"
+	}
+*/
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// finish a password reset. Returns 204 No Content
+func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	reqBody := ResetPasswordRequest{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	if reqBody.Token == "" || reqBody.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Token and password are required", fmt.Errorf("missing token or password"))
+		return
+	}
+
+	hashedPwd, err := auth.HashPassword(reqBody.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	// consuming the token is a single conditional UPDATE, so two concurrent
+	// requests with the same token can't both succeed
+	userID, err := qtx.ConsumePasswordResetToken(r.Context(), auth.HashToken(reqBody.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Reset token is invalid, expired or already used", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up reset token", err)
+		return
+	}
+
+	userDb, err := qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPwd,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update password", err)
+		return
+	}
+
+	if err := qtx.InvalidatePasswordResetTokensForUser(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't invalidate reset tokens", err)
+		return
+	}
+
+	if err := qtx.RevokeAllRefreshTokensForUser(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke refresh tokens", err)
+		return
+	}
+
+	// outstanding access tokens die with the old generation
+	if _, err := qtx.IncrementTokenGeneration(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't commit password reset", err)
+		return
+	}
+
+	cfg.recordAuditEvent(r, userID, auditPasswordReset, nil)
+
+	err = cfg.Mailer.Send(r.Context(), mailer.Message{
+		To:      userDb.Email,
+		Subject: "Your Chirpy password was changed",
+		Body:    "The password for your Chirpy account was just changed and every device was signed out.\n\nIf this wasn't you, reset your password right away and contact support.\n",
+	})
+	if err != nil {
+		log.Printf("Couldn't send password changed notice: %s", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/handle"
+	"github.com/benjaminafoster/chirpy/internal/imaging"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarURLLength   = 2048
+	// the unique index on LOWER(handle), from the profiles migration
+	handleUniqueIndex = "users_handle_lower_idx"
+)
+
+/* Public profiles never include the email address or account settings
+	{
+		"id": "5a47789c-a617-444a-8a80-b50359247804",
+		"handle": "lane",
+		"display_name": "Lane Wagner",
+		"bio": "Writing Go and chirping about it",
+		"avatar_url": "https://example.com/lane.png",
+		"is_private": false,
+		"created_at": "2021-07-01T00:00:00Z"
+	}
+*/
+
+type PublicUser struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url"`
+	IsPrivate   bool      `json:"is_private"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newPublicUserResponse(user database.User) PublicUser {
+	return PublicUser{
+		ID:          user.ID,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarUrl,
+		IsPrivate:   user.IsPrivate,
+		CreatedAt:   user.CreatedAt,
+	}
+}
+
+/* GET /api/users/{handle} adds follow counts to the public profile, plus
+   "follow_status" ("accepted" or "pending") when the caller follows the user
+	{
+		"id": "5a47789c-a617-444a-8a80-b50359247804",
+		"handle": "lane",
+		...
+		"follower_count": 120,
+		"following_count": 48,
+		"follow_status": "accepted"
+	}
+*/
+
+type Profile struct {
+	PublicUser
+	FollowerCount  int64  `json:"follower_count"`
+	FollowingCount int64  `json:"following_count"`
+	FollowStatus   string `json:"follow_status,omitempty"`
+}
+
+/* The author summary embedded in chirps with ?expand=author
+	{
+		"id": "5a47789c-a617-444a-8a80-b50359247804",
+		"handle": "lane",
+		"display_name": "Lane Wagner",
+		"avatar_url": "https://example.com/lane.png"
+	}
+*/
+
+type AuthorSummary struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+}
+
+// get a public profile by handle, in any case
+func (cfg *apiConfig) handlerGetUserProfile(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	userDb, err := cfg.DbPtr.GetUserByHandle(r.Context(), handle.Normalize(r.PathValue("handle")))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+
+	counts, err := cfg.DbPtr.GetFollowCounts(r.Context(), userDb.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve follow counts", err)
+		return
+	}
+
+	profile := Profile{
+		PublicUser:     newPublicUserResponse(userDb),
+		FollowerCount:  counts.Followers,
+		FollowingCount: counts.Following,
+	}
+	if claims.UserID != uuid.Nil {
+		follow, err := cfg.DbPtr.GetFollow(r.Context(), database.GetFollowParams{
+			FollowerID: claims.UserID,
+			FolloweeID: userDb.ID,
+		})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve follow status", err)
+			return
+		}
+		profile.FollowStatus = follow.Status
+	}
+
+	respondWithJSON(w, http.StatusOK, profile)
+}
+
+// GET /api/users/{id}/followers, /following and /likes share one pattern,
+// since separate ones would conflict with GET /api/users/export/{exportID}
+func (cfg *apiConfig) handlerGetUserList(w http.ResponseWriter, r *http.Request) {
+	switch r.PathValue("list") {
+	case "followers":
+		cfg.middlewareOptionalAuth(auth.ScopeUserRead, cfg.handlerGetFollowers)(w, r)
+	case "following":
+		cfg.middlewareOptionalAuth(auth.ScopeUserRead, cfg.handlerGetFollowing)(w, r)
+	case "likes":
+		cfg.middlewareOptionalAuth(auth.ScopeChirpsRead, cfg.handlerGetUserLikes)(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+/* Accepts a JSON body with any of these fields; the ones left out keep their current value
+	{
+		"handle": "lane",
+		"display_name": "Lane Wagner",
+		"bio": "Writing Go and chirping about it",
+		"avatar_url": "https://example.com/lane.png",
+		"is_private": false
+	}
+   Making a private account public approves any pending follow requests.
+   Instead of "avatar_url", "avatar_upload_id" can name a processed image the
+   caller uploaded with POST /api/uploads; its thumbnail becomes the avatar
+*/
+
+type ProfileRequest struct {
+	Handle         *string    `json:"handle"`
+	DisplayName    *string    `json:"display_name"`
+	Bio            *string    `json:"bio"`
+	AvatarURL      *string    `json:"avatar_url"`
+	AvatarUploadID *uuid.UUID `json:"avatar_upload_id"`
+	IsPrivate      *bool      `json:"is_private"`
+}
+
+// update the caller's profile. Returns 200 OK with the user
+func (cfg *apiConfig) handlerUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := ProfileRequest{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	userDb, err := cfg.DbPtr.GetUserById(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up user", err)
+		return
+	}
+
+	params := database.UpdateUserProfileParams{
+		ID:             userDb.ID,
+		Handle:         userDb.Handle,
+		DisplayName:    userDb.DisplayName,
+		Bio:            userDb.Bio,
+		AvatarUrl:      userDb.AvatarUrl,
+		IsPrivate:      userDb.IsPrivate,
+		AvatarUploadID: userDb.AvatarUploadID,
+	}
+	if reqBody.Handle != nil {
+		params.Handle = *reqBody.Handle
+	}
+	if reqBody.DisplayName != nil {
+		params.DisplayName = *reqBody.DisplayName
+	}
+	if reqBody.Bio != nil {
+		params.Bio = *reqBody.Bio
+	}
+	if reqBody.AvatarURL != nil {
+		params.AvatarUrl = *reqBody.AvatarURL
+		params.AvatarUploadID = uuid.NullUUID{}
+	}
+	if reqBody.IsPrivate != nil {
+		params.IsPrivate = *reqBody.IsPrivate
+	}
+	if reqBody.AvatarUploadID != nil {
+		uploadDb, err := cfg.DbPtr.GetUpload(r.Context(), *reqBody.AvatarUploadID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && uploadDb.UserID != claims.UserID) {
+			respondWithError(w, http.StatusBadRequest, "Upload not found", fmt.Errorf("upload %s not found for user %s", *reqBody.AvatarUploadID, claims.UserID))
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't look up upload", err)
+			return
+		}
+		if uploadDb.Status != "ready" {
+			respondWithError(w, http.StatusConflict, "Upload hasn't finished processing", fmt.Errorf("upload %s is %s", uploadDb.ID, uploadDb.Status))
+			return
+		}
+		variantsDb, err := cfg.DbPtr.GetUploadVariants(r.Context(), uploadDb.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't look up upload", err)
+			return
+		}
+		for _, variant := range variantsDb {
+			if variant.Name == imaging.VariantThumbnail {
+				params.AvatarUrl = cfg.mediaURL(variant.Sha256)
+				params.AvatarUploadID = uuid.NullUUID{UUID: uploadDb.ID, Valid: true}
+			}
+		}
+	}
+
+	if err := validateProfile(params); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update profile", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	if params.AvatarUploadID.Valid {
+		err := lockUploads(r.Context(), qtx, []uuid.UUID{params.AvatarUploadID.UUID})
+		var invalidAttachment errInvalidAttachment
+		if errors.As(err, &invalidAttachment) {
+			respondWithError(w, http.StatusBadRequest, invalidAttachment.Error(), err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't look up upload", err)
+			return
+		}
+	}
+
+	userDb, err = qtx.UpdateUserProfile(r.Context(), params)
+	if isUniqueViolation(err, handleUniqueIndex) {
+		respondWithError(w, http.StatusConflict, "Handle is already taken", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update profile", err)
+		return
+	}
+
+	// nobody has to approve follows of a public account, including the ones waiting
+	if !userDb.IsPrivate {
+		followerIDs, err := qtx.AcceptAllFollowRequests(r.Context(), userDb.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't approve pending follow requests", err)
+			return
+		}
+		for _, followerID := range followerIDs {
+			if err := cfg.timelineFollowed(r.Context(), qtx, followerID, userDb.ID); err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't update timelines", err)
+				return
+			}
+		}
+		// each is a new follower now, as if they'd just followed
+		for _, followerID := range followerIDs {
+			if err := cfg.notify(r.Context(), qtx, userDb.ID, notificationFollow, followerID, uuid.NullUUID{}); err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't approve pending follow requests", err)
+				return
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update profile", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newUserResponse(userDb))
+}
+
+func validateProfile(params database.UpdateUserProfileParams) error {
+	if err := handle.Validate(params.Handle); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(params.DisplayName) > maxDisplayNameLength {
+		return fmt.Errorf("display_name can be at most %d characters", maxDisplayNameLength)
+	}
+	if utf8.RuneCountInString(params.Bio) > maxBioLength {
+		return fmt.Errorf("bio can be at most %d characters", maxBioLength)
+	}
+	if params.AvatarUrl != "" {
+		if len(params.AvatarUrl) > maxAvatarURLLength {
+			return fmt.Errorf("avatar_url can be at most %d characters", maxAvatarURLLength)
+		}
+		u, err := url.Parse(params.AvatarUrl)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("avatar_url must be an absolute http(s) URL")
+		}
+	}
+	return nil
+}
+
+// embedAuthors fills in Author on each chirp, and on any chirp it rechirps or
+// quotes, with a single query for all of them
+func (cfg *apiConfig) embedAuthors(ctx context.Context, chirps []Chirp) error {
+	ids := []uuid.UUID{}
+	seen := map[uuid.UUID]bool{}
+	for _, chirp := range chirps {
+		userIDs := []uuid.UUID{chirp.UserID}
+		if chirp.Referenced != nil && !chirp.Referenced.Deleted {
+			userIDs = append(userIDs, chirp.Referenced.UserID)
+		}
+		for _, userID := range userIDs {
+			if !seen[userID] {
+				seen[userID] = true
+				ids = append(ids, userID)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := cfg.DbPtr.GetAuthorSummaries(ctx, ids)
+	if err != nil {
+		return err
+	}
+	authors := make(map[uuid.UUID]*AuthorSummary, len(rows))
+	for _, row := range rows {
+		authors[row.ID] = &AuthorSummary{
+			ID:          row.ID,
+			Handle:      row.Handle,
+			DisplayName: row.DisplayName,
+			AvatarURL:   row.AvatarUrl,
+		}
+	}
+
+	for i := range chirps {
+		chirps[i].Author = authors[chirps[i].UserID]
+		if ref := chirps[i].Referenced; ref != nil && !ref.Deleted {
+			ref.Author = authors[ref.UserID]
+		}
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err came from the named unique index
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
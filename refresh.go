@@ -0,0 +1,71 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/database"
+)
+
+/* Expects the refresh token in the header: "Authorization: Bearer <refresh_token>"
+   Returns 200 OK with a new access token
+	{
+		"token": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
+	}
+*/
+
+type RefreshResponse struct {
+	Token string `json:"token"`
+}
+
+// exchange a refresh token for a new access token
+func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find refresh token", err)
+		return
+	}
+
+	userDb, err := cfg.DbPtr.GetUserFromRefreshToken(r.Context(), auth.HashToken(refreshToken))
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token is invalid, expired or revoked", err)
+		return
+	}
+
+	// tokens issued before sessions existed have no session row; that's fine
+	session, err := cfg.DbPtr.TouchSession(r.Context(), database.TouchSessionParams{
+		RefreshTokenHash: auth.HashToken(refreshToken),
+		IpAddress:        cfg.clientIP(r),
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update session", err)
+		return
+	}
+
+	accessToken, err := cfg.makeAccessToken(userDb, session.ID, auth.DefaultScopes)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create access token", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, RefreshResponse{Token: accessToken})
+}
+
+// revoke a refresh token. Returns 204 No Content
+func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find refresh token", err)
+		return
+	}
+
+	err = cfg.DbPtr.RevokeRefreshToken(r.Context(), auth.HashToken(refreshToken))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke refresh token", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+/* POST /api/chirps/{chirpID}/rechirp shares a chirp on the caller's timeline,
+   and DELETE takes it back. A rechirp is a chirp of the caller's own with an
+   empty body and "rechirp_of" set, and comes back as
+	{
+		"id": "0f9e8d7c-...",
+		"body": "",
+		"user_id": "123e4567-...",
+		"rechirp_of": "94b7e44c-...",
+		"referenced_chirp": {
+			"id": "94b7e44c-...",
+			"body": "Hello, world!",
+			...
+		},
+		...
+	}
+   Quotes are posted with "quote_of" in POST /api/chirps and embed the quoted
+   chirp the same way. Rechirping, quoting, replying to or liking a rechirp
+   acts on the chirp it shares.
+
+   Rechirps are deleted along with the chirp they share. Quotes aren't, so
+   their "referenced_chirp" becomes a tombstone (see threads.go), as it is
+   when the viewer can't see the quoted chirp. Chirps from private accounts
+   can only be rechirped by their authors.
+*/
+
+// lookupOriginalChirp finds a chirp the viewer can see, or the chirp it
+// shares if it's a rechirp
+func (cfg *apiConfig) lookupOriginalChirp(ctx context.Context, chirpID, viewerID uuid.UUID) (database.Chirp, error) {
+	chirpDb, err := cfg.DbPtr.GetChirpByID(ctx, database.GetChirpByIDParams{
+		ID:       chirpID,
+		ViewerID: viewerID,
+	})
+	if err != nil || !chirpDb.RechirpOf.Valid {
+		return chirpDb, err
+	}
+	return cfg.DbPtr.GetChirpByID(ctx, database.GetChirpByIDParams{
+		ID:       chirpDb.RechirpOf.UUID,
+		ViewerID: viewerID,
+	})
+}
+
+// embedRepostCounts fills in RechirpCount and QuoteCount on each chirp with a
+// single query for all of them
+func (cfg *apiConfig) embedRepostCounts(ctx context.Context, chirps []Chirp) error {
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+	if len(chirpIDs) == 0 {
+		return nil
+	}
+
+	rows, err := cfg.DbPtr.GetRepostCounts(ctx, chirpIDs)
+	if err != nil {
+		return err
+	}
+	counts := map[uuid.UUID]database.GetRepostCountsRow{}
+	for _, row := range rows {
+		counts[row.ChirpID] = row
+	}
+
+	for i := range chirps {
+		chirps[i].RechirpCount = counts[chirps[i].ID].RechirpCount
+		chirps[i].QuoteCount = counts[chirps[i].ID].QuoteCount
+	}
+	return nil
+}
+
+// embedReferencedChirps fills in Referenced on rechirps and quotes with the
+// chirp they point at and its details, or a tombstone when it's gone or the
+// viewer can't see it. Only one level is embedded; a quote of a quote just
+// has the inner quote's "quote_of".
+func (cfg *apiConfig) embedReferencedChirps(ctx context.Context, chirps []Chirp, viewerID uuid.UUID) error {
+	chirpIDs := []uuid.UUID{}
+	for _, chirp := range chirps {
+		if ref := referencedID(chirp); ref != nil {
+			chirpIDs = append(chirpIDs, *ref)
+		}
+	}
+	if len(chirpIDs) == 0 {
+		return nil
+	}
+
+	rows, err := cfg.DbPtr.GetReferencedChirps(ctx, database.GetReferencedChirpsParams{
+		ViewerID: viewerID,
+		ChirpIds: chirpIDs,
+	})
+	if err != nil {
+		return err
+	}
+	visible := []Chirp{}
+	tombstones := map[uuid.UUID]Chirp{}
+	for _, row := range rows {
+		chirp := threadChirp(database.Chirp{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Body:      row.Body,
+			UserID:    row.UserID,
+			InReplyTo: row.InReplyTo,
+			RootID:    row.RootID,
+			DeletedAt: row.DeletedAt,
+			RechirpOf: row.RechirpOf,
+			QuoteOf:   row.QuoteOf,
+		}, row.Visible)
+		if chirp.Deleted {
+			tombstones[chirp.ID] = chirp
+		} else {
+			visible = append(visible, chirp)
+		}
+	}
+	if err := cfg.embedOwnChirpDetails(ctx, visible, viewerID); err != nil {
+		return err
+	}
+	byID := tombstones
+	for _, chirp := range visible {
+		byID[chirp.ID] = chirp
+	}
+
+	for i := range chirps {
+		ref := referencedID(chirps[i])
+		if ref == nil {
+			continue
+		}
+		referenced, ok := byID[*ref]
+		if !ok {
+			referenced = newTombstoneResponse(*ref, uuid.NullUUID{}, uuid.NullUUID{})
+		}
+		chirps[i].Referenced = &referenced
+	}
+	return nil
+}
+
+// referencedID is the chirp a rechirp or quote points at, or nil
+func referencedID(chirp Chirp) *uuid.UUID {
+	if chirp.Deleted {
+		return nil
+	}
+	if chirp.RechirpOf != nil {
+		return chirp.RechirpOf
+	}
+	return chirp.QuoteOf
+}
+
+// rechirp a chirp the caller can see. Returns 201 Created with the rechirp,
+// or 200 OK with the existing one if they'd already rechirped it
+func (cfg *apiConfig) handlerRechirp(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	userDb, err := cfg.DbPtr.GetUserById(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "User does not exist in user database", err)
+		return
+	}
+	if cfg.RequireVerifiedEmail && !userDb.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Email must be verified before posting chirps", fmt.Errorf("user %s has not verified their email", claims.UserID))
+		return
+	}
+
+	originalDb, err := cfg.lookupOriginalChirp(r.Context(), chirpID, claims.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp", err)
+		return
+	}
+
+	// a rechirp would show a private account's chirp to the rechirper's followers
+	if originalDb.UserID != claims.UserID {
+		authorDb, err := cfg.DbPtr.GetUserById(r.Context(), originalDb.UserID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp author", err)
+			return
+		}
+		if authorDb.IsPrivate {
+			respondWithError(w, http.StatusForbidden, "Chirps from private accounts can't be rechirped", fmt.Errorf("user %s can't rechirp private chirp %s", claims.UserID, originalDb.ID))
+			return
+		}
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rechirp chirp", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	status := http.StatusCreated
+	rechirpOf := uuid.NullUUID{UUID: originalDb.ID, Valid: true}
+	rechirpDb, err := qtx.CreateRechirp(r.Context(), database.CreateRechirpParams{
+		UserID:    claims.UserID,
+		RechirpOf: rechirpOf,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		status = http.StatusOK
+		rechirpDb, err = qtx.GetRechirp(r.Context(), database.GetRechirpParams{
+			UserID:    claims.UserID,
+			RechirpOf: rechirpOf,
+		})
+	} else if err == nil {
+		err = cfg.timelineChirped(r.Context(), qtx, rechirpDb.ID)
+		if err == nil {
+			err = cfg.notifyOfChirp(r.Context(), qtx, originalDb.UserID, notificationRechirp, userDb, originalDb.ID)
+		}
+		if err == nil {
+			err = publishStreamEvent(r.Context(), qtx, streamEventChirp, claims.UserID, uuid.NullUUID{UUID: rechirpDb.ID, Valid: true}, uuid.NullUUID{})
+		}
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rechirp chirp", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rechirp chirp", err)
+		return
+	}
+
+	chirps := []Chirp{newChirpResponse(rechirpDb)}
+	if err := cfg.embedChirpDetails(r.Context(), chirps, claims.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp details", err)
+		return
+	}
+
+	respondWithJSON(w, status, chirps[0])
+}
+
+// take back a rechirp. {chirpID} can be the original or the rechirp itself.
+// Returns 204 No Content, whether or not there was one
+func (cfg *apiConfig) handlerUndoRechirp(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't undo rechirp", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	rechirpDb, err := qtx.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:  claims.UserID,
+		ChirpID: chirpID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't undo rechirp", err)
+		return
+	}
+	if err := cfg.unnotify(r.Context(), qtx, uuid.NullUUID{}, notificationRechirp, claims.UserID, rechirpDb.RechirpOf); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't undo rechirp", err)
+		return
+	}
+	if err := publishStreamEvent(r.Context(), qtx, streamEventDelete, claims.UserID, uuid.NullUUID{UUID: rechirpDb.ID, Valid: true}, uuid.NullUUID{}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't undo rechirp", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't undo rechirp", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
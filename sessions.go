@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+/* Returns 200 OK with every device the user is signed in on, most recently used first
+	[
+		{
+			"id": "0c9d2fb1-7b0a-4a57-9a43-0c3c0a0f6b7e",
+			"user_agent": "Mozilla/5.0 ...",
+			"ip_address": "203.0.113.7",
+			"created_at": "2021-07-01T00:00:00Z",
+			"last_used_at": "2021-07-02T00:00:00Z",
+			"current": true
+		}
+	]
+*/
+
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	// true for the session the request's access token belongs to
+	Current bool `json:"current"`
+}
+
+// list the caller's active sessions
+func (cfg *apiConfig) handlerGetSessions(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	sessionsDb, err := cfg.DbPtr.GetActiveSessionsForUser(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve sessions", err)
+		return
+	}
+
+	sessions := []Session{}
+	for _, session := range sessionsDb {
+		sessions = append(sessions, Session{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    session.ID.String() == claims.SessionID,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+// sign a device out by revoking its refresh token and the access tokens
+// minted for it. Returns 204 No Content
+func (cfg *apiConfig) handlerDeleteSession(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID", err)
+		return
+	}
+
+	revoked, err := cfg.DbPtr.RevokeSession(r.Context(), database.RevokeSessionParams{
+		ID:     sessionID,
+		UserID: claims.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Session not found", fmt.Errorf("no active session %s for user %s", sessionID, claims.UserID))
+		return
+	}
+
+	// the device's access tokens would otherwise keep working until they
+	// expire, and none outlives accessTokenTTL plus the leeway they're
+	// accepted for after that
+	if err := cfg.Revocations.RevokeSession(r.Context(), sessionID, claims.UserID, time.Now().UTC().Add(accessTokenTTL+cfg.TokenLeeway)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	cfg.recordAuditEvent(r, claims.UserID, auditSessionRevoked, map[string]string{"session_id": sessionID.String()})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clientIP is the address recorded against a session. X-Forwarded-For is
+// only trusted when chirpy is configured to sit behind a proxy.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.TrustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
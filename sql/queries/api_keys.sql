@@ -0,0 +1,38 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, user_id, name, prefix, hashed_secret, scopes, created_at, updated_at, expires_at, token_generation)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW(),
+    NOW(),
+    $6,
+    (SELECT token_generation FROM users WHERE id = $1)
+)
+RETURNING *;
+
+-- name: GetAPIKeyByPrefix :one
+SELECT api_keys.* FROM api_keys
+JOIN users ON users.id = api_keys.user_id
+WHERE api_keys.prefix = $1 AND users.delete_after IS NULL;
+
+-- name: GetAPIKeysForUser :many
+SELECT * FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC;
+
+-- name: GetAPIKeyForUser :one
+SELECT * FROM api_keys WHERE id = $1 AND user_id = $2;
+
+-- name: UpdateAPIKey :one
+UPDATE api_keys SET name = $3, scopes = $4, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteAPIKey :execrows
+DELETE FROM api_keys WHERE id = $1 AND user_id = $2;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
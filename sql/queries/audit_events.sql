@@ -0,0 +1,14 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (id, user_id, event, ip_address, user_agent, metadata, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW()
+);
+
+-- name: GetAuditEventsForUser :many
+SELECT * FROM audit_events WHERE user_id = $1 ORDER BY created_at ASC;
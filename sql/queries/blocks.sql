@@ -0,0 +1,33 @@
+-- name: CreateBlock :execrows
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (blocker_id, blocked_id) DO NOTHING;
+
+-- name: GetBlock :one
+SELECT * FROM blocks WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: DeleteBlock :exec
+DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: IsBlocked :one
+SELECT EXISTS (SELECT 1 FROM blocks WHERE blocker_id = $1 AND blocked_id = $2);
+
+-- name: GetBlockedUsers :many
+-- newest first, starting after the (blocked_at, id) cursor
+SELECT users.id, users.handle, users.display_name, users.bio, users.avatar_url, users.is_private, users.created_at, blocks.created_at AS blocked_at
+FROM blocks
+JOIN users ON users.id = blocks.blocked_id
+WHERE blocks.blocker_id = sqlc.arg(user_id)
+AND users.delete_after IS NULL
+AND (blocks.created_at, blocks.blocked_id) < (sqlc.arg(cursor_time)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY blocks.created_at DESC, blocks.blocked_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: DeleteFollowsBetween :exec
+-- removes follows and follow requests between two users, either way round
+DELETE FROM follows
+WHERE (follower_id = sqlc.arg(user_id) AND followee_id = sqlc.arg(other_id))
+OR (follower_id = sqlc.arg(other_id) AND followee_id = sqlc.arg(user_id));
+
+-- name: GetBlocksForUser :many
+SELECT * FROM blocks WHERE blocker_id = $1 ORDER BY created_at ASC;
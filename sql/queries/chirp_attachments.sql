@@ -0,0 +1,16 @@
+-- name: CreateChirpAttachment :exec
+INSERT INTO chirp_attachments (chirp_id, upload_id, position, alt_text)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetChirpAttachments :many
+SELECT chirp_attachments.chirp_id, chirp_attachments.upload_id, chirp_attachments.position, chirp_attachments.alt_text, uploads.width, uploads.height, uploads.blurhash
+FROM chirp_attachments
+JOIN uploads ON uploads.id = chirp_attachments.upload_id
+WHERE chirp_attachments.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_attachments.chirp_id, chirp_attachments.position;
+
+-- name: GetChirpAttachmentUploadIDs :many
+SELECT upload_id FROM chirp_attachments WHERE chirp_id = $1;
+
+-- name: DeleteChirpAttachments :exec
+DELETE FROM chirp_attachments WHERE chirp_id = $1;
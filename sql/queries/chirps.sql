@@ -1,16 +1,181 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, root_id, quote_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: CreateRechirp :one
+-- a user can only rechirp a chirp once; a second try returns no rows
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, rechirp_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
     $2
 )
+ON CONFLICT (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL DO NOTHING
 RETURNING *;
 
+-- name: GetRechirp :one
+SELECT * FROM chirps WHERE user_id = $1 AND rechirp_of = $2;
+
+-- name: DeleteRechirp :one
+-- chirp_id can be the original or any rechirp of it
+DELETE FROM chirps
+WHERE chirps.user_id = sqlc.arg(user_id)
+AND chirps.rechirp_of = (SELECT COALESCE(target.rechirp_of, target.id) FROM chirps AS target WHERE target.id = sqlc.arg(chirp_id))
+RETURNING id, rechirp_of;
+
+-- name: DeleteRechirpsOf :exec
+DELETE FROM chirps WHERE rechirp_of = $1;
+
 -- name: GetChirps :many
-SELECT * FROM chirps ORDER BY created_at ASC;
+-- private accounts' chirps are only visible to themselves and accepted followers
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE users.delete_after IS NULL AND chirps.deleted_at IS NULL
+AND (NOT users.is_private OR users.id = sqlc.arg(viewer_id) OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = users.id AND follows.status = 'accepted'
+))
+ORDER BY chirps.created_at ASC;
 
 -- name: GetChirpByID :one 
-SELECT * FROM chirps WHERE id = $1;
\ No newline at end of file
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = sqlc.arg(id) AND users.delete_after IS NULL AND chirps.deleted_at IS NULL
+AND (NOT users.is_private OR users.id = sqlc.arg(viewer_id) OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = users.id AND follows.status = 'accepted'
+));
+
+-- name: GetChirpsForUser :many
+SELECT * FROM chirps WHERE user_id = $1 AND deleted_at IS NULL ORDER BY created_at ASC;
+
+-- name: DeleteChirp :exec
+DELETE FROM chirps WHERE id = $1;
+
+-- name: ChirpHasReplies :one
+SELECT EXISTS (SELECT 1 FROM chirps WHERE in_reply_to = $1);
+
+-- name: TombstoneChirp :exec
+-- keeps a deleted chirp's place in its thread without its content
+UPDATE chirps SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteUnrepliedTombstone :one
+-- removes a tombstone once its last reply is gone, returning its own parent
+-- so the caller can carry on up the thread
+DELETE FROM chirps
+WHERE id = $1 AND deleted_at IS NOT NULL
+AND NOT EXISTS (SELECT 1 FROM chirps AS replies WHERE replies.in_reply_to = $1)
+RETURNING in_reply_to;
+
+-- name: GetThreadChirp :one
+-- like GetChirpByID, but tombstones and chirps the viewer can't see come back
+-- too, with visible saying which is which
+SELECT chirps.*, (chirps.deleted_at IS NULL AND users.delete_after IS NULL AND (NOT users.is_private OR users.id = sqlc.arg(viewer_id) OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = users.id AND follows.status = 'accepted'
+)))::boolean AS visible
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = sqlc.arg(id);
+
+-- name: GetChirpAncestors :many
+-- the chain of chirps a chirp replies to, nearest first, up to max_depth of them
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.in_reply_to, parent.root_id, parent.deleted_at, parent.rechirp_of, parent.quote_of, 1 AS depth
+    FROM chirps
+    JOIN chirps AS parent ON parent.id = chirps.in_reply_to
+    WHERE chirps.id = sqlc.arg(id)
+    UNION ALL
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.in_reply_to, parent.root_id, parent.deleted_at, parent.rechirp_of, parent.quote_of, ancestors.depth + 1
+    FROM ancestors
+    JOIN chirps AS parent ON parent.id = ancestors.in_reply_to
+    WHERE ancestors.depth < sqlc.arg(max_depth)::int
+)
+SELECT ancestors.id, ancestors.created_at, ancestors.updated_at, ancestors.body, ancestors.user_id, ancestors.in_reply_to, ancestors.root_id, ancestors.deleted_at, ancestors.rechirp_of, ancestors.quote_of, ancestors.depth::int AS depth,
+(ancestors.deleted_at IS NULL AND users.delete_after IS NULL AND (NOT users.is_private OR users.id = sqlc.arg(viewer_id) OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = users.id AND follows.status = 'accepted'
+)))::boolean AS visible
+FROM ancestors
+JOIN users ON users.id = ancestors.user_id
+ORDER BY ancestors.depth ASC;
+
+-- name: GetChirpDescendants :many
+-- replies to a chirp and their replies in turn, breadth first and oldest
+-- first within each level, down to max_depth and at most max_count of them
+WITH RECURSIVE descendants AS (
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.root_id, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, 1 AS depth
+    FROM chirps
+    WHERE chirps.in_reply_to = sqlc.arg(id)
+    UNION ALL
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.root_id, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, descendants.depth + 1
+    FROM descendants
+    JOIN chirps ON chirps.in_reply_to = descendants.id
+    WHERE descendants.depth < sqlc.arg(max_depth)::int
+)
+SELECT descendants.id, descendants.created_at, descendants.updated_at, descendants.body, descendants.user_id, descendants.in_reply_to, descendants.root_id, descendants.deleted_at, descendants.rechirp_of, descendants.quote_of, descendants.depth::int AS depth,
+(descendants.deleted_at IS NULL AND users.delete_after IS NULL AND (NOT users.is_private OR users.id = sqlc.arg(viewer_id) OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = users.id AND follows.status = 'accepted'
+)))::boolean AS visible
+FROM descendants
+JOIN users ON users.id = descendants.user_id
+ORDER BY descendants.depth ASC, descendants.created_at ASC, descendants.id ASC
+LIMIT sqlc.arg(max_count);
+
+-- name: GetChirpReplies :many
+-- direct replies the viewer can see, newest first, starting after the (created_at, id) cursor
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.in_reply_to = sqlc.arg(id)
+AND users.delete_after IS NULL AND chirps.deleted_at IS NULL
+AND (NOT users.is_private OR users.id = sqlc.arg(viewer_id) OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = users.id AND follows.status = 'accepted'
+))
+AND (chirps.created_at, chirps.id) < (sqlc.arg(cursor_time)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetReplyCounts :many
+-- how many live replies each chirp has
+SELECT chirps.in_reply_to AS chirp_id, COUNT(*) AS reply_count
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.in_reply_to = ANY(sqlc.arg(chirp_ids)::uuid[])
+AND chirps.deleted_at IS NULL AND users.delete_after IS NULL
+GROUP BY chirps.in_reply_to;
+
+-- name: GetReferencedChirps :many
+-- the chirps rechirped or quoted by others, with visible saying which ones
+-- the viewer may see
+SELECT chirps.*, (chirps.deleted_at IS NULL AND users.delete_after IS NULL AND (NOT users.is_private OR users.id = sqlc.arg(viewer_id) OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = users.id AND follows.status = 'accepted'
+)))::boolean AS visible
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = ANY(sqlc.arg(chirp_ids)::uuid[]);
+
+-- name: GetRepostCounts :many
+-- how many times each chirp has been rechirped and quoted
+SELECT ids.id::uuid AS chirp_id,
+(SELECT COUNT(*) FROM chirps JOIN users ON users.id = chirps.user_id
+ WHERE chirps.rechirp_of = ids.id AND users.delete_after IS NULL) AS rechirp_count,
+(SELECT COUNT(*) FROM chirps JOIN users ON users.id = chirps.user_id
+ WHERE chirps.quote_of = ids.id AND chirps.deleted_at IS NULL AND users.delete_after IS NULL) AS quote_count
+FROM unnest(sqlc.arg(chirp_ids)::uuid[]) AS ids(id);
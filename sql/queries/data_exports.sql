@@ -0,0 +1,44 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, user_id, status, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    'pending',
+    NOW()
+)
+ON CONFLICT (user_id) WHERE status IN ('pending', 'running') DO NOTHING
+RETURNING id, user_id, status, error, created_at, started_at, completed_at, expires_at;
+
+-- name: GetDataExportsForUser :many
+SELECT id, user_id, status, error, created_at, started_at, completed_at, expires_at FROM data_exports
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: ClaimDataExport :one
+-- picks the oldest pending export, or one whose worker died mid-build
+UPDATE data_exports SET status = 'running', started_at = NOW()
+WHERE id = (
+    SELECT id FROM data_exports
+    WHERE status = 'pending'
+    OR (status = 'running' AND started_at < NOW() - INTERVAL '10 minutes')
+    ORDER BY created_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, user_id;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports SET status = 'ready', archive = $2, completed_at = NOW(), expires_at = $3
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+-- failed exports expire too, so they're pruned like finished ones
+UPDATE data_exports SET status = 'failed', error = $2, completed_at = NOW(), expires_at = $3
+WHERE id = $1;
+
+-- name: GetDataExportArchive :one
+SELECT archive FROM data_exports
+WHERE id = $1 AND status = 'ready' AND expires_at > NOW();
+
+-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_exports WHERE expires_at < NOW();
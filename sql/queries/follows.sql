@@ -0,0 +1,56 @@
+-- name: CreateFollow :one
+INSERT INTO follows (follower_id, followee_id, status, created_at, accepted_at)
+VALUES ($1, $2, $3, NOW(), $4)
+ON CONFLICT (follower_id, followee_id) DO NOTHING
+RETURNING *;
+
+-- name: GetFollow :one
+SELECT * FROM follows WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: DeleteFollow :exec
+DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: AcceptFollowRequest :execrows
+UPDATE follows SET status = 'accepted', accepted_at = NOW()
+WHERE follower_id = $1 AND followee_id = $2 AND status = 'pending';
+
+-- name: AcceptAllFollowRequests :many
+UPDATE follows SET status = 'accepted', accepted_at = NOW()
+WHERE followee_id = $1 AND status = 'pending'
+RETURNING follower_id;
+
+-- name: RejectFollowRequest :execrows
+DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2 AND status = 'pending';
+
+-- name: GetFollowers :many
+-- newest first, starting after the (followed_at, id) cursor
+SELECT users.id, users.handle, users.display_name, users.bio, users.avatar_url, users.is_private, users.created_at, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = sqlc.arg(user_id) AND follows.status = sqlc.arg(status)
+AND users.delete_after IS NULL
+AND (follows.created_at, follows.follower_id) < (sqlc.arg(cursor_time)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY follows.created_at DESC, follows.follower_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetFollowing :many
+-- newest first, starting after the (followed_at, id) cursor
+SELECT users.id, users.handle, users.display_name, users.bio, users.avatar_url, users.is_private, users.created_at, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.followee_id
+WHERE follows.follower_id = sqlc.arg(user_id) AND follows.status = sqlc.arg(status)
+AND users.delete_after IS NULL
+AND (follows.created_at, follows.followee_id) < (sqlc.arg(cursor_time)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY follows.created_at DESC, follows.followee_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetFollowCounts :one
+SELECT
+    (SELECT COUNT(*) FROM follows JOIN users ON users.id = follows.follower_id
+     WHERE follows.followee_id = $1 AND follows.status = 'accepted' AND users.delete_after IS NULL) AS followers,
+    (SELECT COUNT(*) FROM follows JOIN users ON users.id = follows.followee_id
+     WHERE follows.follower_id = $1 AND follows.status = 'accepted' AND users.delete_after IS NULL) AS following;
+
+-- name: GetFollowsForUser :many
+-- follows and follow requests, either way round
+SELECT * FROM follows WHERE follower_id = $1 OR followee_id = $1 ORDER BY created_at ASC;
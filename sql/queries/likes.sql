@@ -0,0 +1,44 @@
+-- name: LikeChirp :execrows
+INSERT INTO likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: UnlikeChirp :one
+-- chirp_id can be the original or any rechirp of it, as with likes. Returns
+-- the chirp that was liked
+DELETE FROM likes
+WHERE likes.user_id = sqlc.arg(user_id)
+AND likes.chirp_id = (SELECT COALESCE(target.rechirp_of, target.id) FROM chirps AS target WHERE target.id = sqlc.arg(chirp_id))
+RETURNING chirp_id;
+
+-- name: GetLikeCounts :many
+SELECT likes.chirp_id, COUNT(*) AS like_count
+FROM likes
+JOIN users ON users.id = likes.user_id
+WHERE likes.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[]) AND users.delete_after IS NULL
+GROUP BY likes.chirp_id;
+
+-- name: GetLikedChirpIDs :many
+-- which of the given chirps the user has liked
+SELECT chirp_id FROM likes
+WHERE user_id = sqlc.arg(user_id) AND chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[]);
+
+-- name: GetUserLikes :many
+-- chirps the user liked that the viewer can see, most recently liked first,
+-- starting after the (liked_at, chirp id) cursor
+SELECT chirps.*, likes.created_at AS liked_at
+FROM likes
+JOIN chirps ON chirps.id = likes.chirp_id
+JOIN users ON users.id = chirps.user_id
+WHERE likes.user_id = sqlc.arg(user_id)
+AND chirps.deleted_at IS NULL AND users.delete_after IS NULL
+AND (NOT users.is_private OR users.id = sqlc.arg(viewer_id) OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = users.id AND follows.status = 'accepted'
+))
+AND (likes.created_at, likes.chirp_id) < (sqlc.arg(cursor_time)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY likes.created_at DESC, likes.chirp_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetLikesForUser :many
+SELECT * FROM likes WHERE user_id = $1 ORDER BY created_at ASC;
@@ -0,0 +1,26 @@
+-- name: CreateMagicLinkToken :exec
+INSERT INTO magic_link_tokens (jti, user_id, email, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    $4
+);
+
+-- name: CountMagicLinkTokensSince :one
+SELECT COUNT(*) FROM magic_link_tokens
+WHERE email = $1 AND created_at > $2;
+
+-- name: ConsumeMagicLinkToken :one
+UPDATE magic_link_tokens SET used_at = NOW()
+WHERE jti = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id;
+
+-- name: DeleteMagicLinkTokensCreatedBefore :execrows
+DELETE FROM magic_link_tokens WHERE created_at < $1;
+
+-- name: LockMagicLinkEmail :exec
+-- holds other requests for the same address until the transaction ends, so
+-- counting recent links and adding one can't race
+SELECT pg_advisory_xact_lock(hashtext('magic_link:' || sqlc.arg(email)::text));
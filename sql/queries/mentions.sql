@@ -0,0 +1,43 @@
+-- name: ResolveMentions :many
+-- looks up mentioned handles, leaving out accounts that have blocked the author
+SELECT users.id, users.handle FROM users
+WHERE LOWER(users.handle) = ANY(sqlc.arg(handles)::text[]) AND users.delete_after IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE blocks.blocker_id = users.id AND blocks.blocked_id = sqlc.arg(author_id)
+);
+
+-- name: CreateChirpMentions :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, start_offset, end_offset, created_at)
+SELECT sqlc.arg(chirp_id)::uuid, mentions.user_id, mentions.start_offset, mentions.end_offset, sqlc.arg(created_at)::timestamp
+FROM unnest(sqlc.arg(user_ids)::uuid[], sqlc.arg(start_offsets)::int[], sqlc.arg(end_offsets)::int[]) AS mentions(user_id, start_offset, end_offset);
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM chirp_mentions WHERE chirp_id = $1;
+
+-- name: GetChirpMentions :many
+-- the mentions in each chirp, with the mentioned user's current handle
+SELECT chirp_mentions.chirp_id, chirp_mentions.user_id, users.handle, chirp_mentions.start_offset, chirp_mentions.end_offset
+FROM chirp_mentions
+JOIN users ON users.id = chirp_mentions.user_id
+WHERE chirp_mentions.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[]) AND users.delete_after IS NULL
+ORDER BY chirp_mentions.chirp_id, chirp_mentions.start_offset;
+
+-- name: GetMentions :many
+-- chirps mentioning the user that they can see, newest first, starting after
+-- the (created_at, id) cursor. Chirps from accounts they've blocked are left out
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id IN (SELECT chirp_mentions.chirp_id FROM chirp_mentions WHERE chirp_mentions.user_id = sqlc.arg(user_id))
+AND users.delete_after IS NULL AND chirps.deleted_at IS NULL
+AND (NOT users.is_private OR users.id = sqlc.arg(user_id) OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = sqlc.arg(user_id) AND follows.followee_id = users.id AND follows.status = 'accepted'
+))
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE blocks.blocker_id = sqlc.arg(user_id) AND blocks.blocked_id = users.id
+)
+AND (chirps.created_at, chirps.id) < (sqlc.arg(cursor_time)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_size);
@@ -0,0 +1,97 @@
+-- name: CreateNotification :one
+-- nobody is notified of their own actions, or of those of accounts they've
+-- blocked; then no row comes back
+INSERT INTO notifications (id, user_id, kind, actor_id, chirp_id, created_at)
+SELECT gen_random_uuid(), sqlc.arg(user_id)::uuid, sqlc.arg(kind)::text, sqlc.arg(actor_id)::uuid, sqlc.narg(chirp_id)::uuid, NOW()
+WHERE sqlc.arg(user_id)::uuid <> sqlc.arg(actor_id)::uuid
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE blocks.blocker_id = sqlc.arg(user_id)::uuid AND blocks.blocked_id = sqlc.arg(actor_id)::uuid
+)
+RETURNING *;
+
+-- name: DeleteNotification :exec
+-- takes back a notification when the actor undoes what they did. user_id can
+-- be left null when chirp_id already says whose notification it is
+DELETE FROM notifications
+WHERE kind = sqlc.arg(kind)
+AND actor_id = sqlc.arg(actor_id)
+AND user_id = COALESCE(sqlc.narg(user_id)::uuid, user_id)
+AND chirp_id IS NOT DISTINCT FROM sqlc.narg(chirp_id)::uuid;
+
+-- name: DeleteNotificationsFrom :exec
+DELETE FROM notifications WHERE user_id = $1 AND actor_id = $2;
+
+-- name: GetNotificationGroups :many
+-- the user's notifications newest first, starting after the (created_at, id)
+-- cursor. Notifications of a grouped kind about the same chirp (or about the
+-- user, for follows) are folded together, keeping unread ones apart from read
+-- ones. Each group takes the id and created_at of its newest notification and
+-- lists up to three actors, newest first. Notifications about deleted chirps,
+-- or from accounts waiting to be deleted, are left out.
+WITH visible AS (
+    SELECT notifications.id, notifications.kind, notifications.actor_id, notifications.chirp_id, notifications.created_at, notifications.read_at
+    FROM notifications
+    JOIN users AS actors ON actors.id = notifications.actor_id
+    LEFT JOIN chirps ON chirps.id = notifications.chirp_id
+    WHERE notifications.user_id = sqlc.arg(user_id)
+    AND actors.delete_after IS NULL
+    AND chirps.deleted_at IS NULL
+    AND (NOT sqlc.arg(unread_only)::bool OR notifications.read_at IS NULL)
+), grouped AS (
+    SELECT
+        (array_agg(id ORDER BY created_at DESC, id DESC))[1]::uuid AS id,
+        kind,
+        chirp_id,
+        MAX(created_at)::timestamp AS created_at,
+        (array_agg(actor_id ORDER BY created_at DESC, id DESC))[1:3]::uuid[] AS actor_ids,
+        COUNT(DISTINCT actor_id) AS actor_count,
+        bool_or(read_at IS NULL)::bool AS unread
+    FROM visible
+    GROUP BY kind, chirp_id, read_at IS NULL,
+        CASE WHEN kind = ANY(sqlc.arg(grouped_kinds)::text[]) THEN NULL ELSE id END
+)
+SELECT id, kind, chirp_id, created_at, actor_ids, actor_count, unread
+FROM grouped
+WHERE (created_at, id) < (sqlc.arg(cursor_time)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: CountUnreadNotifications :one
+-- counts what GetNotificationGroups would show as unread, before grouping
+SELECT COUNT(*)
+FROM notifications
+JOIN users AS actors ON actors.id = notifications.actor_id
+LEFT JOIN chirps ON chirps.id = notifications.chirp_id
+WHERE notifications.user_id = $1
+AND notifications.read_at IS NULL
+AND actors.delete_after IS NULL
+AND chirps.deleted_at IS NULL;
+
+-- name: MarkNotificationsRead :exec
+UPDATE notifications SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationGroupRead :exec
+-- marks a notification read along with the older unread ones grouped with it
+UPDATE notifications SET read_at = NOW()
+FROM notifications AS target
+WHERE target.id = sqlc.arg(id)
+AND target.user_id = sqlc.arg(user_id)
+AND notifications.user_id = target.user_id
+AND notifications.read_at IS NULL
+AND (
+    notifications.id = target.id
+    OR (
+        target.kind = ANY(sqlc.arg(grouped_kinds)::text[])
+        AND notifications.kind = target.kind
+        AND notifications.chirp_id IS NOT DISTINCT FROM target.chirp_id
+        AND notifications.created_at <= target.created_at
+    )
+);
+
+-- name: GetNotification :one
+SELECT * FROM notifications WHERE id = $1 AND user_id = $2;
+
+-- name: GetNotificationsForUser :many
+SELECT * FROM notifications WHERE user_id = $1 ORDER BY created_at ASC;
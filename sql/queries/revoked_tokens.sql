@@ -0,0 +1,31 @@
+-- name: RevokeToken :exec
+INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: IsTokenRevoked :one
+SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1);
+
+-- name: DeleteExpiredRevokedTokens :execrows
+DELETE FROM revoked_tokens WHERE expires_at < NOW();
+
+-- name: RevokeSessionTokens :exec
+INSERT INTO revoked_sessions (session_id, user_id, expires_at, revoked_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+ON CONFLICT (session_id) DO UPDATE SET expires_at = GREATEST(revoked_sessions.expires_at, EXCLUDED.expires_at);
+
+-- name: IsSessionRevoked :one
+SELECT EXISTS (SELECT 1 FROM revoked_sessions WHERE session_id = $1);
+
+-- name: DeleteExpiredRevokedSessions :execrows
+DELETE FROM revoked_sessions WHERE expires_at < NOW();
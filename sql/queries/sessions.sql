@@ -0,0 +1,39 @@
+-- name: CreateSession :one
+INSERT INTO sessions (id, user_id, refresh_token_hash, user_agent, ip_address, created_at, last_used_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW(),
+    NOW()
+)
+RETURNING *;
+
+-- name: TouchSession :one
+UPDATE sessions SET last_used_at = NOW(), ip_address = $2
+WHERE refresh_token_hash = $1
+RETURNING *;
+
+-- name: GetActiveSessionsForUser :many
+SELECT sessions.* FROM sessions
+JOIN refresh_tokens ON refresh_tokens.token_hash = sessions.refresh_token_hash
+WHERE sessions.user_id = $1
+AND refresh_tokens.revoked_at IS NULL
+AND refresh_tokens.expires_at > NOW()
+ORDER BY sessions.last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW()
+FROM sessions
+WHERE sessions.refresh_token_hash = refresh_tokens.token_hash
+AND sessions.id = $1
+AND sessions.user_id = $2
+AND refresh_tokens.revoked_at IS NULL;
+
+-- name: GetSessionsForUser :many
+SELECT * FROM sessions WHERE user_id = $1 ORDER BY created_at ASC;
+
+-- name: GetSession :one
+SELECT * FROM sessions WHERE id = $1 AND user_id = $2;
@@ -0,0 +1,19 @@
+-- name: CreateSigningKey :one
+INSERT INTO signing_keys (kid, algorithm, private_key, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetSigningKeys :many
+SELECT * FROM signing_keys ORDER BY created_at DESC;
+
+-- name: RetireSigningKeysExcept :exec
+UPDATE signing_keys SET retired_at = NOW()
+WHERE retired_at IS NULL AND kid <> $1;
+
+-- name: DeleteSigningKeysRetiredBefore :execrows
+DELETE FROM signing_keys WHERE retired_at < $1;
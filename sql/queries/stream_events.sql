@@ -0,0 +1,28 @@
+-- name: LockStreamEvents :exec
+-- holds other publishers until the transaction ends. Ids are handed out on
+-- insert but only seen on commit, so without it events could commit out of
+-- order, and anyone reading on from the newest id they've seen would skip the
+-- late ones.
+SELECT pg_advisory_xact_lock(hashtext('stream_events'));
+
+-- name: PublishStreamEvent :exec
+-- logs an event and, when the transaction commits, tells every replica about
+-- it on the given NOTIFY channel
+WITH event AS (
+    INSERT INTO stream_events (kind, chirp_id, user_id, notification_id, created_at)
+    VALUES (sqlc.arg(kind), sqlc.narg(chirp_id), sqlc.arg(user_id), sqlc.narg(notification_id), NOW())
+    RETURNING id, kind, chirp_id, user_id, notification_id
+)
+SELECT pg_notify(sqlc.arg(channel)::text, row_to_json(event)::text) FROM event;
+
+-- name: GetStreamEventsSince :many
+SELECT * FROM stream_events
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: StreamEventExists :one
+SELECT EXISTS (SELECT 1 FROM stream_events WHERE id = $1);
+
+-- name: DeleteStreamEventsBefore :execrows
+DELETE FROM stream_events WHERE created_at < $1;
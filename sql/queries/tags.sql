@@ -0,0 +1,31 @@
+-- name: CreateChirpTags :exec
+INSERT INTO chirp_tags (chirp_id, tag, created_at)
+SELECT sqlc.arg(chirp_id)::uuid, tags.tag, sqlc.arg(created_at)::timestamp
+FROM unnest(sqlc.arg(tags)::text[]) AS tags(tag)
+ON CONFLICT (chirp_id, tag) DO NOTHING;
+
+-- name: DeleteChirpTags :exec
+DELETE FROM chirp_tags WHERE chirp_id = $1;
+
+-- name: GetTagChirps :many
+-- chirps with the tag that the viewer can see, newest first, starting after
+-- the (created_at, id) cursor
+SELECT chirps.* FROM chirp_tags
+JOIN chirps ON chirps.id = chirp_tags.chirp_id
+JOIN users ON users.id = chirps.user_id
+WHERE chirp_tags.tag = sqlc.arg(tag)
+AND users.delete_after IS NULL AND chirps.deleted_at IS NULL
+AND (NOT users.is_private OR users.id = sqlc.arg(viewer_id) OR EXISTS (
+    SELECT 1 FROM follows
+    WHERE follows.follower_id = sqlc.arg(viewer_id) AND follows.followee_id = users.id AND follows.status = 'accepted'
+))
+AND (chirp_tags.created_at, chirp_tags.chirp_id) < (sqlc.arg(cursor_time)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY chirp_tags.created_at DESC, chirp_tags.chirp_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetChirpsToTag :many
+-- live chirps in id order, a batch at a time, for `chirpy index-tags`
+SELECT id, body, created_at FROM chirps
+WHERE deleted_at IS NULL AND id > $1
+ORDER BY id
+LIMIT $2;
@@ -0,0 +1,61 @@
+-- name: GetHomeTimeline :many
+-- fan-out-on-read: the user's own chirps and those of everyone they follow,
+-- newest first, starting after the (created_at, id) cursor
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE (chirps.user_id = sqlc.arg(user_id) OR chirps.user_id IN (
+    SELECT followee_id FROM follows
+    WHERE follower_id = sqlc.arg(user_id) AND status = 'accepted'
+))
+AND users.delete_after IS NULL AND chirps.deleted_at IS NULL
+AND (chirps.created_at, chirps.id) < (sqlc.arg(cursor_time)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetMaterializedHomeTimeline :many
+-- fan-out-on-write: the same page read from timeline_entries
+SELECT chirps.* FROM timeline_entries
+JOIN chirps ON chirps.id = timeline_entries.chirp_id
+JOIN users ON users.id = timeline_entries.author_id
+WHERE timeline_entries.user_id = sqlc.arg(user_id)
+AND users.delete_after IS NULL AND chirps.deleted_at IS NULL
+AND (timeline_entries.created_at, timeline_entries.chirp_id) < (sqlc.arg(cursor_time)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY timeline_entries.created_at DESC, timeline_entries.chirp_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: FanOutChirp :exec
+-- copies a new chirp into its author's timeline and their accepted followers'
+INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+SELECT chirps.user_id, chirps.id, chirps.user_id, chirps.created_at
+FROM chirps WHERE chirps.id = $1
+UNION ALL
+SELECT follows.follower_id, chirps.id, chirps.user_id, chirps.created_at
+FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id AND follows.status = 'accepted'
+WHERE chirps.id = $1
+ON CONFLICT DO NOTHING;
+
+-- name: BackfillTimeline :exec
+-- copies an author's chirps into a new follower's timeline
+INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+SELECT sqlc.arg(user_id)::uuid, chirps.id, chirps.user_id, chirps.created_at
+FROM chirps WHERE chirps.user_id = sqlc.arg(author_id) AND chirps.deleted_at IS NULL
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveFromTimeline :exec
+DELETE FROM timeline_entries WHERE user_id = $1 AND author_id = $2;
+
+-- name: DeleteAllTimelineEntries :exec
+DELETE FROM timeline_entries;
+
+-- name: FillTimelines :exec
+-- rebuilds every timeline from chirps and follows after DeleteAllTimelineEntries
+INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+SELECT chirps.user_id, chirps.id, chirps.user_id, chirps.created_at
+FROM chirps WHERE chirps.deleted_at IS NULL
+UNION ALL
+SELECT follows.follower_id, chirps.id, chirps.user_id, chirps.created_at
+FROM follows
+JOIN chirps ON chirps.user_id = follows.followee_id
+WHERE follows.status = 'accepted' AND chirps.deleted_at IS NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,61 @@
+-- name: ComputeTrendingTags :exec
+-- ranks the tags used in the last window_seconds. Each author counts once per
+-- tag, weighted by how recently they last used it (halving every quarter of
+-- the window), and the total is divided by the tag's usual rate: the authors
+-- who used it over the four windows before. Tags from fewer than min_authors
+-- authors, from private accounts or on the denylist are left out.
+WITH uses AS (
+    SELECT chirp_tags.tag, chirps.user_id, EXTRACT(EPOCH FROM NOW() - chirp_tags.created_at)::float8 AS age
+    FROM chirp_tags
+    JOIN chirps ON chirps.id = chirp_tags.chirp_id
+    JOIN users ON users.id = chirps.user_id
+    WHERE chirp_tags.created_at >= NOW() - make_interval(secs => 5 * sqlc.arg(window_seconds)::int)
+    AND chirps.deleted_at IS NULL AND users.delete_after IS NULL AND NOT users.is_private
+    AND chirp_tags.tag NOT IN (SELECT trending_denylist.tag FROM trending_denylist)
+), authors AS (
+    SELECT uses.tag, uses.user_id, MIN(uses.age) AS age,
+        COUNT(*) FILTER (WHERE uses.age < sqlc.arg(window_seconds)::int) AS recent_uses,
+        BOOL_OR(uses.age >= sqlc.arg(window_seconds)::int) AS used_before
+    FROM uses
+    GROUP BY uses.tag, uses.user_id
+), scored AS (
+    SELECT authors.tag,
+        (COALESCE(SUM(POWER(0.5, authors.age * 4 / sqlc.arg(window_seconds)::int)) FILTER (WHERE authors.recent_uses > 0), 0)
+            / (1 + COUNT(*) FILTER (WHERE authors.used_before) / 4.0))::float8 AS score,
+        SUM(authors.recent_uses)::bigint AS chirp_count,
+        COUNT(*) FILTER (WHERE authors.recent_uses > 0) AS author_count
+    FROM authors
+    GROUP BY authors.tag
+)
+INSERT INTO trending_tags (window_seconds, tag, score, chirp_count, author_count, computed_at)
+SELECT sqlc.arg(window_seconds)::int, scored.tag, scored.score, scored.chirp_count, scored.author_count, NOW()
+FROM scored
+WHERE scored.author_count >= sqlc.arg(min_authors)::int
+ORDER BY scored.score DESC
+LIMIT sqlc.arg(max_tags);
+
+-- name: DeleteAllTrendingTags :exec
+DELETE FROM trending_tags;
+
+-- name: DeleteTrendingTag :exec
+DELETE FROM trending_tags WHERE tag = $1;
+
+-- name: GetTrendingTags :many
+SELECT * FROM trending_tags
+WHERE window_seconds = $1
+ORDER BY score DESC, tag ASC
+LIMIT $2;
+
+-- name: AddToTrendingDenylist :execrows
+INSERT INTO trending_denylist (tag, added_by, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (tag) DO NOTHING;
+
+-- name: GetTrendingDenylistEntry :one
+SELECT * FROM trending_denylist WHERE tag = $1;
+
+-- name: RemoveFromTrendingDenylist :execrows
+DELETE FROM trending_denylist WHERE tag = $1;
+
+-- name: GetTrendingDenylist :many
+SELECT * FROM trending_denylist ORDER BY tag ASC;
@@ -0,0 +1,100 @@
+-- name: CreateUpload :one
+INSERT INTO uploads (id, user_id, sha256, content_type, size, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetUpload :one
+SELECT * FROM uploads WHERE id = $1;
+
+-- name: GetUploadsForUser :many
+SELECT * FROM uploads WHERE user_id = $1 ORDER BY created_at ASC;
+
+-- name: ClaimUpload :one
+-- picks the oldest pending upload, or one whose worker died mid-way
+UPDATE uploads SET status = 'running', started_at = NOW()
+WHERE id = (
+    SELECT id FROM uploads
+    WHERE status = 'pending'
+    OR (status = 'running' AND started_at < NOW() - INTERVAL '10 minutes')
+    ORDER BY created_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CompleteUpload :exec
+UPDATE uploads SET status = 'ready', width = $2, height = $3, blurhash = $4, processed_at = NOW()
+WHERE id = $1;
+
+-- name: FailUpload :exec
+UPDATE uploads SET status = 'failed', error = $2, processed_at = NOW()
+WHERE id = $1;
+
+-- name: CreateUploadVariant :exec
+INSERT INTO upload_variants (upload_id, name, sha256, content_type, width, height, size)
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: GetUploadVariants :many
+SELECT * FROM upload_variants WHERE upload_id = $1;
+
+-- name: GetMediaContentType :one
+SELECT content_type FROM upload_variants WHERE sha256 = $1 LIMIT 1;
+
+-- name: GetUploadVariantsForUploads :many
+SELECT * FROM upload_variants WHERE upload_id = ANY(sqlc.arg(upload_ids)::uuid[]);
+
+-- name: GetUploadIDsForUsers :many
+SELECT id FROM uploads WHERE user_id = ANY(sqlc.arg(user_ids)::uuid[]);
+
+-- name: GetUnusedUploadsBefore :many
+-- uploads made before the cutoff that no chirp or profile uses: ones never
+-- attached, and avatars that have since been replaced
+SELECT id FROM uploads
+WHERE created_at < $1
+AND NOT EXISTS (
+    SELECT 1 FROM chirp_attachments WHERE chirp_attachments.upload_id = uploads.id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM users WHERE users.avatar_upload_id = uploads.id
+)
+ORDER BY created_at
+LIMIT $2;
+
+-- name: DeleteUnusedUploads :many
+-- deletes those of the given uploads that no chirp or profile uses any more
+DELETE FROM uploads
+WHERE uploads.id = ANY(sqlc.arg(ids)::uuid[])
+AND NOT EXISTS (
+    SELECT 1 FROM chirp_attachments WHERE chirp_attachments.upload_id = uploads.id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM users WHERE users.avatar_upload_id = uploads.id
+)
+RETURNING id;
+
+-- name: LockUploads :many
+-- keeps the uploads from being deleted until the transaction ends, and
+-- returns the ones that are still there
+SELECT id FROM uploads WHERE id = ANY(sqlc.arg(ids)::uuid[])
+FOR KEY SHARE;
+
+-- name: LockUploadsForDelete :exec
+-- waits for transactions still attaching the uploads, so a DELETE after it
+-- sees their attachments
+SELECT id FROM uploads WHERE id = ANY(sqlc.arg(ids)::uuid[])
+FOR UPDATE;
+
+-- name: LockMedia :exec
+-- holds anyone else writing or deleting the file with this hash until the
+-- transaction ends, so a file that's about to be used isn't deleted
+SELECT pg_advisory_xact_lock(hashtext('media:' || sqlc.arg(sha256)::text));
+
+-- name: IsMediaInUse :one
+SELECT EXISTS (SELECT 1 FROM upload_variants WHERE sha256 = $1);
@@ -1,11 +1,13 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, password_login_enabled, handle)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
 RETURNING *;
 
@@ -13,4 +15,63 @@ RETURNING *;
 SELECT * FROM users WHERE id = $1;
 
 -- name: GetUserByEmail :one
-SELECT * FROM users WHERE email = $1;
\ No newline at end of file
+SELECT * FROM users WHERE email = $1;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE LOWER(handle) = LOWER(sqlc.arg(handle)) AND delete_after IS NULL;
+
+-- name: SetUserAdmin :execrows
+UPDATE users SET is_admin = sqlc.arg(is_admin), updated_at = NOW()
+WHERE LOWER(handle) = LOWER(sqlc.arg(handle)) AND delete_after IS NULL;
+
+-- name: GetAuthorSummaries :many
+SELECT id, handle, display_name, avatar_url FROM users
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: MarkEmailVerified :one
+UPDATE users SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING *;
+
+-- name: UpdateUserPassword :one
+UPDATE users SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserTokenGeneration :one
+SELECT token_generation FROM users WHERE id = $1;
+
+-- name: IncrementTokenGeneration :one
+UPDATE users SET token_generation = token_generation + 1, updated_at = NOW()
+WHERE id = $1
+RETURNING token_generation;
+
+-- name: SetPasswordLoginEnabled :one
+UPDATE users SET password_login_enabled = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ScheduleUserDeletion :one
+UPDATE users SET delete_after = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: CancelUserDeletion :one
+UPDATE users SET delete_after = NULL, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: LockUsersScheduledBefore :many
+-- holds the accounts due to be purged, so none can be recovered between
+-- reading what they own and deleting them
+SELECT id FROM users WHERE delete_after <= $1
+FOR UPDATE;
+
+-- name: DeleteUsersScheduledBefore :execrows
+DELETE FROM users WHERE delete_after <= $1;
+
+-- name: UpdateUserProfile :one
+UPDATE users SET handle = $2, display_name = $3, bio = $4, avatar_url = $5, is_private = $6, avatar_upload_id = $7, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
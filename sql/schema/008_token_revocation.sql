@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE users ADD token_generation INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN token_generation;
+DROP TABLE revoked_tokens;
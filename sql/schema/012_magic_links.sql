@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE magic_link_tokens (
+    jti TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX magic_link_tokens_email_created_at_idx ON magic_link_tokens (email, created_at);
+
+ALTER TABLE users ADD password_login_enabled BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN password_login_enabled;
+DROP TABLE magic_link_tokens;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX audit_events_user_id_created_at_idx ON audit_events (user_id, created_at);
+
+-- +goose Down
+DROP TABLE audit_events;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    archive BYTEA,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL,
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP
+);
+
+-- one export in flight per user at a time
+CREATE UNIQUE INDEX data_exports_in_progress_idx ON data_exports (user_id) WHERE status IN ('pending', 'running');
+
+-- +goose Down
+DROP TABLE data_exports;
@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE users ADD handle TEXT;
+ALTER TABLE users ADD display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD avatar_url TEXT NOT NULL DEFAULT '';
+
+-- existing accounts get a placeholder handle they can change later
+UPDATE users SET handle = 'user_' || substr(replace(id::text, '-', ''), 1, 12);
+ALTER TABLE users ALTER COLUMN handle SET NOT NULL;
+
+CREATE UNIQUE INDEX users_handle_lower_idx ON users (LOWER(handle));
+
+-- +goose Down
+DROP INDEX users_handle_lower_idx;
+ALTER TABLE users DROP COLUMN avatar_url;
+ALTER TABLE users DROP COLUMN bio;
+ALTER TABLE users DROP COLUMN display_name;
+ALTER TABLE users DROP COLUMN handle;
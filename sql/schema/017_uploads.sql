@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE uploads (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sha256 TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- blobs are stored by content hash, so identical files uploaded twice share one
+CREATE INDEX uploads_sha256_idx ON uploads (sha256);
+CREATE INDEX uploads_user_id_idx ON uploads (user_id);
+
+-- +goose Down
+DROP TABLE uploads;
@@ -0,0 +1,35 @@
+-- +goose Up
+-- uploads are processed in the background; only their variants are ever served
+ALTER TABLE uploads ADD status TEXT NOT NULL DEFAULT 'pending';
+ALTER TABLE uploads ADD width INT;
+ALTER TABLE uploads ADD height INT;
+ALTER TABLE uploads ADD blurhash TEXT;
+ALTER TABLE uploads ADD error TEXT;
+ALTER TABLE uploads ADD started_at TIMESTAMP;
+ALTER TABLE uploads ADD processed_at TIMESTAMP;
+
+CREATE INDEX uploads_unprocessed_idx ON uploads (created_at) WHERE status IN ('pending', 'running');
+
+CREATE TABLE upload_variants (
+    upload_id UUID NOT NULL REFERENCES uploads(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size BIGINT NOT NULL,
+    PRIMARY KEY (upload_id, name)
+);
+
+CREATE INDEX upload_variants_sha256_idx ON upload_variants (sha256);
+
+-- +goose Down
+DROP TABLE upload_variants;
+DROP INDEX uploads_unprocessed_idx;
+ALTER TABLE uploads DROP COLUMN processed_at;
+ALTER TABLE uploads DROP COLUMN started_at;
+ALTER TABLE uploads DROP COLUMN error;
+ALTER TABLE uploads DROP COLUMN blurhash;
+ALTER TABLE uploads DROP COLUMN height;
+ALTER TABLE uploads DROP COLUMN width;
+ALTER TABLE uploads DROP COLUMN status;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE chirp_attachments (
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    upload_id UUID NOT NULL REFERENCES uploads(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    alt_text TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (chirp_id, position),
+    UNIQUE (chirp_id, upload_id)
+);
+
+CREATE INDEX chirp_attachments_upload_id_idx ON chirp_attachments (upload_id);
+
+-- +goose Down
+DROP TABLE chirp_attachments;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- follows of a private account start out pending until the account approves them
+ALTER TABLE users ADD is_private BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE follows (
+    follower_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX follows_followee_idx ON follows (followee_id, status, created_at);
+CREATE INDEX follows_follower_idx ON follows (follower_id, status, created_at);
+
+-- +goose Down
+DROP TABLE follows;
+ALTER TABLE users DROP COLUMN is_private;
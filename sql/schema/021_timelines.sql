@@ -0,0 +1,21 @@
+-- +goose Up
+-- fan-out-on-read pages through each followed account's chirps newest first
+CREATE INDEX chirps_user_created_idx ON chirps (user_id, created_at DESC, id DESC);
+
+-- fan-out-on-write copies each chirp into its author's and followers' timelines
+-- as it's posted. Only kept up to date while TIMELINE_FANOUT_ON_WRITE is on.
+CREATE TABLE timeline_entries (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    author_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX timeline_entries_page_idx ON timeline_entries (user_id, created_at DESC, chirp_id DESC);
+CREATE INDEX timeline_entries_author_idx ON timeline_entries (user_id, author_id);
+CREATE INDEX timeline_entries_chirp_idx ON timeline_entries (chirp_id);
+
+-- +goose Down
+DROP TABLE timeline_entries;
+DROP INDEX chirps_user_created_idx;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- replies keep pointing at their parent after it's deleted, so there's no
+-- foreign key; a deleted chirp that has replies stays behind as a tombstone
+-- with deleted_at set and its body cleared
+ALTER TABLE chirps ADD in_reply_to UUID;
+ALTER TABLE chirps ADD root_id UUID;
+ALTER TABLE chirps ADD deleted_at TIMESTAMP;
+
+CREATE INDEX chirps_in_reply_to_idx ON chirps (in_reply_to, created_at DESC, id DESC);
+CREATE INDEX chirps_root_idx ON chirps (root_id);
+
+-- +goose Down
+DROP INDEX chirps_root_idx;
+DROP INDEX chirps_in_reply_to_idx;
+ALTER TABLE chirps DROP COLUMN deleted_at;
+ALTER TABLE chirps DROP COLUMN root_id;
+ALTER TABLE chirps DROP COLUMN in_reply_to;
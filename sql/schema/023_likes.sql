@@ -0,0 +1,15 @@
+-- +goose Up
+-- like counts are always counted from here rather than kept in a column, so
+-- concurrent likes can't leave them wrong
+CREATE TABLE likes (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX likes_chirp_idx ON likes (chirp_id);
+CREATE INDEX likes_user_created_idx ON likes (user_id, created_at DESC, chirp_id DESC);
+
+-- +goose Down
+DROP TABLE likes;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- a rechirp is a chirp with no body of its own, and goes when the original
+-- does. A quote keeps its text when the quoted chirp is deleted, so there's no
+-- foreign key on quote_of
+ALTER TABLE chirps ADD rechirp_of UUID REFERENCES chirps(id) ON DELETE CASCADE;
+ALTER TABLE chirps ADD quote_of UUID;
+
+CREATE UNIQUE INDEX chirps_user_rechirp_idx ON chirps (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL;
+CREATE INDEX chirps_rechirp_of_idx ON chirps (rechirp_of);
+CREATE INDEX chirps_quote_of_idx ON chirps (quote_of);
+
+-- +goose Down
+DROP INDEX chirps_quote_of_idx;
+DROP INDEX chirps_rechirp_of_idx;
+DROP INDEX chirps_user_rechirp_idx;
+ALTER TABLE chirps DROP COLUMN quote_of;
+ALTER TABLE chirps DROP COLUMN rechirp_of;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- tags are case-folded (see hashtags.go). created_at is copied from the chirp
+-- so tag pages can be read newest first straight off the index
+CREATE TABLE chirp_tags (
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, tag)
+);
+
+CREATE INDEX chirp_tags_tag_created_idx ON chirp_tags (tag, created_at DESC, chirp_id DESC);
+
+-- +goose Down
+DROP TABLE chirp_tags;
@@ -0,0 +1,30 @@
+-- +goose Up
+ALTER TABLE users ADD is_admin BOOLEAN NOT NULL DEFAULT false;
+
+-- tags admins have kept off GET /api/trending
+CREATE TABLE trending_denylist (
+    tag TEXT PRIMARY KEY,
+    added_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- rebuilt from scratch by the trending worker each time it runs, one ranking
+-- per configured window
+CREATE TABLE trending_tags (
+    window_seconds INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    chirp_count BIGINT NOT NULL,
+    author_count BIGINT NOT NULL,
+    computed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (window_seconds, tag)
+);
+
+CREATE INDEX trending_tags_score_idx ON trending_tags (window_seconds, score DESC);
+CREATE INDEX chirp_tags_created_idx ON chirp_tags (created_at);
+
+-- +goose Down
+DROP INDEX chirp_tags_created_idx;
+DROP TABLE trending_tags;
+DROP TABLE trending_denylist;
+ALTER TABLE users DROP COLUMN is_admin;
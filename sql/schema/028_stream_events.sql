@@ -0,0 +1,17 @@
+-- +goose Up
+-- the log behind the SSE streams. Rows are kept for a while so clients can
+-- resume from the Last-Event-ID they saw; see stream.go
+CREATE TABLE stream_events (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    chirp_id UUID,
+    -- the chirp's author, or the notification's recipient
+    user_id UUID NOT NULL,
+    notification_id UUID,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX stream_events_created_idx ON stream_events (created_at);
+
+-- +goose Down
+DROP TABLE stream_events;
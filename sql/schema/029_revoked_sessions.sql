@@ -0,0 +1,12 @@
+-- +goose Up
+-- signed-out sessions whose access tokens may still be live. Rows are kept
+-- until the last token minted for the session would have expired
+CREATE TABLE revoked_sessions (
+    session_id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE revoked_sessions;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- exports that failed before failures were given an expiry
+UPDATE data_exports SET expires_at = completed_at + INTERVAL '7 days'
+WHERE status = 'failed' AND expires_at IS NULL;
+
+-- +goose Down
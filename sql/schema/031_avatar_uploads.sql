@@ -0,0 +1,16 @@
+-- +goose Up
+-- the upload an avatar was set from, so uploads still in use as avatars
+-- aren't cleaned up. Avatars set from a URL leave it NULL
+ALTER TABLE users ADD avatar_upload_id UUID REFERENCES uploads(id) ON DELETE SET NULL;
+CREATE INDEX users_avatar_upload_idx ON users (avatar_upload_id) WHERE avatar_upload_id IS NOT NULL;
+
+-- avatars set from uploads before this column existed
+UPDATE users SET avatar_upload_id = upload_variants.upload_id
+FROM upload_variants
+JOIN uploads ON uploads.id = upload_variants.upload_id
+WHERE uploads.user_id = users.id
+AND users.avatar_url LIKE '%/media/' || upload_variants.sha256;
+
+-- +goose Down
+DROP INDEX users_avatar_upload_idx;
+ALTER TABLE users DROP COLUMN avatar_upload_id;
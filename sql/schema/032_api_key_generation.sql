@@ -0,0 +1,10 @@
+-- +goose Up
+-- the owner's token generation when the key was made. Logging out everywhere
+-- bumps the user's, and keys from before that stop working like tokens do
+ALTER TABLE api_keys ADD token_generation INTEGER NOT NULL DEFAULT 0;
+UPDATE api_keys SET token_generation = users.token_generation
+FROM users
+WHERE users.id = api_keys.user_id;
+
+-- +goose Down
+ALTER TABLE api_keys DROP COLUMN token_generation;
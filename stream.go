@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/stream"
+	"github.com/google/uuid"
+)
+
+const (
+	// a chirp was posted, or rechirped
+	streamEventChirp = "chirp"
+	// a chirp or rechirp was deleted
+	streamEventDelete = "delete"
+	// the subscriber was notified of something
+	streamEventNotification = "notification"
+	// the subscriber may have missed events and should refetch what it shows
+	streamEventReset = "reset"
+
+	// how often an idle stream gets a comment, so proxies don't time it out
+	streamHeartbeat = 15 * time.Second
+	// how long events are kept for clients to resume from
+	streamEventRetention = time.Hour
+	// the most events replayed to a resuming client before it's told to reset
+	streamReplayLimit = 1000
+	// how far a subscriber can fall behind before it's dropped
+	streamBufferSize = 256
+	// how many events' shared renders are kept; enough for every subscriber's
+	// buffer and a full replay
+	streamRenderCacheSize = 2 * streamReplayLimit
+)
+
+/* GET /api/stream/public and GET /api/stream/home are Server-Sent Events
+   streams. The public one carries every chirp the caller can see, like
+   GET /api/chirps, and works logged out. The home one needs a login and
+   carries the chirps of the caller's home timeline plus their notifications.
+	id: 1042
+	event: chirp
+	data: {"id": "94b7e44c-3604-42e3-bef7-ebfcc3efff8f", "body": "Hello, world!", ...}
+
+	id: 1043
+	event: delete
+	data: {"id": "94b7e44c-3604-42e3-bef7-ebfcc3efff8f"}
+
+	id: 1044
+	event: notification
+	data: {"id": "3f0f6b1e-8c0a-4b6e-9b1a-2d4c6e8f0a1b", "kind": "like", ...}
+   "chirp" data is a chirp as GET /api/chirps/{chirpID} returns it (with
+   ?expand=author on the stream URL to embed authors), except that it's
+   rendered once for every subscriber and so leaves out "liked_by_me".
+   "notification" data is a single, ungrouped notification (see
+   notifications.go). Deletes go to whoever could see the chirp's author; a
+   delete of a chirp also removes its rechirps.
+
+   Reconnecting with the Last-Event-ID header (or ?last_event_id=, for the
+   first connection) replays what was missed. Events are kept for an hour; a
+   client that's been away longer, or has missed more than 1000, gets a
+   "reset" event instead and should refetch. Either way events can now and
+   then arrive twice. An idle stream gets a comment every 15 seconds.
+*/
+
+type StreamDelete struct {
+	ID uuid.UUID `json:"id"`
+}
+
+// publishStreamEvent logs an event for the streams. It takes the caller's
+// Queries so it's only sent if the transaction commits. Publishing holds off
+// every other publisher until then (see LockStreamEvents), so it's best left
+// until just before the commit.
+func publishStreamEvent(ctx context.Context, q *database.Queries, kind string, userID uuid.UUID, chirpID, notificationID uuid.NullUUID) error {
+	if err := q.LockStreamEvents(ctx); err != nil {
+		return err
+	}
+	return q.PublishStreamEvent(ctx, database.PublishStreamEventParams{
+		Kind:           kind,
+		ChirpID:        chirpID,
+		UserID:         userID,
+		NotificationID: notificationID,
+		Channel:        stream.Channel,
+	})
+}
+
+// pruneStreamEvents deletes events once they're too old to resume from
+func (cfg *apiConfig) pruneStreamEvents(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pruned, err := cfg.DbPtr.DeleteStreamEventsBefore(ctx, time.Now().UTC().Add(-streamEventRetention))
+			if err != nil {
+				log.Printf("Couldn't prune stream events: %s", err)
+			} else if pruned > 0 {
+				log.Printf("Pruned %d old stream events", pruned)
+			}
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerStreamPublic(w http.ResponseWriter, r *http.Request) {
+	cfg.serveStream(w, r, false)
+}
+
+func (cfg *apiConfig) handlerStreamHome(w http.ResponseWriter, r *http.Request) {
+	cfg.serveStream(w, r, true)
+}
+
+func (cfg *apiConfig) serveStream(w http.ResponseWriter, r *http.Request, home bool) {
+	viewerID := claimsFromContext(r.Context()).UserID
+
+	var lastEventID int64
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw != "" {
+		var err error
+		lastEventID, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || lastEventID < 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid Last-Event-ID", err)
+			return
+		}
+	}
+
+	// subscribe before replaying, so nothing falls between the two
+	sub := cfg.Stream.Subscribe()
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	out := &sseStream{
+		cfg:      cfg,
+		w:        w,
+		viewerID: viewerID,
+		home:     home,
+		expand:   wantsAuthor(r),
+		lastID:   lastEventID,
+	}
+
+	replayed := map[int64]bool{}
+	if lastEventID > 0 {
+		events, err := cfg.streamReplay(r.Context(), lastEventID)
+		if err != nil {
+			log.Printf("Couldn't replay stream events: %s", err)
+			return
+		}
+		if events == nil {
+			if err := out.write(0, streamEventReset, struct{}{}); err != nil {
+				return
+			}
+		}
+		for _, event := range events {
+			replayed[event.ID] = true
+			if err := out.send(r.Context(), event); err != nil {
+				return
+			}
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err := out.heartbeat(); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				// fell too far behind; the client reconnects and catches up
+				return
+			}
+			if replayed[event.ID] {
+				continue
+			}
+			if err := out.send(r.Context(), event); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// streamReplay reads back the events after lastEventID, or returns nil when
+// they can't all be replayed
+func (cfg *apiConfig) streamReplay(ctx context.Context, lastEventID int64) ([]stream.Event, error) {
+	// the client saw lastEventID, so if it's gone it's been pruned and so
+	// may have some that came after it
+	exists, err := cfg.DbPtr.StreamEventExists(ctx, lastEventID)
+	if err != nil || !exists {
+		return nil, err
+	}
+	rows, err := cfg.DbPtr.GetStreamEventsSince(ctx, database.GetStreamEventsSinceParams{
+		ID:    lastEventID,
+		Limit: streamReplayLimit + 1,
+	})
+	if err != nil || len(rows) > streamReplayLimit {
+		return nil, err
+	}
+	events := make([]stream.Event, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, stream.FromRow(row))
+	}
+	return events, nil
+}
+
+// sseStream writes one subscriber's events, leaving out the ones they
+// shouldn't see
+type sseStream struct {
+	cfg      *apiConfig
+	w        http.ResponseWriter
+	viewerID uuid.UUID
+	home     bool
+	expand   bool
+	// the newest event this subscriber has been given or passed over
+	lastID int64
+	// the newest id the client has been sent, so heartbeats can move it on
+	sentID int64
+}
+
+func (s *sseStream) send(ctx context.Context, event stream.Event) error {
+	data, err := s.render(ctx, event)
+	if err != nil {
+		log.Printf("Couldn't render stream event %d: %s", event.ID, err)
+	}
+	s.lastID = max(s.lastID, event.ID)
+	if data == nil {
+		return nil
+	}
+	return s.write(event.ID, event.Kind, data)
+}
+
+// render returns the event's data for this subscriber, or nil if it isn't for them
+func (s *sseStream) render(ctx context.Context, event stream.Event) (any, error) {
+	switch event.Kind {
+	case streamEventChirp, streamEventDelete:
+		shared, err := s.cfg.StreamRenders.get(ctx, event, s.cfg.renderStreamEvent)
+		if err != nil {
+			return nil, err
+		}
+		if shared.author == nil {
+			return nil, nil
+		}
+		visible, err := s.canSee(ctx, *shared.author)
+		if err != nil || !visible {
+			return nil, err
+		}
+		if event.Kind == streamEventDelete {
+			return StreamDelete{ID: event.ChirpID.UUID}, nil
+		}
+		if shared.chirp == nil {
+			return nil, nil
+		}
+		return s.personalize(ctx, *shared.chirp)
+
+	case streamEventNotification:
+		if !s.home || event.UserID != s.viewerID {
+			return nil, nil
+		}
+		notificationDb, err := s.cfg.DbPtr.GetNotification(ctx, database.GetNotificationParams{
+			ID:     event.NotificationID.UUID,
+			UserID: s.viewerID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// taken back since
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s.cfg.notificationResponse(ctx, notificationDb)
+	}
+	return nil, nil
+}
+
+// canSee reports whether this subscriber gets author's chirps: on the home
+// stream if they follow them, and on the public one if they can see them
+func (s *sseStream) canSee(ctx context.Context, author database.User) (bool, error) {
+	if author.ID == s.viewerID {
+		return true, nil
+	}
+	if !s.home {
+		return s.cfg.canSeeAccount(ctx, s.viewerID, author)
+	}
+	follow, err := s.cfg.DbPtr.GetFollow(ctx, database.GetFollowParams{
+		FollowerID: s.viewerID,
+		FolloweeID: author.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return follow.Status == followAccepted, nil
+}
+
+// personalize adjusts a copy of a shared chirp for this subscriber
+func (s *sseStream) personalize(ctx context.Context, chirp Chirp) (Chirp, error) {
+	// the shared render is as an anonymous caller sees it, so a chirp it
+	// quotes may only be hidden from them
+	if chirp.Referenced != nil && chirp.Referenced.Deleted && s.viewerID != uuid.Nil {
+		chirps := []Chirp{chirp}
+		if err := s.cfg.embedReferencedChirps(ctx, chirps, s.viewerID); err != nil {
+			return Chirp{}, err
+		}
+		if err := s.cfg.embedAuthors(ctx, chirps); err != nil {
+			return Chirp{}, err
+		}
+		chirp = chirps[0]
+	}
+	if !s.expand {
+		chirp.Author = nil
+		if chirp.Referenced != nil {
+			referenced := *chirp.Referenced
+			referenced.Author = nil
+			chirp.Referenced = &referenced
+		}
+	}
+	return chirp, nil
+}
+
+// streamRender is the part of rendering an event that's the same for every
+// subscriber
+type streamRender struct {
+	// the user the event is about; nil if they're gone, and the event with them
+	author *database.User
+	// for chirp events, with authors embedded; nil if it's gone
+	chirp *Chirp
+}
+
+// renderStreamEvent does the shared part of rendering a chirp or delete event
+func (cfg *apiConfig) renderStreamEvent(ctx context.Context, event stream.Event) (*streamRender, error) {
+	author, err := cfg.DbPtr.GetUserById(ctx, event.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &streamRender{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	render := &streamRender{author: &author}
+	if event.Kind != streamEventChirp {
+		return render, nil
+	}
+
+	// chirp events are published by the chirp's author, who can always see it
+	chirpDb, err := cfg.DbPtr.GetChirpByID(ctx, database.GetChirpByIDParams{
+		ID:       event.ChirpID.UUID,
+		ViewerID: event.UserID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return render, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	chirps := []Chirp{newChirpResponse(chirpDb)}
+	if err := cfg.embedChirpDetails(ctx, chirps, uuid.Nil); err != nil {
+		return nil, err
+	}
+	if err := cfg.embedAuthors(ctx, chirps); err != nil {
+		return nil, err
+	}
+	render.chirp = &chirps[0]
+	return render, nil
+}
+
+// streamRenderCache keeps the shared renders of recent events, so each is
+// rendered once however many subscribers it goes to
+type streamRenderCache struct {
+	size    int
+	mu      sync.Mutex
+	entries map[int64]*streamRenderEntry
+	// event ids in the order they were added, oldest first
+	order []int64
+}
+
+type streamRenderEntry struct {
+	// closed once render and err are set
+	ready  chan struct{}
+	render *streamRender
+	err    error
+}
+
+func newStreamRenderCache(size int) *streamRenderCache {
+	return &streamRenderCache{
+		size:    size,
+		entries: map[int64]*streamRenderEntry{},
+	}
+}
+
+// get returns the event's shared render, calling build for it if it isn't
+// cached yet. Concurrent callers for the same event wait for the first one's
+// build rather than running their own.
+func (c *streamRenderCache) get(ctx context.Context, event stream.Event, build func(context.Context, stream.Event) (*streamRender, error)) (*streamRender, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[event.ID]
+	if ok {
+		c.mu.Unlock()
+		select {
+		case <-entry.ready:
+			return entry.render, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	entry = &streamRenderEntry{ready: make(chan struct{})}
+	c.entries[event.ID] = entry
+	c.order = append(c.order, event.ID)
+	if len(c.order) > c.size {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.mu.Unlock()
+
+	// other subscribers are waiting on this, so it can't be cut short by this
+	// one going away
+	entry.render, entry.err = build(context.WithoutCancel(ctx), event)
+	close(entry.ready)
+	if entry.err != nil {
+		// let the next subscriber try again
+		c.mu.Lock()
+		if c.entries[event.ID] == entry {
+			delete(c.entries, event.ID)
+		}
+		c.mu.Unlock()
+	}
+	return entry.render, entry.err
+}
+
+func (s *sseStream) write(id int64, kind string, data any) error {
+	dat, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id > 0 {
+		if _, err := fmt.Fprintf(s.w, "id: %d\n", id); err != nil {
+			return err
+		}
+		s.sentID = max(s.sentID, id)
+	}
+	_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", kind, dat)
+	return err
+}
+
+// heartbeat keeps the connection alive. If events have been passed over since
+// the last write, it also moves the client's Last-Event-ID past them: an id
+// with no data updates it without firing an event.
+func (s *sseStream) heartbeat() error {
+	if s.lastID > s.sentID {
+		if _, err := fmt.Fprintf(s.w, "id: %d\n", s.lastID); err != nil {
+			return err
+		}
+		s.sentID = s.lastID
+	}
+	_, err := fmt.Fprint(s.w, ": heartbeat\n\n")
+	return err
+}
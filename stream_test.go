@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/stream"
+	"github.com/google/uuid"
+)
+
+func TestStreamRenderCacheBuildsOnce(t *testing.T) {
+	cache := newStreamRenderCache(8)
+	var builds atomic.Int32
+	release := make(chan struct{})
+	build := func(ctx context.Context, event stream.Event) (*streamRender, error) {
+		builds.Add(1)
+		<-release
+		return &streamRender{}, nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.get(context.Background(), stream.Event{ID: 1}, build); err != nil {
+				t.Errorf("get: %s", err)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	if got := builds.Load(); got != 1 {
+		t.Errorf("built %d times, want 1", got)
+	}
+}
+
+func TestStreamRenderCacheRetriesErrors(t *testing.T) {
+	cache := newStreamRenderCache(8)
+	builds := 0
+	build := func(ctx context.Context, event stream.Event) (*streamRender, error) {
+		builds++
+		if builds == 1 {
+			return nil, errors.New("database went away")
+		}
+		return &streamRender{}, nil
+	}
+
+	if _, err := cache.get(context.Background(), stream.Event{ID: 1}, build); err == nil {
+		t.Fatal("first get succeeded, want the build's error")
+	}
+	if _, err := cache.get(context.Background(), stream.Event{ID: 1}, build); err != nil {
+		t.Fatalf("second get: %s", err)
+	}
+	if builds != 2 {
+		t.Errorf("built %d times, want 2", builds)
+	}
+}
+
+func TestStreamRenderCacheEvictsOldest(t *testing.T) {
+	cache := newStreamRenderCache(2)
+	builds := map[int64]int{}
+	build := func(ctx context.Context, event stream.Event) (*streamRender, error) {
+		builds[event.ID]++
+		return &streamRender{}, nil
+	}
+
+	for _, id := range []int64{1, 2, 3, 2, 1} {
+		if _, err := cache.get(context.Background(), stream.Event{ID: id}, build); err != nil {
+			t.Fatalf("get %d: %s", id, err)
+		}
+	}
+	if builds[1] != 2 || builds[2] != 1 || builds[3] != 1 {
+		t.Errorf("got builds %v, want event 1 rebuilt after eviction and the rest built once", builds)
+	}
+}
+
+// newStreamTestConfig runs in a transaction that's rolled back afterwards.
+// Nothing is NOTIFYed before a commit, so the only events a stream gets are
+// the ones it replays.
+func newStreamTestConfig(t *testing.T) (*apiConfig, *database.Queries, *sql.Tx) {
+	t.Helper()
+
+	db := openTestDB(t)
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	q := database.New(tx)
+	cfg := &apiConfig{
+		DbPtr:         q,
+		Stream:        stream.NewHub(streamBufferSize),
+		StreamRenders: newStreamRenderCache(streamRenderCacheSize),
+	}
+	return cfg, q, tx
+}
+
+// publishTestChirp posts a chirp and publishes it, returning the chirp and
+// its event's id
+func publishTestChirp(t *testing.T, q *database.Queries, tx *sql.Tx, authorID uuid.UUID) (database.Chirp, int64) {
+	t.Helper()
+	ctx := context.Background()
+
+	chirp, err := q.CreateChirp(ctx, database.CreateChirpParams{
+		Body:   "streamed",
+		UserID: authorID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirpID := uuid.NullUUID{UUID: chirp.ID, Valid: true}
+	if err := publishStreamEvent(ctx, q, streamEventChirp, authorID, chirpID, uuid.NullUUID{}); err != nil {
+		t.Fatal(err)
+	}
+	var eventID int64
+	err = tx.QueryRowContext(ctx, `SELECT id FROM stream_events WHERE chirp_id = $1 AND kind = $2`, chirp.ID, streamEventChirp).Scan(&eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chirp, eventID
+}
+
+// streamRecorder is an httptest.ResponseRecorder that can be read while the
+// stream is still being served, and says when it's first flushed
+type streamRecorder struct {
+	mu      sync.Mutex
+	header  http.Header
+	body    bytes.Buffer
+	once    sync.Once
+	flushed chan struct{}
+}
+
+func (r *streamRecorder) Header() http.Header { return r.header }
+
+func (r *streamRecorder) WriteHeader(int) {}
+
+func (r *streamRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.body.Write(p)
+}
+
+func (r *streamRecorder) Flush() {
+	r.once.Do(func() { close(r.flushed) })
+}
+
+// readReplay connects to the public stream as an anonymous client resuming
+// from lastEventID, and returns what it was sent before the first flush,
+// which is when the replay is done
+func readReplay(t *testing.T, cfg *apiConfig, lastEventID int64) string {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/stream/public", nil).WithContext(ctx)
+	req.Header.Set("Last-Event-ID", strconv.FormatInt(lastEventID, 10))
+	rec := &streamRecorder{header: http.Header{}, flushed: make(chan struct{})}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cfg.serveStream(rec, req, false)
+	}()
+	select {
+	case <-rec.flushed:
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("stream didn't finish replaying")
+	}
+	cancel()
+	<-done
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.body.String()
+}
+
+func TestStreamReplay(t *testing.T) {
+	cfg, q, tx := newStreamTestConfig(t)
+	authorID := createTestUsers(t, tx, 1)[0]
+
+	_, seenID := publishTestChirp(t, q, tx, authorID)
+	missed, missedID := publishTestChirp(t, q, tx, authorID)
+
+	got := readReplay(t, cfg, seenID)
+	if strings.Contains(got, fmt.Sprintf("id: %d\n", seenID)) {
+		t.Errorf("replay resent the event the client had seen:\n%s", got)
+	}
+	if !strings.Contains(got, fmt.Sprintf("id: %d\nevent: chirp\n", missedID)) || !strings.Contains(got, missed.ID.String()) {
+		t.Errorf("replay left out the missed chirp %s:\n%s", missed.ID, got)
+	}
+	if strings.Contains(got, "event: reset") {
+		t.Errorf("replay sent a reset:\n%s", got)
+	}
+}
+
+func TestStreamReplayResets(t *testing.T) {
+	cfg, q, tx := newStreamTestConfig(t)
+	ctx := context.Background()
+	authorID := createTestUsers(t, tx, 1)[0]
+
+	t.Run("pruned", func(t *testing.T) {
+		_, prunedID := publishTestChirp(t, q, tx, authorID)
+		publishTestChirp(t, q, tx, authorID)
+		if _, err := tx.ExecContext(ctx, `DELETE FROM stream_events WHERE id = $1`, prunedID); err != nil {
+			t.Fatal(err)
+		}
+		if got := readReplay(t, cfg, prunedID); !strings.Contains(got, "event: reset") {
+			t.Errorf("resuming from a pruned event didn't reset:\n%s", got)
+		}
+	})
+
+	t.Run("too many missed", func(t *testing.T) {
+		_, seenID := publishTestChirp(t, q, tx, authorID)
+		_, err := tx.ExecContext(ctx, `INSERT INTO stream_events (kind, user_id, created_at)
+			SELECT $1, $2, NOW() FROM generate_series(1, $3::int)`, streamEventDelete, authorID, streamReplayLimit+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := readReplay(t, cfg, seenID)
+		if !strings.Contains(got, "event: reset") {
+			t.Errorf("missing more than %d events didn't reset", streamReplayLimit)
+		}
+		if strings.Contains(got, "event: delete") {
+			t.Errorf("replayed events as well as resetting")
+		}
+	})
+}
+
+func TestStreamHidesPrivateAuthors(t *testing.T) {
+	cfg, q, tx := newStreamTestConfig(t)
+	ctx := context.Background()
+	userIDs := createTestUsers(t, tx, 3)
+	author, follower, stranger := userIDs[0], userIDs[1], userIDs[2]
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET is_private = true WHERE id = $1`, author); err != nil {
+		t.Fatal(err)
+	}
+	_, err := q.CreateFollow(ctx, database.CreateFollowParams{
+		FollowerID: follower,
+		FolloweeID: author,
+		Status:     followAccepted,
+		AcceptedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chirp, chirpEventID := publishTestChirp(t, q, tx, author)
+	chirpID := uuid.NullUUID{UUID: chirp.ID, Valid: true}
+	events := []stream.Event{
+		{ID: chirpEventID, Kind: streamEventChirp, ChirpID: chirpID, UserID: author},
+		{ID: chirpEventID + 1, Kind: streamEventDelete, ChirpID: chirpID, UserID: author},
+	}
+
+	tests := []struct {
+		name     string
+		viewerID uuid.UUID
+		home     bool
+		want     bool
+	}{
+		{name: "anonymous", viewerID: uuid.Nil, want: false},
+		{name: "stranger", viewerID: stranger, want: false},
+		{name: "stranger's home", viewerID: stranger, home: true, want: false},
+		{name: "follower", viewerID: follower, want: true},
+		{name: "follower's home", viewerID: follower, home: true, want: true},
+		{name: "author", viewerID: author, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &sseStream{cfg: cfg, viewerID: tt.viewerID, home: tt.home}
+			for _, event := range events {
+				data, err := s.render(ctx, event)
+				if err != nil {
+					t.Fatalf("render(%s) error = %v", event.Kind, err)
+				}
+				if got := data != nil; got != tt.want {
+					t.Errorf("render(%s) sent = %v, want %v", event.Kind, got, tt.want)
+				}
+			}
+		})
+	}
+}
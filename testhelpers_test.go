@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// openTestDB connects to the migrated database in CHIRPY_TEST_DB_URL, and
+// skips the test or benchmark when it isn't set
+func openTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+
+	dbURL := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dbURL == "" {
+		tb.Skip("set CHIRPY_TEST_DB_URL to a migrated test database to run this")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+// execer is a *sql.DB or a *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// createTestUsers inserts n users with unique handles and emails and returns
+// their IDs. Deleting them, or rolling back, is up to the caller.
+func createTestUsers(tb testing.TB, db execer, n int) []uuid.UUID {
+	tb.Helper()
+
+	prefix := "test_" + uuid.NewString()[:8]
+	userIDs := make([]uuid.UUID, n)
+	for i := range userIDs {
+		userIDs[i] = uuid.New()
+	}
+	_, err := db.ExecContext(context.Background(), `INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
+		SELECT id, NOW(), NOW(), $2 || '_' || n || '@example.com', 'unset', $2 || '_' || n
+		FROM unnest($1::uuid[]) WITH ORDINALITY AS t(id, n)`, pq.Array(userIDs), prefix)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return userIDs
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultThreadDepth = 3
+	maxThreadDepth     = 10
+	// how far up the chain of parents GET /thread goes
+	maxThreadAncestors = 50
+	// replies past this many are left out of GET /thread; page through
+	// GET /replies for the rest
+	maxThreadReplies = 500
+)
+
+/* GET /api/chirps/{chirpID}/thread?depth=3 returns a chirp in context
+	{
+		"ancestors": [...],
+		"chirp": {...},
+		"replies": [
+			{
+				"id": "0f9e8d7c-...",
+				"body": "Good point!",
+				...
+				"replies": [...]
+			}
+		]
+	}
+   "ancestors" runs from the start of the thread down to the chirp's parent, up
+   to 50 of them. "replies" is a tree of replies, oldest first, ?depth= levels
+   deep (1-10, default 3); compare a reply's "reply_count" with its "replies"
+   to tell when there are more to fetch
+
+   Chirps that were deleted, or that the caller can't see because they're from
+   a private account, show up as tombstones where they have replies. They
+   keep "id", "in_reply_to" and "root_id" but nothing else, and have
+   "deleted": true
+*/
+
+type Thread struct {
+	Ancestors []Chirp       `json:"ancestors"`
+	Chirp     Chirp         `json:"chirp"`
+	Replies   []ThreadReply `json:"replies"`
+}
+
+type ThreadReply struct {
+	Chirp
+	Replies []ThreadReply `json:"replies"`
+}
+
+func newTombstoneResponse(id uuid.UUID, inReplyTo, rootID uuid.NullUUID) Chirp {
+	return Chirp{
+		ID:          id,
+		Attachments: []Attachment{},
+		Hashtags:    []Hashtag{},
+		Mentions:    []Mention{},
+		InReplyTo:   nullUUIDPtr(inReplyTo),
+		RootID:      nullUUIDPtr(rootID),
+		Deleted:     true,
+	}
+}
+
+// threadChirp is a chirp from one of the thread queries, which also return
+// the ones the viewer can't see
+func threadChirp(chirp database.Chirp, visible bool) Chirp {
+	if !visible {
+		return newTombstoneResponse(chirp.ID, chirp.InReplyTo, chirp.RootID)
+	}
+	return newChirpResponse(chirp)
+}
+
+// embedReplyCounts fills in ReplyCount on each chirp with a single query for all of them
+func (cfg *apiConfig) embedReplyCounts(ctx context.Context, chirps []Chirp) error {
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+	if len(chirpIDs) == 0 {
+		return nil
+	}
+
+	rows, err := cfg.DbPtr.GetReplyCounts(ctx, chirpIDs)
+	if err != nil {
+		return err
+	}
+	counts := map[uuid.UUID]int64{}
+	for _, row := range rows {
+		counts[row.ChirpID.UUID] = row.ReplyCount
+	}
+
+	for i := range chirps {
+		chirps[i].ReplyCount = counts[chirps[i].ID]
+	}
+	return nil
+}
+
+// lookupThreadChirp finds the chirp in {chirpID}, which may be a tombstone.
+// Chirps the caller isn't allowed to see aren't found.
+func (cfg *apiConfig) lookupThreadChirp(r *http.Request) (database.GetThreadChirpRow, error) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		return database.GetThreadChirpRow{}, sql.ErrNoRows
+	}
+	chirpDb, err := cfg.DbPtr.GetThreadChirp(r.Context(), database.GetThreadChirpParams{
+		ID:       chirpID,
+		ViewerID: claimsFromContext(r.Context()).UserID,
+	})
+	if err != nil {
+		return database.GetThreadChirpRow{}, err
+	}
+	if !chirpDb.Visible && !chirpDb.DeletedAt.Valid {
+		return database.GetThreadChirpRow{}, sql.ErrNoRows
+	}
+	return chirpDb, nil
+}
+
+// list the direct replies to a chirp, newest first, a page at a time
+func (cfg *apiConfig) handlerGetChirpReplies(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	chirpDb, err := cfg.lookupThreadChirp(r)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp", err)
+		return
+	}
+
+	repliesDb, err := cfg.DbPtr.GetChirpReplies(r.Context(), database.GetChirpRepliesParams{
+		ID:         uuid.NullUUID{UUID: chirpDb.ID, Valid: true},
+		ViewerID:   claims.UserID,
+		CursorTime: cursor.Time,
+		CursorID:   cursor.ID,
+		PageSize:   limit + 1,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve replies", err)
+		return
+	}
+
+	replies := make([]Chirp, 0, len(repliesDb))
+	for _, reply := range repliesDb {
+		replies = append(replies, newChirpResponse(reply))
+	}
+	page := newPage(replies, limit, chirpCursor)
+
+	if err := cfg.embedChirpDetails(r.Context(), page.Items, claims.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp details", err)
+		return
+	}
+	if wantsAuthor(r) {
+		if err := cfg.embedAuthors(r.Context(), page.Items); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp authors", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+// get a chirp with the chirps it replies to and a tree of its replies
+func (cfg *apiConfig) handlerGetChirpThread(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	depth := defaultThreadDepth
+	if s := r.URL.Query().Get("depth"); s != "" {
+		var err error
+		depth, err = strconv.Atoi(s)
+		if err != nil || depth < 1 || depth > maxThreadDepth {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("depth must be between 1 and %d", maxThreadDepth), err)
+			return
+		}
+	}
+
+	chirpDb, err := cfg.lookupThreadChirp(r)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp", err)
+		return
+	}
+	focus := database.Chirp{
+		ID:        chirpDb.ID,
+		CreatedAt: chirpDb.CreatedAt,
+		UpdatedAt: chirpDb.UpdatedAt,
+		Body:      chirpDb.Body,
+		UserID:    chirpDb.UserID,
+		InReplyTo: chirpDb.InReplyTo,
+		RootID:    chirpDb.RootID,
+		DeletedAt: chirpDb.DeletedAt,
+		RechirpOf: chirpDb.RechirpOf,
+		QuoteOf:   chirpDb.QuoteOf,
+	}
+
+	ancestorsDb, err := cfg.DbPtr.GetChirpAncestors(r.Context(), database.GetChirpAncestorsParams{
+		ID:       chirpDb.ID,
+		MaxDepth: maxThreadAncestors,
+		ViewerID: claims.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve thread", err)
+		return
+	}
+	descendantsDb, err := cfg.DbPtr.GetChirpDescendants(r.Context(), database.GetChirpDescendantsParams{
+		ID:       uuid.NullUUID{UUID: chirpDb.ID, Valid: true},
+		MaxDepth: int32(depth),
+		ViewerID: claims.UserID,
+		MaxCount: maxThreadReplies,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve thread", err)
+		return
+	}
+
+	// everything in the thread goes in one list, so the details on all the
+	// visible chirps can be embedded at once
+	chirps := []Chirp{threadChirp(focus, chirpDb.Visible)}
+	// ancestors come back nearest first; the thread reads from the top
+	for i := len(ancestorsDb) - 1; i >= 0; i-- {
+		row := ancestorsDb[i]
+		chirps = append(chirps, threadChirp(database.Chirp{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Body:      row.Body,
+			UserID:    row.UserID,
+			InReplyTo: row.InReplyTo,
+			RootID:    row.RootID,
+			DeletedAt: row.DeletedAt,
+			RechirpOf: row.RechirpOf,
+			QuoteOf:   row.QuoteOf,
+		}, row.Visible))
+	}
+	children := map[uuid.UUID][]uuid.UUID{}
+	for _, row := range descendantsDb {
+		chirps = append(chirps, threadChirp(database.Chirp{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Body:      row.Body,
+			UserID:    row.UserID,
+			InReplyTo: row.InReplyTo,
+			RootID:    row.RootID,
+			DeletedAt: row.DeletedAt,
+			RechirpOf: row.RechirpOf,
+			QuoteOf:   row.QuoteOf,
+		}, row.Visible))
+		children[row.InReplyTo.UUID] = append(children[row.InReplyTo.UUID], row.ID)
+	}
+
+	visible := []Chirp{}
+	for _, chirp := range chirps {
+		if !chirp.Deleted {
+			visible = append(visible, chirp)
+		}
+	}
+	if err := cfg.embedChirpDetails(r.Context(), visible, claims.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp details", err)
+		return
+	}
+	if wantsAuthor(r) {
+		if err := cfg.embedAuthors(r.Context(), visible); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp authors", err)
+			return
+		}
+	}
+	byID := map[uuid.UUID]Chirp{}
+	for _, chirp := range chirps {
+		byID[chirp.ID] = chirp
+	}
+	for _, chirp := range visible {
+		byID[chirp.ID] = chirp
+	}
+
+	thread := Thread{
+		Ancestors: []Chirp{},
+		Chirp:     byID[chirpDb.ID],
+		Replies:   buildThreadReplies(chirpDb.ID, children, byID),
+	}
+	for _, chirp := range chirps[1 : len(ancestorsDb)+1] {
+		thread.Ancestors = append(thread.Ancestors, byID[chirp.ID])
+	}
+	// a parent that's gone altogether (its author's account was purged) still
+	// gets a tombstone, as long as the chain wasn't cut short by the limit
+	top := thread.Chirp
+	if len(thread.Ancestors) > 0 {
+		top = thread.Ancestors[0]
+	}
+	if top.InReplyTo != nil && len(ancestorsDb) < maxThreadAncestors {
+		thread.Ancestors = append([]Chirp{newTombstoneResponse(*top.InReplyTo, uuid.NullUUID{}, uuid.NullUUID{})}, thread.Ancestors...)
+	}
+
+	respondWithJSON(w, http.StatusOK, thread)
+}
+
+// buildThreadReplies assembles the replies under parentID, oldest first.
+// Tombstones are only kept when there are replies under them.
+func buildThreadReplies(parentID uuid.UUID, children map[uuid.UUID][]uuid.UUID, byID map[uuid.UUID]Chirp) []ThreadReply {
+	replies := []ThreadReply{}
+	for _, id := range children[parentID] {
+		reply := ThreadReply{
+			Chirp:   byID[id],
+			Replies: buildThreadReplies(id, children, byID),
+		}
+		if reply.Deleted && len(reply.Replies) == 0 {
+			continue
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
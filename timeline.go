@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+/* GET /api/timeline/home returns a page (see Page in pagination.go) of the
+   caller's own chirps and those of everyone they follow, newest first. Takes
+   ?expand=author like the other chirp endpoints
+
+   By default the page is worked out on every read by joining chirps against
+   follows (fan-out-on-read). With TIMELINE_FANOUT_ON_WRITE set, each chirp is
+   instead copied into its followers' timeline_entries as it's posted, and
+   reads are a single index scan (fan-out-on-write). That makes posting cost
+   grow with the author's follower count, so it's off by default. Run
+   `go run . rebuild-timelines` after turning it on
+*/
+
+func (cfg *apiConfig) handlerGetHomeTimeline(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	cursor, limit, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	chirpsDb, err := cfg.homeTimeline(r.Context(), claims.UserID, cursor, limit+1)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve timeline", err)
+		return
+	}
+
+	chirps := make([]Chirp, 0, len(chirpsDb))
+	for _, chirp := range chirpsDb {
+		chirps = append(chirps, newChirpResponse(chirp))
+	}
+	page := newPage(chirps, limit, chirpCursor)
+
+	if err := cfg.embedChirpDetails(r.Context(), page.Items, claims.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp details", err)
+		return
+	}
+	if wantsAuthor(r) {
+		if err := cfg.embedAuthors(r.Context(), page.Items); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp authors", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+func chirpCursor(chirp Chirp) pageCursor {
+	return pageCursor{Time: chirp.CreatedAt, ID: chirp.ID}
+}
+
+// homeTimeline fetches up to pageSize chirps after cursor from whichever
+// timeline is configured
+func (cfg *apiConfig) homeTimeline(ctx context.Context, userID uuid.UUID, cursor pageCursor, pageSize int32) ([]database.Chirp, error) {
+	if cfg.TimelineFanOutOnWrite {
+		return cfg.DbPtr.GetMaterializedHomeTimeline(ctx, database.GetMaterializedHomeTimelineParams{
+			UserID:     userID,
+			CursorTime: cursor.Time,
+			CursorID:   cursor.ID,
+			PageSize:   pageSize,
+		})
+	}
+	return cfg.DbPtr.GetHomeTimeline(ctx, database.GetHomeTimelineParams{
+		UserID:     userID,
+		CursorTime: cursor.Time,
+		CursorID:   cursor.ID,
+		PageSize:   pageSize,
+	})
+}
+
+// The timeline* hooks keep timeline_entries in step with chirps and follows
+// when fan-out-on-write is on, and do nothing otherwise. They take the
+// caller's Queries so they can run in the same transaction as the change.
+
+// timelineChirped copies a new chirp into its author's and followers' timelines
+func (cfg *apiConfig) timelineChirped(ctx context.Context, q *database.Queries, chirpID uuid.UUID) error {
+	if !cfg.TimelineFanOutOnWrite {
+		return nil
+	}
+	return q.FanOutChirp(ctx, chirpID)
+}
+
+// timelineFollowed backfills a follow that was just accepted
+func (cfg *apiConfig) timelineFollowed(ctx context.Context, q *database.Queries, followerID, authorID uuid.UUID) error {
+	if !cfg.TimelineFanOutOnWrite {
+		return nil
+	}
+	return q.BackfillTimeline(ctx, database.BackfillTimelineParams{
+		UserID:   followerID,
+		AuthorID: authorID,
+	})
+}
+
+// timelineUnfollowed takes an author's chirps back out of a former follower's timeline
+func (cfg *apiConfig) timelineUnfollowed(ctx context.Context, q *database.Queries, followerID, authorID uuid.UUID) error {
+	if !cfg.TimelineFanOutOnWrite {
+		return nil
+	}
+	return q.RemoveFromTimeline(ctx, database.RemoveFromTimelineParams{
+		UserID:   followerID,
+		AuthorID: authorID,
+	})
+}
+
+// runRebuildTimelines implements `chirpy rebuild-timelines`, which refills
+// timeline_entries from scratch. Timelines aren't kept while
+// fan-out-on-write is off, so run it whenever turning it on.
+func runRebuildTimelines(db *sql.DB, dbQueries *database.Queries) error {
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := dbQueries.WithTx(tx)
+
+	if err := qtx.DeleteAllTimelineEntries(ctx); err != nil {
+		return fmt.Errorf("couldn't clear timelines: %w", err)
+	}
+	if err := qtx.FillTimelines(ctx); err != nil {
+		return fmt.Errorf("couldn't fill timelines: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Println("Rebuilt home timelines")
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	benchmarkFollows       = 10000
+	benchmarkChirpsPerUser = 5
+	benchmarkPageSize      = defaultPageSize + 1
+)
+
+// setupTimelineBenchmark builds a user who follows, and is followed by,
+// 10k accounts with a few chirps each, with their timeline materialized. It
+// runs in a transaction that's rolled back afterwards.
+func setupTimelineBenchmark(b *testing.B) (*database.Queries, uuid.UUID) {
+	b.Helper()
+
+	db := openTestDB(b)
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { tx.Rollback() })
+
+	userIDs := createTestUsers(b, tx, benchmarkFollows+1)
+	viewerID, others := userIDs[0], pq.Array(userIDs[1:])
+	steps := []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO follows (follower_id, followee_id, status, created_at, accepted_at)
+		  SELECT $1, id, 'accepted', NOW(), NOW() FROM unnest($2::uuid[]) AS id
+		  UNION ALL
+		  SELECT id, $1, 'accepted', NOW(), NOW() FROM unnest($2::uuid[]) AS id`,
+			[]any{viewerID, others}},
+		{`INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+		  SELECT gen_random_uuid(), NOW() - n * INTERVAL '1 minute' - random() * INTERVAL '1 year', NOW(), 'benchmark chirp', users.id
+		  FROM unnest($1::uuid[]) AS users(id), generate_series(1, $2::int) AS n`,
+			[]any{others, benchmarkChirpsPerUser}},
+		{`INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+		  SELECT $1, chirps.id, chirps.user_id, chirps.created_at
+		  FROM follows JOIN chirps ON chirps.user_id = follows.followee_id
+		  WHERE follows.follower_id = $1`,
+			[]any{viewerID}},
+		{`ANALYZE users, follows, chirps, timeline_entries`, nil},
+	}
+	for _, step := range steps {
+		if _, err := tx.ExecContext(ctx, step.query, step.args...); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return database.New(db).WithTx(tx), viewerID
+}
+
+func BenchmarkHomeTimelineFanOutOnRead(b *testing.B) {
+	q, viewerID := setupTimelineBenchmark(b)
+	ctx := context.Background()
+
+	for b.Loop() {
+		chirps, err := q.GetHomeTimeline(ctx, database.GetHomeTimelineParams{
+			UserID:     viewerID,
+			CursorTime: firstPage.Time,
+			CursorID:   firstPage.ID,
+			PageSize:   benchmarkPageSize,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(chirps) != benchmarkPageSize {
+			b.Fatalf("got %d chirps, want %d", len(chirps), benchmarkPageSize)
+		}
+	}
+}
+
+func BenchmarkHomeTimelineFanOutOnWrite(b *testing.B) {
+	q, viewerID := setupTimelineBenchmark(b)
+	ctx := context.Background()
+
+	for b.Loop() {
+		chirps, err := q.GetMaterializedHomeTimeline(ctx, database.GetMaterializedHomeTimelineParams{
+			UserID:     viewerID,
+			CursorTime: firstPage.Time,
+			CursorID:   firstPage.ID,
+			PageSize:   benchmarkPageSize,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(chirps) != benchmarkPageSize {
+			b.Fatalf("got %d chirps, want %d", len(chirps), benchmarkPageSize)
+		}
+	}
+}
+
+// the price of fan-out-on-write: posting copies the chirp to all 10k followers
+func BenchmarkPostChirpFanOutOnWrite(b *testing.B) {
+	q, viewerID := setupTimelineBenchmark(b)
+	ctx := context.Background()
+
+	for b.Loop() {
+		chirp, err := q.CreateChirp(ctx, database.CreateChirpParams{
+			Body:   "benchmark chirp",
+			UserID: viewerID,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := q.FanOutChirp(ctx, chirp.ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
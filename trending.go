@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTrendingLimit = 10
+	// how many tags are kept per window, and the most GET /api/trending returns
+	maxTrendingTags = 50
+)
+
+/* GET /api/trending?window=1h&limit=10 returns the hashtags trending over one
+   of the configured windows (TRENDING_WINDOWS, default the first), best first
+	{
+		"window": "1h",
+		"computed_at": "2021-07-01T00:00:00Z",
+		"tags": [
+			{
+				"tag": "golang",
+				"score": 7.5,
+				"chirp_count": 31,
+				"author_count": 12
+			}
+		]
+	}
+   A tag's score is how many authors used it in the window, each weighted by
+   how recently they did, over how many usually do (see ComputeTrendingTags).
+   So a tag that's suddenly taking off beats one that's always busy, and one
+   account posting a tag over and over counts once. Tags need at least
+   TRENDING_MIN_AUTHORS authors to show up at all.
+
+   Rankings aren't worked out per request: a background worker recomputes
+   them every TRENDING_INTERVAL, and "computed_at" says when it last did.
+
+   Admins (users with is_admin set; see `chirpy grant-admin`) keep tags off
+   the list with the denylist at /admin/trending/denylist
+	GET lists it, POST {"tag": "#spam"} adds to it and DELETE /{tag} removes from it
+*/
+
+type TrendingResponse struct {
+	Window     string        `json:"window"`
+	ComputedAt time.Time     `json:"computed_at,omitzero"`
+	Tags       []TrendingTag `json:"tags"`
+}
+
+type TrendingTag struct {
+	Tag         string  `json:"tag"`
+	Score       float64 `json:"score"`
+	ChirpCount  int64   `json:"chirp_count"`
+	AuthorCount int64   `json:"author_count"`
+}
+
+type DenylistEntry struct {
+	Tag       string     `json:"tag"`
+	AddedBy   *uuid.UUID `json:"added_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// trendingWindow is one of the TRENDING_WINDOWS, keeping the name it was
+// configured with for responses
+type trendingWindow struct {
+	Name   string
+	Length time.Duration
+}
+
+// parseTrendingWindows reads a comma-separated list of durations of at least
+// a minute, e.g. "1h,24h"
+func parseTrendingWindows(s string) ([]trendingWindow, error) {
+	windows := []trendingWindow{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		length, err := time.ParseDuration(name)
+		if err != nil {
+			return nil, err
+		}
+		if length < time.Minute {
+			return nil, fmt.Errorf("window %s is shorter than a minute", name)
+		}
+		windows = append(windows, trendingWindow{Name: name, Length: length})
+	}
+	return windows, nil
+}
+
+func newDenylistEntry(entry database.TrendingDenylist) DenylistEntry {
+	return DenylistEntry{
+		Tag:       entry.Tag,
+		AddedBy:   nullUUIDPtr(entry.AddedBy),
+		CreatedAt: entry.CreatedAt,
+	}
+}
+
+// refreshTrending recomputes the trending tags for every window, once at
+// startup and then every interval
+func (cfg *apiConfig) refreshTrending(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := cfg.computeTrending(ctx); err != nil {
+			log.Printf("Couldn't compute trending tags: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// computeTrending replaces the rankings in one transaction, so readers see
+// either the old ones or the new
+func (cfg *apiConfig) computeTrending(ctx context.Context) error {
+	tx, err := cfg.DbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	if err := qtx.DeleteAllTrendingTags(ctx); err != nil {
+		return err
+	}
+	for _, window := range cfg.TrendingWindows {
+		err := qtx.ComputeTrendingTags(ctx, database.ComputeTrendingTagsParams{
+			WindowSeconds: int32(window.Length.Seconds()),
+			MinAuthors:    cfg.TrendingMinAuthors,
+			MaxTags:       maxTrendingTags,
+		})
+		if err != nil {
+			return fmt.Errorf("window %s: %w", window.Name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (cfg *apiConfig) handlerGetTrending(w http.ResponseWriter, r *http.Request) {
+	window := cfg.TrendingWindows[0]
+	if s := r.URL.Query().Get("window"); s != "" {
+		length, err := time.ParseDuration(s)
+		found := false
+		for _, configured := range cfg.TrendingWindows {
+			if err == nil && configured.Length == length {
+				window, found = configured, true
+			}
+		}
+		if !found {
+			names := []string{}
+			for _, configured := range cfg.TrendingWindows {
+				names = append(names, configured.Name)
+			}
+			respondWithError(w, http.StatusBadRequest, "window must be one of "+strings.Join(names, ", "), fmt.Errorf("unknown trending window %q", s))
+			return
+		}
+	}
+
+	limit := defaultTrendingLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxTrendingTags {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxTrendingTags), err)
+			return
+		}
+	}
+
+	rows, err := cfg.DbPtr.GetTrendingTags(r.Context(), database.GetTrendingTagsParams{
+		WindowSeconds: int32(window.Length.Seconds()),
+		Limit:         int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve trending tags", err)
+		return
+	}
+
+	resp := TrendingResponse{
+		Window: window.Name,
+		Tags:   []TrendingTag{},
+	}
+	for _, row := range rows {
+		resp.ComputedAt = row.ComputedAt
+		resp.Tags = append(resp.Tags, TrendingTag{
+			Tag:         row.Tag,
+			Score:       row.Score,
+			ChirpCount:  row.ChirpCount,
+			AuthorCount: row.AuthorCount,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerGetTrendingDenylist(w http.ResponseWriter, r *http.Request) {
+	rows, err := cfg.DbPtr.GetTrendingDenylist(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve denylist", err)
+		return
+	}
+
+	entries := make([]DenylistEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, newDenylistEntry(row))
+	}
+
+	respondWithJSON(w, http.StatusOK, entries)
+}
+
+// keep a tag off the trending list, starting now rather than at the next
+// recompute. Returns 201 Created, or 200 OK if it was already denied
+func (cfg *apiConfig) handlerDenyTrendingTag(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	type parameters struct {
+		Tag string `json:"tag"`
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	tag, err := parseTag(params.Tag)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid hashtag", err)
+		return
+	}
+
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update denylist", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	added, err := qtx.AddToTrendingDenylist(r.Context(), database.AddToTrendingDenylistParams{
+		Tag:     tag,
+		AddedBy: uuid.NullUUID{UUID: claims.UserID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update denylist", err)
+		return
+	}
+	entry, err := qtx.GetTrendingDenylistEntry(r.Context(), tag)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update denylist", err)
+		return
+	}
+	if err := qtx.DeleteTrendingTag(r.Context(), tag); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update denylist", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update denylist", err)
+		return
+	}
+
+	status := http.StatusCreated
+	if added == 0 {
+		status = http.StatusOK
+	}
+	respondWithJSON(w, status, newDenylistEntry(entry))
+}
+
+// let a tag trend again from the next recompute. Returns 204 No Content
+func (cfg *apiConfig) handlerAllowTrendingTag(w http.ResponseWriter, r *http.Request) {
+	tag, err := parseTag(r.PathValue("tag"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid hashtag", err)
+		return
+	}
+
+	removed, err := cfg.DbPtr.RemoveFromTrendingDenylist(r.Context(), tag)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update denylist", err)
+		return
+	}
+	if removed == 0 {
+		respondWithError(w, http.StatusNotFound, "Tag isn't on the denylist", sql.ErrNoRows)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runGrantAdmin implements `chirpy grant-admin [-revoke] <handle>`
+func runGrantAdmin(args []string, db *database.Queries) error {
+	fs := flag.NewFlagSet("grant-admin", flag.ExitOnError)
+	revoke := fs.Bool("revoke", false, "take admin away instead")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: grant-admin [-revoke] <handle>")
+	}
+	handle := fs.Arg(0)
+
+	updated, err := db.SetUserAdmin(context.Background(), database.SetUserAdminParams{
+		IsAdmin: !*revoke,
+		Handle:  handle,
+	})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return fmt.Errorf("no user with handle %s", handle)
+	}
+
+	if *revoke {
+		fmt.Printf("%s is no longer an admin\n", handle)
+	} else {
+		fmt.Printf("%s is now an admin\n", handle)
+	}
+	return nil
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/blobstore"
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/imaging"
+	"github.com/google/uuid"
+)
+
+const (
+	maxUploadSize = 5 << 20
+	// room for the multipart boundaries and headers around the file itself
+	maxUploadOverhead = 64 << 10
+	// how long an upload can go unused before it's cleaned up
+	unusedUploadAge = 24 * time.Hour
+	// the most unused uploads cleaned up per sweep
+	unusedUploadBatch = 500
+)
+
+// the only types we accept, going by the file's magic bytes rather than
+// whatever the client claims. Each has to be something internal/imaging can
+// decode, or its metadata couldn't be stripped.
+var allowedUploadTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+var mediaHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+/* Requires an access token with the chirps:write scope and a multipart/form-data
+   body with the image in a field named "file". Returns 202 Accepted with the
+   upload, which is processed in the background. Poll GET /api/uploads/{uploadID}
+   until "status" is "ready" (or "failed"), when it looks like
+	{
+		"id": "1b4e28ba-2fa1-11d2-883f-0016d3cca427",
+		"status": "ready",
+		"content_type": "image/jpeg",
+		"size": 48213,
+		"sha256": "9f86d081884c7d65...",
+		"width": 1000,
+		"height": 2000,
+		"blurhash": "LEHV6nWB2yk8pyo0adR*.7kCMdnj",
+		"url": "http://localhost:8080/media/5e8a14...",
+		"variants": {
+			"original": {"url": "http://localhost:8080/media/5e8a14...", "content_type": "image/jpeg", "width": 1000, "height": 2000, "size": 40122},
+			"medium": {...},
+			"thumbnail": {...}
+		},
+		"created_at": "2021-07-01T00:00:00Z"
+	}
+   "size" and "sha256" describe the file as it was uploaded. The id is what
+   chirps and profiles refer to the upload by. An upload no chirp or profile
+   uses a day after it was made, including a replaced avatar, is deleted.
+*/
+
+type Upload struct {
+	ID          uuid.UUID                `json:"id"`
+	Status      string                   `json:"status"`
+	ContentType string                   `json:"content_type"`
+	Size        int64                    `json:"size"`
+	SHA256      string                   `json:"sha256"`
+	Width       int32                    `json:"width,omitempty"`
+	Height      int32                    `json:"height,omitempty"`
+	BlurHash    string                   `json:"blurhash,omitempty"`
+	Error       string                   `json:"error,omitempty"`
+	URL         string                   `json:"url,omitempty"`
+	Variants    map[string]UploadVariant `json:"variants,omitempty"`
+	CreatedAt   time.Time                `json:"created_at"`
+}
+
+type UploadVariant struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Width       int32  `json:"width"`
+	Height      int32  `json:"height"`
+	Size        int64  `json:"size"`
+}
+
+func (cfg *apiConfig) newUploadResponse(upload database.Upload, variants []database.UploadVariant) Upload {
+	resp := Upload{
+		ID:          upload.ID,
+		Status:      upload.Status,
+		ContentType: upload.ContentType,
+		Size:        upload.Size,
+		SHA256:      upload.Sha256,
+		Width:       upload.Width.Int32,
+		Height:      upload.Height.Int32,
+		BlurHash:    upload.Blurhash.String,
+		Error:       upload.Error.String,
+		CreatedAt:   upload.CreatedAt,
+	}
+	if len(variants) > 0 {
+		resp.Variants = map[string]UploadVariant{}
+	}
+	for _, variant := range variants {
+		resp.Variants[variant.Name] = UploadVariant{
+			URL:         cfg.mediaURL(variant.Sha256),
+			ContentType: variant.ContentType,
+			Width:       variant.Width,
+			Height:      variant.Height,
+			Size:        variant.Size,
+		}
+		if variant.Name == imaging.VariantOriginal {
+			resp.URL = cfg.mediaURL(variant.Sha256)
+			resp.ContentType = variant.ContentType
+		}
+	}
+	return resp
+}
+
+func (cfg *apiConfig) mediaURL(hash string) string {
+	return cfg.BaseURL + "/media/" + hash
+}
+
+// processed variants are stored by content hash and served publicly
+func mediaKey(hash string) string {
+	return "media/" + hash
+}
+
+// the file as uploaded, metadata and all. Never served (see newAppFileServer),
+// and deleted once processed
+func incomingUploadKey(id uuid.UUID) string {
+	return "incoming/" + id.String()
+}
+
+// upload an image. Returns 202 Accepted with the pending upload
+func (cfg *apiConfig) handlerCreateUpload(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+maxUploadOverhead)
+	file, _, err := r.FormFile("file")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Uploads can be at most %d MB", maxUploadSize>>20), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Expected a multipart form with a \"file\" field", err)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read upload", err)
+		return
+	}
+	if len(data) > maxUploadSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Uploads can be at most %d MB", maxUploadSize>>20), fmt.Errorf("upload is larger than %d bytes", maxUploadSize))
+		return
+	}
+	if len(data) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Upload is empty", fmt.Errorf("upload is empty"))
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	if !allowedUploadTypes[contentType] {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Only JPEG, PNG and GIF images can be uploaded", fmt.Errorf("rejected upload of type %s", contentType))
+		return
+	}
+
+	sum := sha256.Sum256(data)
+
+	// the row only becomes visible to processUploads once the file is stored
+	tx, err := cfg.DbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save upload", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	uploadDb, err := qtx.CreateUpload(r.Context(), database.CreateUploadParams{
+		UserID:      claims.UserID,
+		Sha256:      hex.EncodeToString(sum[:]),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save upload", err)
+		return
+	}
+
+	err = cfg.Blobs.Put(r.Context(), incomingUploadKey(uploadDb.ID), bytes.NewReader(data), int64(len(data)), contentType)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store upload", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save upload", err)
+		return
+	}
+
+	// the polling loop in processUploads would get to it eventually; this just saves the wait
+	go cfg.runPendingUploads(context.Background())
+
+	respondWithJSON(w, http.StatusAccepted, cfg.newUploadResponse(uploadDb, nil))
+}
+
+// get one of the caller's uploads, to see whether it's been processed
+func (cfg *apiConfig) handlerGetUpload(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	uploadID, err := uuid.Parse(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid upload ID", err)
+		return
+	}
+
+	uploadDb, err := cfg.DbPtr.GetUpload(r.Context(), uploadID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && uploadDb.UserID != claims.UserID) {
+		respondWithError(w, http.StatusNotFound, "Upload not found", fmt.Errorf("upload %s not found for user %s", uploadID, claims.UserID))
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve upload", err)
+		return
+	}
+
+	variantsDb, err := cfg.DbPtr.GetUploadVariants(r.Context(), uploadDb.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve upload", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.newUploadResponse(uploadDb, variantsDb))
+}
+
+// serve a processed variant by its content hash. The bytes behind a hash
+// never change, so clients and CDNs can cache them forever
+func (cfg *apiConfig) handlerGetMedia(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	if !mediaHashPattern.MatchString(hash) {
+		respondWithError(w, http.StatusNotFound, "Media not found", fmt.Errorf("invalid media hash %q", hash))
+		return
+	}
+
+	contentType, err := cfg.DbPtr.GetMediaContentType(r.Context(), hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Media not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up media", err)
+		return
+	}
+
+	etag := `"` + hash + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	blob, err := cfg.Blobs.Get(r.Context(), mediaKey(hash))
+	if errors.Is(err, blobstore.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Media not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve media", err)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, blob)
+}
+
+// processUploads turns pending uploads into servable variants. Each replica
+// runs one; the claim query's SKIP LOCKED keeps them from doing an upload twice.
+func (cfg *apiConfig) processUploads(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cfg.runPendingUploads(ctx)
+		}
+	}
+}
+
+// sweepUnusedUploads deletes uploads that were never attached to anything,
+// or no longer are, once they're unusedUploadAge old
+func (cfg *apiConfig) sweepUnusedUploads(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			uploadIDs, err := cfg.DbPtr.GetUnusedUploadsBefore(ctx, database.GetUnusedUploadsBeforeParams{
+				CreatedAt: time.Now().UTC().Add(-unusedUploadAge),
+				Limit:     unusedUploadBatch,
+			})
+			if err != nil {
+				log.Printf("Couldn't look up unused uploads: %s", err)
+				continue
+			}
+			cfg.deleteUnusedUploads(ctx, uploadIDs)
+		}
+	}
+}
+
+// runPendingUploads processes uploads until the queue is empty
+func (cfg *apiConfig) runPendingUploads(ctx context.Context) {
+	for {
+		upload, err := cfg.DbPtr.ClaimUpload(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		if err != nil {
+			log.Printf("Couldn't claim upload: %s", err)
+			return
+		}
+
+		if err := cfg.processUpload(ctx, upload); err != nil {
+			log.Printf("Upload %s failed: %s", upload.ID, err)
+			err = cfg.DbPtr.FailUpload(ctx, database.FailUploadParams{
+				ID:    upload.ID,
+				Error: sql.NullString{String: err.Error(), Valid: true},
+			})
+			if err != nil {
+				log.Printf("Couldn't mark upload %s failed: %s", upload.ID, err)
+			}
+			if err := cfg.Blobs.Delete(ctx, incomingUploadKey(upload.ID)); err != nil {
+				log.Printf("Couldn't delete incoming upload %s: %s", upload.ID, err)
+			}
+		}
+	}
+}
+
+func (cfg *apiConfig) processUpload(ctx context.Context, upload database.Upload) error {
+	blob, err := cfg.Blobs.Get(ctx, incomingUploadKey(upload.ID))
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		return err
+	}
+
+	result, err := imaging.Process(data)
+	if errors.Is(err, imaging.ErrTooLarge) {
+		return fmt.Errorf("image can be at most %dx%d pixels", imaging.MaxDimension, imaging.MaxDimension)
+	}
+	if errors.Is(err, imaging.ErrUnsupported) {
+		return fmt.Errorf("file isn't an image we can read")
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, err := cfg.DbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DbPtr.WithTx(tx)
+
+	// until the variants are committed nothing uses their files, so hold off
+	// deleteUploadFiles; in a fixed order, so two uploads can't deadlock
+	hashes := make([]string, len(result.Variants))
+	for i, variant := range result.Variants {
+		sum := sha256.Sum256(variant.Data)
+		hashes[i] = hex.EncodeToString(sum[:])
+	}
+	for _, hash := range slices.Sorted(slices.Values(hashes)) {
+		if err := qtx.LockMedia(ctx, hash); err != nil {
+			return err
+		}
+	}
+
+	for i, variant := range result.Variants {
+		hash := hashes[i]
+		if err := cfg.Blobs.Put(ctx, mediaKey(hash), bytes.NewReader(variant.Data), int64(len(variant.Data)), variant.ContentType); err != nil {
+			return err
+		}
+		err = qtx.CreateUploadVariant(ctx, database.CreateUploadVariantParams{
+			UploadID:    upload.ID,
+			Name:        variant.Name,
+			Sha256:      hash,
+			ContentType: variant.ContentType,
+			Width:       int32(variant.Width),
+			Height:      int32(variant.Height),
+			Size:        int64(len(variant.Data)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = qtx.CompleteUpload(ctx, database.CompleteUploadParams{
+		ID:       upload.ID,
+		Width:    sql.NullInt32{Int32: int32(result.Width), Valid: true},
+		Height:   sql.NullInt32{Int32: int32(result.Height), Valid: true},
+		Blurhash: sql.NullString{String: result.BlurHash, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// the variants are all we serve, and unlike the upload they carry no EXIF
+	if err := cfg.Blobs.Delete(ctx, incomingUploadKey(upload.ID)); err != nil {
+		log.Printf("Couldn't delete incoming upload %s: %s", upload.ID, err)
+	}
+	return nil
+}
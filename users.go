@@ -2,12 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/benjaminafoster/chirpy/internal/database"
 	"github.com/google/uuid"
 	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/handle"
 )
 
 /* Accepts a JSON body with the following shape
@@ -15,11 +17,14 @@ import (
   		"email": "user@example.com",
 		"password": "example_password"
 	}
+   "password" may be left out to create an account that logs in by magic link only,
+   and "handle" to get a generated placeholder
 */
 
 type UserRequestBody struct {
 	Email           string `json:"email"`
 	Password        string `json:"password"`
+	Handle          string `json:"handle"`
 }
 
 /* Returns 201 Created if user is successfully created
@@ -27,14 +32,48 @@ type UserRequestBody struct {
 		"id": "50746277-23c6-4d85-a890-564c0044c2fb",
 		"created_at": "2021-07-07T00:00:00Z",
 		"updated_at": "2021-07-07T00:00:00Z",
-		"email": "user@example.com"
+		"email": "user@example.com",
+		"email_verified_at": null,
+		"password_login_enabled": true,
+		"handle": "lane",
+		"display_name": "Lane Wagner",
+		"bio": "",
+		"avatar_url": "",
+		"is_private": false
 	}
+   This is the account owner's view; everyone else sees PublicUser (profiles.go)
 */
 type User struct {
-	Id              uuid.UUID `json:"id"`
-	Created_At      time.Time `json:"created_at"`
-	Updated_At      time.Time `json:"updated_at"`
-	Email           string    `json:"email"`
+	Id                     uuid.UUID  `json:"id"`
+	Created_At             time.Time  `json:"created_at"`
+	Updated_At             time.Time  `json:"updated_at"`
+	Email                  string     `json:"email"`
+	Email_Verified_At      *time.Time `json:"email_verified_at"`
+	Password_Login_Enabled bool       `json:"password_login_enabled"`
+	Handle                 string     `json:"handle"`
+	Display_Name           string     `json:"display_name"`
+	Bio                    string     `json:"bio"`
+	Avatar_Url             string     `json:"avatar_url"`
+	Is_Private             bool       `json:"is_private"`
+}
+
+func newUserResponse(user database.User) User {
+	resp := User{
+		Id:                     user.ID,
+		Created_At:             user.CreatedAt,
+		Updated_At:             user.UpdatedAt,
+		Email:                  user.Email,
+		Password_Login_Enabled: user.PasswordLoginEnabled,
+		Handle:                 user.Handle,
+		Display_Name:           user.DisplayName,
+		Bio:                    user.Bio,
+		Avatar_Url:             user.AvatarUrl,
+		Is_Private:             user.IsPrivate,
+	}
+	if user.EmailVerifiedAt.Valid {
+		resp.Email_Verified_At = &user.EmailVerifiedAt.Time
+	}
+	return resp
 }
 
 // post one user
@@ -49,9 +88,25 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	hashed_pwd, err := auth.HashPassword(reqBody.Password)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+	// without a password the account can only log in by magic link
+	hashed_pwd := ""
+	if reqBody.Password != "" {
+		hashed_pwd, err = auth.HashPassword(reqBody.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+			return
+		}
+	}
+
+	userHandle := reqBody.Handle
+	if userHandle == "" {
+		userHandle, err = handle.Generate()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate handle", err)
+			return
+		}
+	} else if err := handle.Validate(userHandle); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
 
@@ -59,21 +114,25 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 	params := database.CreateUserParams{
 		Email: reqBody.Email,
 		HashedPassword: hashed_pwd,
+		PasswordLoginEnabled: hashed_pwd != "",
+		Handle: userHandle,
 	}
 
 	// Create the user in the DB
 	user, err := cfg.DbPtr.CreateUser(r.Context(), params)
+	if isUniqueViolation(err, handleUniqueIndex) {
+		respondWithError(w, http.StatusConflict, "Handle is already taken", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create user in users database", err)
 		return
 	}
 
-	newUser := User{
-		Id:            user.ID,
-		Created_At:    user.CreatedAt,
-		Updated_At:    user.UpdatedAt,
-		Email:         user.Email,
+	// a failed send shouldn't fail sign up; the user can ask for another link
+	if err := cfg.sendVerificationEmail(r.Context(), user); err != nil {
+		log.Printf("Couldn't send verification email: %s", err)
 	}
 
-	respondWithJSON(w, http.StatusCreated, newUser)
+	respondWithJSON(w, http.StatusCreated, newUserResponse(user))
 }
\ No newline at end of file
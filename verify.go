@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/benjaminafoster/chirpy/internal/auth"
+	"github.com/benjaminafoster/chirpy/internal/database"
+	"github.com/benjaminafoster/chirpy/internal/mailer"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// mail the user a link to GET /api/users/verify
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	token, err := auth.MakeEmailVerificationToken(user.ID, user.Email, cfg.JWTSecret, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/users/verify?token=%s", cfg.BaseURL, url.QueryEscape(token))
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body:    fmt.Sprintf("Welcome to Chirpy!\n\nConfirm your email address by opening the link below. It expires in %s.\n\n%s\n", emailVerificationTTL, link),
+	})
+}
+
+// verify an email address from the link sent on sign up
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondWithError(w, http.StatusBadRequest, "No verification token provided", fmt.Errorf("no verification token provided"))
+		return
+	}
+
+	userID, email, err := auth.ValidateEmailVerificationToken(token, cfg.JWTSecret)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Verification token is invalid or expired", err)
+		return
+	}
+
+	// the email is part of the WHERE clause so a token for an old address can't verify a new one
+	userDb, err := cfg.DbPtr.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+		ID:    userID,
+		Email: email,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Verification token is invalid or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newUserResponse(userDb))
+}
+
+/* Accepts a JSON body with the following shape
+	{
+		"email": "user@example.com"
+	}
+*/
+
+// send a fresh verification link. Always returns 202 so it can't be used to probe for accounts
+func (cfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	reqBody := UserRequestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	userDb, err := cfg.DbPtr.GetUserByEmail(r.Context(), reqBody.Email)
+	if err == nil && !userDb.EmailVerifiedAt.Valid {
+		if err := cfg.sendVerificationEmail(r.Context(), userDb); err != nil {
+			log.Printf("Couldn't send verification email: %s", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}